@@ -483,6 +483,9 @@ type API struct {
 	name string
 	// Optional stage. If defined, the API will be deployed
 	stage *Stage
+	// Optional stage definitions, keyed by the --stage value, that are
+	// used in place of the default stage
+	Stages map[string]*Stage
 	// Existing API to CloneFrom
 	CloneFrom string
 	// API Description
@@ -493,6 +496,9 @@ type API struct {
 	CORSEnabled bool
 	// CORS options - if non-nil, supersedes CORSEnabled
 	CORSOptions *CORSOptions
+	// Optional name used to export the API Gateway URL output. Other
+	// stacks can import the URL with ImportServiceValue.
+	URLExportName string
 }
 
 // LogicalResourceName returns the CloudFormation logical
@@ -501,6 +507,24 @@ func (api *API) LogicalResourceName() string {
 	return CloudFormationResourceName("APIGateway", api.name)
 }
 
+// stageAPI returns the API to export for the given deployment stage. If
+// Stages includes the deployment stage, that Stage is deployed. Otherwise
+// the default stage, if any, is deployed using the deployment stage name.
+func (api *API) stageAPI(deploymentStage string) *API {
+	if "" == deploymentStage {
+		return api
+	}
+	stageAPI := *api
+	if stage, exists := api.Stages[deploymentStage]; exists {
+		stageAPI.stage = stage
+	} else if nil != api.stage {
+		defaultStage := *api.stage
+		defaultStage.name = deploymentStage
+		stageAPI.stage = &defaultStage
+	}
+	return &stageAPI
+}
+
 func (api *API) corsEnabled() bool {
 	return api.CORSEnabled || (api.CORSOptions != nil)
 }
@@ -572,7 +596,7 @@ func (api *API) export(serviceName string,
 			eachResourceMethodKey)
 		lambdaInvokePermission := &gocf.LambdaPermission{
 			Action:       gocf.String("lambda:InvokeFunction"),
-			FunctionName: gocf.GetAtt(eachResourceDef.parentLambda.LogicalResourceName(), "Arn"),
+			FunctionName: eachResourceDef.parentLambda.FunctionARN(),
 			Principal:    gocf.String(APIGatewayPrincipal),
 		}
 		template.AddResource(apiGatewayPermissionResourceName, lambdaInvokePermission)
@@ -614,7 +638,7 @@ func (api *API) export(serviceName string,
 						gocf.String("arn:aws:apigateway:"),
 						gocf.Ref("AWS::Region"),
 						gocf.String(":lambda:path/2015-03-31/functions/"),
-						gocf.GetAtt(eachResourceDef.parentLambda.LogicalResourceName(), "Arn"),
+						eachResourceDef.parentLambda.FunctionARN(),
 						gocf.String("/invocations")),
 				},
 			}
@@ -713,6 +737,14 @@ func (api *API) export(serviceName string,
 				gocf.String(".amazonaws.com/"),
 				gocf.String(stageName)),
 		}
+		if "" != api.URLExportName {
+			template.Outputs[OutputAPIGatewayURL].Export = &gocf.OutputExport{
+				Name: gocf.String(ServiceExport{
+					ServiceName: serviceName,
+					Name:        api.URLExportName,
+				}.ExportName()),
+			}
+		}
 	}
 	return nil
 }
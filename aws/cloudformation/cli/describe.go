@@ -8,9 +8,10 @@ import (
 	"path/filepath"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	spartaAWS "github.com/mweagle/Sparta/aws"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"gopkg.in/go-playground/validator.v9"
 )
@@ -22,6 +23,11 @@ var validate *validator.Validate
 type optionsLinkStruct struct {
 	StackName       string `validate:"required"`
 	OutputDirectory string `validate:"required"`
+	Profile         string `validate:"-"`
+	Region          string `validate:"-"`
+	RoleARN         string `validate:"-"`
+	ExternalID      string `validate:"-"`
+	MFASerialNumber string `validate:"-"`
 }
 
 var optionsLink optionsLinkStruct
@@ -49,10 +55,17 @@ var RootCmd = &cobra.Command{
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Get the output and stuff it to a file
-		sess, err := session.NewSession()
+		err := spartaAWS.SetSessionOptions(spartaAWS.SessionOptions{
+			Profile:         optionsLink.Profile,
+			Region:          optionsLink.Region,
+			RoleARN:         optionsLink.RoleARN,
+			ExternalID:      optionsLink.ExternalID,
+			MFASerialNumber: optionsLink.MFASerialNumber,
+		})
 		if err != nil {
 			return errors.Wrap(err, "Attempting to create session")
 		}
+		sess := spartaAWS.NewSession(logrus.New())
 
 		svc := cloudformation.New(sess)
 
@@ -85,6 +98,11 @@ func init() {
 	cobra.OnInitialize()
 	RootCmd.PersistentFlags().StringVar(&optionsLink.StackName, "stackName", "", "CloudFormation Stack Name/ID to query")
 	RootCmd.PersistentFlags().StringVar(&optionsLink.OutputDirectory, "output", "", "Output directory")
+	RootCmd.PersistentFlags().StringVar(&optionsLink.Profile, "profile", "", "Optional AWS shared configuration profile")
+	RootCmd.PersistentFlags().StringVar(&optionsLink.Region, "region", "", "Optional AWS region")
+	RootCmd.PersistentFlags().StringVar(&optionsLink.RoleARN, "roleArn", "", "Optional IAM role to assume")
+	RootCmd.PersistentFlags().StringVar(&optionsLink.ExternalID, "externalId", "", "Optional external ID used to assume the --roleArn role")
+	RootCmd.PersistentFlags().StringVar(&optionsLink.MFASerialNumber, "mfaSerial", "", "Optional MFA device serial number or ARN used to assume the --roleArn role")
 }
 
 func main() {
@@ -0,0 +1,217 @@
+package cloudformation
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// The vendored aws-sdk-go release predates the CloudFormation drift
+// detection APIs. The operations below are sent with the CloudFormation
+// client, which handles the query protocol serialization and signing
+// for these shapes.
+const (
+	opDetectStackDrift                  = "DetectStackDrift"
+	opDescribeStackDriftDetectionStatus = "DescribeStackDriftDetectionStatus"
+	opDescribeStackResourceDrifts       = "DescribeStackResourceDrifts"
+)
+
+// Drift detection status values
+const (
+	// StackDriftDetectionStatusInProgress is the DETECTION_IN_PROGRESS status
+	StackDriftDetectionStatusInProgress = "DETECTION_IN_PROGRESS"
+	// StackDriftDetectionStatusFailed is the DETECTION_FAILED status
+	StackDriftDetectionStatusFailed = "DETECTION_FAILED"
+	// StackDriftDetectionStatusComplete is the DETECTION_COMPLETE status
+	StackDriftDetectionStatusComplete = "DETECTION_COMPLETE"
+)
+
+// Stack and resource drift status values
+const (
+	// StackDriftStatusDrifted is the DRIFTED status
+	StackDriftStatusDrifted = "DRIFTED"
+	// StackDriftStatusInSync is the IN_SYNC status
+	StackDriftStatusInSync = "IN_SYNC"
+	// StackResourceDriftStatusModified is the MODIFIED status
+	StackResourceDriftStatusModified = "MODIFIED"
+	// StackResourceDriftStatusDeleted is the DELETED status
+	StackResourceDriftStatusDeleted = "DELETED"
+)
+
+type detectStackDriftInput struct {
+	_ struct{} `type:"structure"`
+
+	StackName *string `min:"1" type:"string" required:"true"`
+}
+
+type detectStackDriftOutput struct {
+	_ struct{} `type:"structure"`
+
+	StackDriftDetectionID *string `locationName:"StackDriftDetectionId" min:"1" type:"string" required:"true"`
+}
+
+type describeStackDriftDetectionStatusInput struct {
+	_ struct{} `type:"structure"`
+
+	StackDriftDetectionID *string `locationName:"StackDriftDetectionId" min:"1" type:"string" required:"true"`
+}
+
+type describeStackDriftDetectionStatusOutput struct {
+	_ struct{} `type:"structure"`
+
+	DetectionStatus           *string    `type:"string" required:"true"`
+	DetectionStatusReason     *string    `type:"string"`
+	DriftedStackResourceCount *int64     `type:"integer"`
+	StackDriftDetectionID     *string    `locationName:"StackDriftDetectionId" min:"1" type:"string" required:"true"`
+	StackDriftStatus          *string    `type:"string"`
+	StackID                   *string    `locationName:"StackId" type:"string" required:"true"`
+	Timestamp                 *time.Time `type:"timestamp" timestampFormat:"iso8601" required:"true"`
+}
+
+type describeStackResourceDriftsInput struct {
+	_ struct{} `type:"structure"`
+
+	NextToken                       *string   `min:"1" type:"string"`
+	StackName                       *string   `min:"1" type:"string" required:"true"`
+	StackResourceDriftStatusFilters []*string `min:"1" type:"list"`
+}
+
+type describeStackResourceDriftsOutput struct {
+	_ struct{} `type:"structure"`
+
+	NextToken           *string               `min:"1" type:"string"`
+	StackResourceDrifts []*StackResourceDrift `type:"list" required:"true"`
+}
+
+// PropertyDifference is a single resource property whose actual value
+// differs from the template value
+type PropertyDifference struct {
+	_ struct{} `type:"structure"`
+
+	ActualValue    *string `type:"string" required:"true"`
+	DifferenceType *string `type:"string" required:"true"`
+	ExpectedValue  *string `type:"string" required:"true"`
+	PropertyPath   *string `type:"string" required:"true"`
+}
+
+// StackResourceDrift is the drift information for a single stack resource
+type StackResourceDrift struct {
+	_ struct{} `type:"structure"`
+
+	ActualProperties         *string               `type:"string"`
+	ExpectedProperties       *string               `type:"string"`
+	LogicalResourceID        *string               `locationName:"LogicalResourceId" type:"string" required:"true"`
+	PhysicalResourceID       *string               `locationName:"PhysicalResourceId" type:"string"`
+	PropertyDifferences      []*PropertyDifference `type:"list"`
+	ResourceType             *string               `min:"1" type:"string" required:"true"`
+	StackID                  *string               `locationName:"StackId" type:"string" required:"true"`
+	StackResourceDriftStatus *string               `type:"string" required:"true"`
+	Timestamp                *time.Time            `type:"timestamp" timestampFormat:"iso8601" required:"true"`
+}
+
+// StackDriftResult is the outcome of a stack drift detection operation
+type StackDriftResult struct {
+	// StackDriftStatus is the overall stack status (eg, DRIFTED)
+	StackDriftStatus string
+	// DetectionStatus is the status of the detection operation
+	DetectionStatus string
+	// DetectionStatusReason is the optional reason for a failed detection
+	DetectionStatusReason string
+	// ResourceDrifts are the modified or deleted resources
+	ResourceDrifts []*StackResourceDrift
+}
+
+func sendCloudFormationRequest(awsCloudFormation *cloudformation.CloudFormation,
+	operationName string,
+	input interface{},
+	output interface{}) error {
+	req := awsCloudFormation.NewRequest(&request.Operation{
+		Name:       operationName,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}, input, output)
+	return req.Send()
+}
+
+// DetectStackDrift starts drift detection for the given stack and polls
+// until it completes. The returned result includes every resource whose
+// actual configuration was modified or deleted outside of CloudFormation.
+func DetectStackDrift(stackName string,
+	awsSession *session.Session,
+	logger *logrus.Logger) (*StackDriftResult, error) {
+
+	awsCloudFormation := cloudformation.New(awsSession)
+	detectOutput := &detectStackDriftOutput{}
+	detectErr := sendCloudFormationRequest(awsCloudFormation,
+		opDetectStackDrift,
+		&detectStackDriftInput{
+			StackName: aws.String(stackName),
+		},
+		detectOutput)
+	if nil != detectErr {
+		return nil, errors.Wrapf(detectErr, "Failed to start stack drift detection")
+	}
+	logger.WithFields(logrus.Fields{
+		"StackName":   stackName,
+		"DetectionID": aws.StringValue(detectOutput.StackDriftDetectionID),
+	}).Info("Started stack drift detection")
+
+	progress := newPollingProgress("Waiting for drift detection to complete", logger)
+	defer progress.stop()
+
+	statusOutput := &describeStackDriftDetectionStatusOutput{}
+	for {
+		time.Sleep(pollingInterval())
+		statusErr := sendCloudFormationRequest(awsCloudFormation,
+			opDescribeStackDriftDetectionStatus,
+			&describeStackDriftDetectionStatusInput{
+				StackDriftDetectionID: detectOutput.StackDriftDetectionID,
+			},
+			statusOutput)
+		if nil != statusErr {
+			return nil, errors.Wrapf(statusErr, "Failed to describe drift detection status")
+		}
+		if StackDriftDetectionStatusInProgress != aws.StringValue(statusOutput.DetectionStatus) {
+			break
+		}
+		progress.update()
+	}
+	progress.stop()
+
+	result := &StackDriftResult{
+		StackDriftStatus:      aws.StringValue(statusOutput.StackDriftStatus),
+		DetectionStatus:       aws.StringValue(statusOutput.DetectionStatus),
+		DetectionStatusReason: aws.StringValue(statusOutput.DetectionStatusReason),
+		ResourceDrifts:        make([]*StackResourceDrift, 0),
+	}
+	// A failed detection may still have checked some of the resources, so
+	// report what's available
+	describeInput := &describeStackResourceDriftsInput{
+		StackName: aws.String(stackName),
+		StackResourceDriftStatusFilters: []*string{
+			aws.String(StackResourceDriftStatusModified),
+			aws.String(StackResourceDriftStatusDeleted),
+		},
+	}
+	for {
+		describeOutput := &describeStackResourceDriftsOutput{}
+		describeErr := sendCloudFormationRequest(awsCloudFormation,
+			opDescribeStackResourceDrifts,
+			describeInput,
+			describeOutput)
+		if nil != describeErr {
+			return nil, errors.Wrapf(describeErr, "Failed to describe stack resource drifts")
+		}
+		result.ResourceDrifts = append(result.ResourceDrifts, describeOutput.StackResourceDrifts...)
+		if "" == aws.StringValue(describeOutput.NextToken) {
+			break
+		}
+		describeInput.NextToken = describeOutput.NextToken
+	}
+	return result, nil
+}
@@ -0,0 +1,83 @@
+package cloudformation
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+const describeStackResourceDriftsResponse = `<DescribeStackResourceDriftsResponse xmlns="http://cloudformation.amazonaws.com/doc/2010-05-15/">
+  <DescribeStackResourceDriftsResult>
+    <StackResourceDrifts>
+      <member>
+        <StackId>arn:aws:cloudformation:us-west-2:000000000000:stack/MyService/1</StackId>
+        <ResourceType>AWS::Lambda::Function</ResourceType>
+        <Timestamp>2018-11-28T22:27:06.932Z</Timestamp>
+        <StackResourceDriftStatus>MODIFIED</StackResourceDriftStatus>
+        <LogicalResourceId>MyFunction</LogicalResourceId>
+        <PhysicalResourceId>MyService-MyFunction</PhysicalResourceId>
+        <PropertyDifferences>
+          <member>
+            <PropertyPath>/MemorySize</PropertyPath>
+            <ExpectedValue>128</ExpectedValue>
+            <ActualValue>256</ActualValue>
+            <DifferenceType>NOT_EQUAL</DifferenceType>
+          </member>
+        </PropertyDifferences>
+      </member>
+    </StackResourceDrifts>
+  </DescribeStackResourceDriftsResult>
+</DescribeStackResourceDriftsResponse>`
+
+func TestDescribeStackResourceDriftsRequest(t *testing.T) {
+	var requestBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requestBody = string(body)
+		fmt.Fprint(w, describeStackResourceDriftsResponse)
+	}))
+	defer server.Close()
+
+	awsSession := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	}))
+	output := &describeStackResourceDriftsOutput{}
+	sendErr := sendCloudFormationRequest(cloudformation.New(awsSession),
+		opDescribeStackResourceDrifts,
+		&describeStackResourceDriftsInput{
+			StackName: aws.String("MyService"),
+			StackResourceDriftStatusFilters: []*string{
+				aws.String(StackResourceDriftStatusModified),
+			},
+		},
+		output)
+	if nil != sendErr {
+		t.Fatal(sendErr)
+	}
+	for _, eachParam := range []string{"Action=DescribeStackResourceDrifts",
+		"StackName=MyService",
+		"StackResourceDriftStatusFilters.member.1=MODIFIED"} {
+		if !strings.Contains(requestBody, eachParam) {
+			t.Errorf("Expected request to include %s: %s", eachParam, requestBody)
+		}
+	}
+	if len(output.StackResourceDrifts) != 1 {
+		t.Fatalf("Expected single resource drift, found %d", len(output.StackResourceDrifts))
+	}
+	drift := output.StackResourceDrifts[0]
+	if "MyFunction" != aws.StringValue(drift.LogicalResourceID) ||
+		len(drift.PropertyDifferences) != 1 ||
+		"256" != aws.StringValue(drift.PropertyDifferences[0].ActualValue) {
+		t.Errorf("Unexpected resource drift: %#v", drift)
+	}
+}
@@ -0,0 +1,56 @@
+package cloudformation
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+)
+
+// isNotImportedError returns true if the ListImports error means that
+// no stack imports the export
+func isNotImportedError(err error) bool {
+	awsErr, isAWSErr := err.(awserr.Error)
+	return isAWSErr && strings.Contains(awsErr.Message(), "is not imported by any stack")
+}
+
+// StackExportImports returns the names of the stacks that import each
+// of the stack's exported outputs. Exports that aren't imported by
+// any stack aren't included.
+func StackExportImports(stackName string,
+	awsSession *session.Session) (map[string][]string, error) {
+
+	awsCloudFormation := cloudformation.New(awsSession)
+	describeOutput, describeErr := awsCloudFormation.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(stackName),
+	})
+	if nil != describeErr {
+		return nil, errors.Wrapf(describeErr, "Failed to describe stack")
+	}
+	exportImports := make(map[string][]string)
+	for _, eachStack := range describeOutput.Stacks {
+		for _, eachOutput := range eachStack.Outputs {
+			exportName := aws.StringValue(eachOutput.ExportName)
+			if "" == exportName {
+				continue
+			}
+			importingStacks := make([]string, 0)
+			listErr := awsCloudFormation.ListImportsPages(&cloudformation.ListImportsInput{
+				ExportName: aws.String(exportName),
+			}, func(page *cloudformation.ListImportsOutput, lastPage bool) bool {
+				importingStacks = append(importingStacks, aws.StringValueSlice(page.Imports)...)
+				return true
+			})
+			if nil != listErr && !isNotImportedError(listErr) {
+				return nil, errors.Wrapf(listErr, "Failed to list imports for %s", exportName)
+			}
+			if len(importingStacks) != 0 {
+				exportImports[exportName] = importingStacks
+			}
+		}
+	}
+	return exportImports, nil
+}
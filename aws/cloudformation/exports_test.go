@@ -0,0 +1,23 @@
+package cloudformation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestIsNotImportedError(t *testing.T) {
+	notImported := awserr.New("ValidationError",
+		"Export 'Service-TopicArn' is not imported by any stack.",
+		nil)
+	if !isNotImportedError(notImported) {
+		t.Error("Expected not imported error")
+	}
+	if isNotImportedError(awserr.New("ValidationError", "Stack does not exist", nil)) {
+		t.Error("Unexpected not imported error")
+	}
+	if isNotImportedError(errors.New("is not imported by any stack")) {
+		t.Error("Unexpected not imported error for non-AWS error")
+	}
+}
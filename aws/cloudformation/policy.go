@@ -0,0 +1,141 @@
+package cloudformation
+
+import (
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// StatefulResourceTypes are the CloudFormation resource types whose
+// replacement or deletion loses data
+var StatefulResourceTypes = []string{
+	"AWS::DynamoDB::Table",
+	"AWS::S3::Bucket",
+	"AWS::RDS::DBInstance",
+	"AWS::RDS::DBCluster",
+	"AWS::Kinesis::Stream",
+	"AWS::SQS::Queue",
+	"AWS::EFS::FileSystem",
+	"AWS::Elasticsearch::Domain",
+	"AWS::Cognito::UserPool",
+	"AWS::Logs::LogGroup",
+}
+
+// StackPolicyStatement is a single stack policy statement. See
+// https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/protect-stack-resources.html
+// for more information.
+type StackPolicyStatement struct {
+	Effect      string                 `json:"Effect"`
+	Action      []string               `json:"Action"`
+	Principal   string                 `json:"Principal"`
+	Resource    []string               `json:"Resource,omitempty"`
+	NotResource []string               `json:"NotResource,omitempty"`
+	Condition   map[string]interface{} `json:"Condition,omitempty"`
+}
+
+// StackPolicyDocument is the stack policy that CloudFormation evaluates
+// before it updates stack resources
+type StackPolicyDocument struct {
+	Statement []StackPolicyStatement `json:"Statement"`
+}
+
+// ProtectedResourcesStackPolicy returns a stack policy that allows all
+// updates, except for the replacement or deletion of resources with one of
+// the given types. If no types are provided, StatefulResourceTypes is used.
+func ProtectedResourcesStackPolicy(resourceTypes ...string) *StackPolicyDocument {
+	if len(resourceTypes) == 0 {
+		resourceTypes = StatefulResourceTypes
+	}
+	return &StackPolicyDocument{
+		Statement: []StackPolicyStatement{
+			{
+				Effect:    "Allow",
+				Action:    []string{"Update:*"},
+				Principal: "*",
+				Resource:  []string{"*"},
+			},
+			{
+				Effect:    "Deny",
+				Action:    []string{"Update:Replace", "Update:Delete"},
+				Principal: "*",
+				Resource:  []string{"*"},
+				Condition: map[string]interface{}{
+					"StringEquals": map[string]interface{}{
+						"ResourceType": resourceTypes,
+					},
+				},
+			},
+		},
+	}
+}
+
+// SetStackPolicy applies the stack policy document to the stack
+func SetStackPolicy(stackName string,
+	policy *StackPolicyDocument,
+	awsSession *session.Session,
+	logger *logrus.Logger) error {
+
+	policyJSON, policyJSONErr := json.Marshal(policy)
+	if nil != policyJSONErr {
+		return errors.Wrapf(policyJSONErr, "Failed to marshal stack policy")
+	}
+	awsCloudFormation := cloudformation.New(awsSession)
+	_, setErr := awsCloudFormation.SetStackPolicy(&cloudformation.SetStackPolicyInput{
+		StackName:       aws.String(stackName),
+		StackPolicyBody: aws.String(string(policyJSON)),
+	})
+	if nil != setErr {
+		return errors.Wrapf(setErr, "Failed to set stack policy")
+	}
+	logger.WithFields(logrus.Fields{
+		"StackName": stackName,
+		"Policy":    string(policyJSON),
+	}).Debug("Stack policy applied")
+	return nil
+}
+
+// StackTerminationProtection returns true if termination protection is
+// enabled for the stack
+func StackTerminationProtection(stackName string,
+	awsSession *session.Session) (bool, error) {
+
+	awsCloudFormation := cloudformation.New(awsSession)
+	describeOutput, describeErr := awsCloudFormation.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(stackName),
+	})
+	if nil != describeErr {
+		return false, errors.Wrapf(describeErr, "Failed to describe stack")
+	}
+	for _, eachStack := range describeOutput.Stacks {
+		if aws.BoolValue(eachStack.EnableTerminationProtection) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// UpdateTerminationProtection enables or disables termination
+// protection for the stack
+func UpdateTerminationProtection(stackName string,
+	enabled bool,
+	awsSession *session.Session,
+	logger *logrus.Logger) error {
+
+	awsCloudFormation := cloudformation.New(awsSession)
+	_, updateErr := awsCloudFormation.UpdateTerminationProtection(&cloudformation.UpdateTerminationProtectionInput{
+		StackName:                   aws.String(stackName),
+		EnableTerminationProtection: aws.Bool(enabled),
+	})
+	if nil != updateErr {
+		return errors.Wrapf(updateErr, "Failed to update stack termination protection")
+	}
+	logger.WithFields(logrus.Fields{
+		"StackName": stackName,
+		"Enabled":   enabled,
+	}).Info("Stack termination protection updated")
+	return nil
+}
@@ -0,0 +1,26 @@
+package cloudformation
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestProtectedResourcesStackPolicy(t *testing.T) {
+	policyJSON, policyJSONErr := json.Marshal(ProtectedResourcesStackPolicy())
+	if nil != policyJSONErr {
+		t.Fatal(policyJSONErr)
+	}
+	for _, eachExpected := range []string{`"Action":["Update:*"]`,
+		`"Action":["Update:Replace","Update:Delete"]`,
+		`"ResourceType":["AWS::DynamoDB::Table","AWS::S3::Bucket"`} {
+		if !strings.Contains(string(policyJSON), eachExpected) {
+			t.Errorf("Expected stack policy to include %s: %s", eachExpected, string(policyJSON))
+		}
+	}
+	customPolicy := ProtectedResourcesStackPolicy("AWS::SNS::Topic")
+	resourceTypes := customPolicy.Statement[1].Condition["StringEquals"].(map[string]interface{})["ResourceType"]
+	if len(resourceTypes.([]string)) != 1 {
+		t.Errorf("Unexpected protected resource types: %v", resourceTypes)
+	}
+}
@@ -12,9 +12,9 @@ import (
 
 	awsLambdaCtx "github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	spartaAWS "github.com/mweagle/Sparta/aws"
 	gocf "github.com/mweagle/go-cloudformation"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -95,14 +95,6 @@ func cloudFormationResourceType(resType string) string {
 	return fmt.Sprintf("%s::%s", CustomResourceTypePrefix, resType)
 }
 
-type logrusProxy struct {
-	logger *logrus.Logger
-}
-
-func (proxy *logrusProxy) Log(args ...interface{}) {
-	proxy.logger.Info(args...)
-}
-
 // CloudFormationLambdaEvent is the event to a resource
 type CloudFormationLambdaEvent struct {
 	RequestType           string
@@ -234,29 +226,10 @@ func SendCloudFormationResponse(lambdaCtx *awsLambdaCtx.LambdaContext,
 
 // Returns an AWS Session (https://github.com/aws/aws-sdk-go/wiki/Getting-Started-Configuration)
 // object that attaches a debug level handler to all AWS requests from services
-// sharing the session value.
+// sharing the session value. Endpoint overrides in the function's
+// environment are honored.
 func awsSession(logger *logrus.Logger) *session.Session {
-	awsConfig := &aws.Config{
-		CredentialsChainVerboseErrors: aws.Bool(true),
-	}
-
-	// Log AWS calls if needed
-	switch logger.Level {
-	case logrus.DebugLevel:
-		awsConfig.LogLevel = aws.LogLevel(aws.LogDebugWithHTTPBody)
-	}
-	awsConfig.Logger = &logrusProxy{logger}
-	sess := session.New(awsConfig)
-	sess.Handlers.Send.PushFront(func(r *request.Request) {
-		logger.WithFields(logrus.Fields{
-			"Service":   r.ClientInfo.ServiceName,
-			"Operation": r.Operation.Name,
-			"Method":    r.Operation.HTTPMethod,
-			"Path":      r.Operation.HTTPPath,
-			"Payload":   r.Params,
-		}).Debug("AWS Request")
-	})
-	return sess
+	return spartaAWS.NewSessionWithLevel(aws.LogDebugWithHTTPBody, logger)
 }
 
 // NewCustomResourceLambdaHandler returns a handler for the given
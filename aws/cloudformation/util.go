@@ -26,6 +26,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/briandowns/spinner"
 	humanize "github.com/dustin/go-humanize"
+	spartaAWS "github.com/mweagle/Sparta/aws"
 	gocf "github.com/mweagle/go-cloudformation"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -47,10 +48,75 @@ var reCloudFormationInvalidChars = regexp.MustCompile("[^A-Za-z0-9]+")
 // maximum amount of time allowed for polling CloudFormation
 var cloudformationPollingTimeout = 3 * time.Minute
 
+// StackChangeApprover is called with the pending stack changes before they
+// are applied. For a new stack, every template resource is reported as an
+// Add change. Return false to cancel the operation.
+type StackChangeApprover func(stackName string,
+	changes []*cloudformation.Change) (bool, error)
+
 ////////////////////////////////////////////////////////////////////////////////
 // Private
 ////////////////////////////////////////////////////////////////////////////////
 
+// pollingInterval returns the randomized delay between CloudFormation
+// status requests
+func pollingInterval() time.Duration {
+	return time.Duration(11+rand.Int31n(13)) * time.Second
+}
+
+// pollingProgress reports that a long running CloudFormation operation is
+// still pending. JSON formatted output logs the message, otherwise a
+// spinner is displayed.
+type pollingProgress struct {
+	message   string
+	startTime time.Time
+	spinner   *spinner.Spinner
+	started   bool
+	logger    *logrus.Logger
+}
+
+func (progress *pollingProgress) update() {
+	// If this is JSON output, just do the normal thing
+	switch progress.logger.Formatter.(type) {
+	case *logrus.JSONFormatter:
+		{
+			progress.logger.Info(progress.message)
+		}
+	default:
+		if !progress.started {
+			progress.spinner.Start()
+			progress.started = true
+		}
+		progress.spinner.Suffix = fmt.Sprintf(" %s (requested: %s)",
+			progress.message,
+			humanize.Time(progress.startTime))
+	}
+}
+
+func (progress *pollingProgress) stop() {
+	if progress.started {
+		progress.spinner.Stop()
+		progress.started = false
+	}
+}
+
+func newPollingProgress(message string, logger *logrus.Logger) *pollingProgress {
+	charSetIndex := 39
+	if runtime.GOOS == "windows" {
+		charSetIndex = 14
+	}
+	// The spinner shares the logger's output so that it doesn't
+	// interleave with a document written to stdout
+	progressSpinner := spinner.New(spinner.CharSets[charSetIndex], 500*time.Millisecond)
+	progressSpinner.Writer = logger.Out
+	return &pollingProgress{
+		message:   message,
+		startTime: time.Now(),
+		spinner:   progressSpinner,
+		logger:    logger,
+	}
+}
+
 type resourceProvisionMetrics struct {
 	resourceType      string
 	logicalResourceID string
@@ -217,22 +283,46 @@ func existingStackTemplate(serviceName string,
 func updateStackViaChangeSet(serviceName string,
 	cfTemplate *gocf.Template,
 	cfTemplateURL string,
+	awsParameters []*cloudformation.Parameter,
 	awsTags []*cloudformation.Tag,
 	awsCloudFormation *cloudformation.CloudFormation,
+	approver StackChangeApprover,
 	logger *logrus.Logger) error {
 
 	// Create a change set name...
 	changeSetRequestName := CloudFormationResourceName(fmt.Sprintf("%sChangeSet", serviceName))
-	_, changesErr := CreateStackChangeSet(changeSetRequestName,
+	changes, changesErr := CreateStackChangeSetWithParameters(changeSetRequestName,
 		serviceName,
 		cfTemplate,
 		cfTemplateURL,
+		awsParameters,
 		awsTags,
 		awsCloudFormation,
 		logger)
 	if nil != changesErr {
 		return changesErr
 	}
+	// If there aren't any changes, the change set was already deleted
+	if nil == changes {
+		return nil
+	}
+	if nil != approver {
+		approved, approvedErr := approver(serviceName, changes.Changes)
+		if nil == approvedErr && !approved {
+			approvedErr = errors.Errorf("Changes to stack %s were not approved", serviceName)
+		}
+		if nil != approvedErr {
+			_, deleteChangeSetResultErr := DeleteChangeSet(serviceName,
+				changeSetRequestName,
+				awsCloudFormation)
+			if nil != deleteChangeSetResultErr {
+				logger.WithFields(logrus.Fields{
+					"Error": deleteChangeSetResultErr,
+				}).Warn("Failed to delete unapproved ChangeSet")
+			}
+			return approvedErr
+		}
+	}
 
 	//////////////////////////////////////////////////////////////////////////////
 	// Apply the change
@@ -467,10 +557,7 @@ func AddAutoIncrementingLambdaVersionResource(serviceName string,
 	logger *logrus.Logger) (*AutoIncrementingLambdaVersionInfo, error) {
 
 	// Get the template
-	session, sessionErr := session.NewSession()
-	if sessionErr != nil {
-		return nil, sessionErr
-	}
+	session := spartaAWS.NewSession(logger)
 
 	// Get the current template - for each version we find in the version listing
 	// we look up the actual CF resource and copy it into this template
@@ -607,24 +694,15 @@ func WaitForStackOperationComplete(stackID string,
 	logger *logrus.Logger) (*WaitForStackOperationCompleteResult, error) {
 
 	result := &WaitForStackOperationCompleteResult{}
-
-	startTime := time.Now()
-
-	// Startup a spinner...
-	charSetIndex := 39
-	if runtime.GOOS == "windows" {
-		charSetIndex = 14
-	}
-	cliSpinner := spinner.New(spinner.CharSets[charSetIndex], 500*time.Millisecond)
-	cliSpinnerStarted := false
+	progress := newPollingProgress(pollingMessage, logger)
+	defer progress.stop()
 
 	// Poll for the current stackID state, and
 	describeStacksInput := &cloudformation.DescribeStacksInput{
 		StackName: aws.String(stackID),
 	}
 	for waitComplete := false; !waitComplete; {
-		sleepDuration := time.Duration(11+rand.Int31n(13)) * time.Second
-		time.Sleep(sleepDuration)
+		time.Sleep(pollingInterval())
 
 		describeStacksOutput, err := awsCloudFormation.DescribeStacks(describeStacksInput)
 		if nil != err {
@@ -651,23 +729,7 @@ func WaitForStackOperationComplete(stackID string,
 			result.operationSuccessful = false
 			waitComplete = true
 		default:
-			// If this is JSON output, just do the normal thing
-			switch logger.Formatter.(type) {
-			case *logrus.JSONFormatter:
-				{
-					logger.Info(pollingMessage)
-				}
-			default:
-				if !cliSpinnerStarted {
-					cliSpinner.Start()
-					defer cliSpinner.Stop()
-					cliSpinnerStarted = true
-				}
-				spinnerText := fmt.Sprintf(" %s (requested: %s)",
-					pollingMessage,
-					humanize.Time(startTime))
-				cliSpinner.Suffix = spinnerText
-			}
+			progress.update()
 		}
 	}
 	return result, nil
@@ -778,6 +840,78 @@ func StackExists(stackNameOrID string, awsSession *session.Session, logger *logr
 	return exists, nil
 }
 
+// changeSetContainsNoChanges returns true if the change set failed
+// because the template and tags are unchanged
+func changeSetContainsNoChanges(changeSet *cloudformation.DescribeChangeSetOutput) bool {
+	statusReason := aws.StringValue(changeSet.StatusReason)
+	return strings.Contains(statusReason, "didn't contain changes") ||
+		strings.Contains(statusReason, "No updates are to be performed")
+}
+
+// templateParameterValues returns the CloudFormation parameter values for
+// the template. Template parameters that aren't in parameters keep their
+// previous stack value, if there is one. It's an error to supply a value
+// for a parameter the template doesn't declare.
+func templateParameterValues(cfTemplate *gocf.Template,
+	parameters map[string]string,
+	previousParameters []*cloudformation.Parameter) ([]*cloudformation.Parameter, error) {
+
+	for eachKey := range parameters {
+		if _, exists := cfTemplate.Parameters[eachKey]; !exists {
+			return nil, errors.Errorf("Template does not define parameter: %s", eachKey)
+		}
+	}
+	previousKeys := make(map[string]bool)
+	for _, eachParameter := range previousParameters {
+		previousKeys[aws.StringValue(eachParameter.ParameterKey)] = true
+	}
+	parameterKeys := make([]string, 0)
+	for eachKey := range cfTemplate.Parameters {
+		parameterKeys = append(parameterKeys, eachKey)
+	}
+	sort.Strings(parameterKeys)
+
+	awsParameters := make([]*cloudformation.Parameter, 0)
+	for _, eachKey := range parameterKeys {
+		if eachValue, exists := parameters[eachKey]; exists {
+			awsParameters = append(awsParameters, &cloudformation.Parameter{
+				ParameterKey:   aws.String(eachKey),
+				ParameterValue: aws.String(eachValue),
+			})
+		} else if previousKeys[eachKey] {
+			awsParameters = append(awsParameters, &cloudformation.Parameter{
+				ParameterKey:     aws.String(eachKey),
+				UsePreviousValue: aws.Bool(true),
+			})
+		}
+	}
+	return awsParameters, nil
+}
+
+// StackParameters returns the CloudFormation parameter values to update
+// an existing stack to cfTemplate. Template parameters that aren't in
+// parameters keep their current stack value.
+func StackParameters(stackName string,
+	cfTemplate *gocf.Template,
+	parameters map[string]string,
+	awsCloudFormation *cloudformation.CloudFormation) ([]*cloudformation.Parameter, error) {
+
+	if len(cfTemplate.Parameters) == 0 {
+		return templateParameterValues(cfTemplate, parameters, nil)
+	}
+	describeOutput, describeErr := awsCloudFormation.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(stackName),
+	})
+	if nil != describeErr {
+		return nil, errors.Wrapf(describeErr, "Failed to describe stack parameters")
+	}
+	var previousParameters []*cloudformation.Parameter
+	for _, eachStack := range describeOutput.Stacks {
+		previousParameters = append(previousParameters, eachStack.Parameters...)
+	}
+	return templateParameterValues(cfTemplate, parameters, previousParameters)
+}
+
 // CreateStackChangeSet returns the DescribeChangeSetOutput
 // for a given stack transformation
 func CreateStackChangeSet(changeSetRequestName string,
@@ -787,6 +921,27 @@ func CreateStackChangeSet(changeSetRequestName string,
 	awsTags []*cloudformation.Tag,
 	awsCloudFormation *cloudformation.CloudFormation,
 	logger *logrus.Logger) (*cloudformation.DescribeChangeSetOutput, error) {
+	return CreateStackChangeSetWithParameters(changeSetRequestName,
+		serviceName,
+		cfTemplate,
+		templateURL,
+		nil,
+		awsTags,
+		awsCloudFormation,
+		logger)
+}
+
+// CreateStackChangeSetWithParameters is the same as CreateStackChangeSet,
+// except that the awsParameters values are supplied for the template
+// parameters. See StackParameters.
+func CreateStackChangeSetWithParameters(changeSetRequestName string,
+	serviceName string,
+	cfTemplate *gocf.Template,
+	templateURL string,
+	awsParameters []*cloudformation.Parameter,
+	awsTags []*cloudformation.Tag,
+	awsCloudFormation *cloudformation.CloudFormation,
+	logger *logrus.Logger) (*cloudformation.DescribeChangeSetOutput, error) {
 
 	capabilities := stackCapabilities(cfTemplate)
 	changeSetInput := &cloudformation.CreateChangeSetInput{
@@ -797,6 +952,9 @@ func CreateStackChangeSet(changeSetRequestName string,
 		StackName:     aws.String(serviceName),
 		TemplateURL:   aws.String(templateURL),
 	}
+	if len(awsParameters) != 0 {
+		changeSetInput.Parameters = awsParameters
+	}
 	if len(awsTags) != 0 {
 		changeSetInput.Tags = awsTags
 	}
@@ -842,7 +1000,12 @@ func CreateStackChangeSet(changeSetRequestName string,
 			case "CREATE_COMPLETE":
 				changeSetStabilized = true
 			case "FAILED":
-				return nil, fmt.Errorf("Failed to create ChangeSet: %#v", *describeChangeSetOutput)
+				// An unchanged template and tag set is reported as a failure
+				if changeSetContainsNoChanges(describeChangeSetOutput) {
+					changeSetStabilized = true
+				} else {
+					return nil, fmt.Errorf("Failed to create ChangeSet: %#v", *describeChangeSetOutput)
+				}
 			}
 		}
 	}
@@ -899,6 +1062,30 @@ func DeleteChangeSet(stackName string,
 	}
 }
 
+// StackCreationChanges returns the set of Add changes that creating a new
+// stack from cfTemplate would produce
+func StackCreationChanges(cfTemplate *gocf.Template) []*cloudformation.Change {
+	changes := make([]*cloudformation.Change, 0)
+	for eachResourceID, eachResource := range cfTemplate.Resources {
+		resourceType := ""
+		if nil != eachResource.Properties {
+			resourceType = eachResource.Properties.CfnResourceType()
+		}
+		changes = append(changes, &cloudformation.Change{
+			Type: aws.String(cloudformation.ChangeTypeResource),
+			ResourceChange: &cloudformation.ResourceChange{
+				Action:            aws.String(cloudformation.ChangeActionAdd),
+				LogicalResourceId: aws.String(eachResourceID),
+				ResourceType:      aws.String(resourceType),
+			},
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return *changes[i].ResourceChange.LogicalResourceId < *changes[j].ResourceChange.LogicalResourceId
+	})
+	return changes
+}
+
 // ConvergeStackState ensures that the serviceName converges to the template
 // state defined by cfTemplate. This function establishes a polling loop to determine
 // when the stack operation has completed.
@@ -910,6 +1097,34 @@ func ConvergeStackState(serviceName string,
 	awsSession *session.Session,
 	outputsDivider string,
 	logger *logrus.Logger) (*cloudformation.Stack, error) {
+	return ConvergeStackStateWithApproval(serviceName,
+		cfTemplate,
+		templateURL,
+		nil,
+		tags,
+		startTime,
+		awsSession,
+		outputsDivider,
+		nil,
+		logger)
+}
+
+// ConvergeStackStateWithApproval is the same as ConvergeStackState, except
+// that the optional approver is called with the pending changes before
+// they're applied. If the approver rejects the changes, the change set
+// is deleted and an error is returned. The parameters map supplies values
+// for the template parameters. When an existing stack is updated, template
+// parameters without a value keep their current value.
+func ConvergeStackStateWithApproval(serviceName string,
+	cfTemplate *gocf.Template,
+	templateURL string,
+	parameters map[string]string,
+	tags map[string]string,
+	startTime time.Time,
+	awsSession *session.Session,
+	outputsDivider string,
+	approver StackChangeApprover,
+	logger *logrus.Logger) (*cloudformation.Stack, error) {
 
 	awsCloudFormation := cloudformation.New(awsSession)
 	// Update the tags
@@ -929,11 +1144,20 @@ func ConvergeStackState(serviceName string,
 	}
 	stackID := ""
 	if exists {
+		awsParameters, awsParametersErr := StackParameters(serviceName,
+			cfTemplate,
+			parameters,
+			awsCloudFormation)
+		if nil != awsParametersErr {
+			return nil, awsParametersErr
+		}
 		updateErr := updateStackViaChangeSet(serviceName,
 			cfTemplate,
 			templateURL,
+			awsParameters,
 			awsTags,
 			awsCloudFormation,
+			approver,
 			logger)
 
 		if nil != updateErr {
@@ -941,6 +1165,19 @@ func ConvergeStackState(serviceName string,
 		}
 		stackID = serviceName
 	} else {
+		awsParameters, awsParametersErr := templateParameterValues(cfTemplate, parameters, nil)
+		if nil != awsParametersErr {
+			return nil, awsParametersErr
+		}
+		if nil != approver {
+			approved, approvedErr := approver(serviceName, StackCreationChanges(cfTemplate))
+			if nil != approvedErr {
+				return nil, approvedErr
+			}
+			if !approved {
+				return nil, errors.Errorf("Creation of stack %s was not approved", serviceName)
+			}
+		}
 		// Create stack
 		createStackInput := &cloudformation.CreateStackInput{
 			StackName:        aws.String(serviceName),
@@ -949,6 +1186,9 @@ func ConvergeStackState(serviceName string,
 			OnFailure:        aws.String(cloudformation.OnFailureDelete),
 			Capabilities:     stackCapabilities(cfTemplate),
 		}
+		if len(awsParameters) != 0 {
+			createStackInput.Parameters = awsParameters
+		}
 		if len(awsTags) != 0 {
 			createStackInput.Tags = awsTags
 		}
@@ -1108,6 +1348,17 @@ func UserScopedStackName(basename string) string {
 	return fmt.Sprintf("%s-%s", basename, userName)
 }
 
+// StageScopedStackName returns a CloudFormation stack name that
+// includes the deployment stage (eg, dev, prod) so that multiple
+// stages of the same service can be provisioned in a single account.
+// If the stage is empty, the basename is returned.
+func StageScopedStackName(basename string, stage string) string {
+	if "" == stage {
+		return basename
+	}
+	return fmt.Sprintf("%s-%s", basename, stage)
+}
+
 // ListStacks returns a slice of stacks that meet the given filter.
 func ListStacks(session *session.Session,
 	maxReturned int,
@@ -1133,3 +1384,43 @@ func ListStacks(session *session.Session,
 		listStackInput.NextToken = listResult.NextToken
 	}
 }
+
+// ListStackResources returns the resource summaries for the stack and every
+// stack nested in it. Each AWS::CloudFormation::Stack resource is followed by
+// the resources of the nested stack identified by its PhysicalResourceId.
+func ListStackResources(stackNameOrID string,
+	awsSession *session.Session) ([]*cloudformation.StackResourceSummary, error) {
+
+	awsCloudFormation := cloudformation.New(awsSession)
+	var listStack func(stackName string) ([]*cloudformation.StackResourceSummary, error)
+	listStack = func(stackName string) ([]*cloudformation.StackResourceSummary, error) {
+		stackResources := make([]*cloudformation.StackResourceSummary, 0)
+		listResourcesInput := &cloudformation.ListStackResourcesInput{
+			StackName: aws.String(stackName),
+		}
+		listErr := awsCloudFormation.ListStackResourcesPages(listResourcesInput,
+			func(page *cloudformation.ListStackResourcesOutput, lastPage bool) bool {
+				stackResources = append(stackResources, page.StackResourceSummaries...)
+				return true
+			})
+		if nil != listErr {
+			return nil, errors.Wrapf(listErr, "Failed to list resources for stack %s", stackName)
+		}
+		allResources := make([]*cloudformation.StackResourceSummary, 0)
+		for _, eachSummary := range stackResources {
+			allResources = append(allResources, eachSummary)
+			nestedStackID := aws.StringValue(eachSummary.PhysicalResourceId)
+			if "AWS::CloudFormation::Stack" != aws.StringValue(eachSummary.ResourceType) ||
+				"" == nestedStackID {
+				continue
+			}
+			nestedResources, nestedErr := listStack(nestedStackID)
+			if nil != nestedErr {
+				return nil, nestedErr
+			}
+			allResources = append(allResources, nestedResources...)
+		}
+		return allResources, nil
+	}
+	return listStack(stackNameOrID)
+}
@@ -2,8 +2,17 @@ package cloudformation
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	gocf "github.com/mweagle/go-cloudformation"
 )
 
 var conversionParams = map[string]interface{}{
@@ -143,3 +152,89 @@ func TestExpand(t *testing.T) {
 		}
 	}
 }
+
+func TestTemplateParameterValues(t *testing.T) {
+	cfTemplate := gocf.NewTemplate()
+	cfTemplate.Parameters["Environment"] = &gocf.Parameter{Type: "String"}
+	cfTemplate.Parameters["MemorySize"] = &gocf.Parameter{Type: "Number"}
+	cfTemplate.Parameters["TableName"] = &gocf.Parameter{Type: "String"}
+
+	previous := []*cloudformation.Parameter{
+		{
+			ParameterKey:   aws.String("MemorySize"),
+			ParameterValue: aws.String("128"),
+		},
+	}
+	awsParameters, awsParametersErr := templateParameterValues(cfTemplate,
+		map[string]string{"Environment": "prod"},
+		previous)
+	if nil != awsParametersErr {
+		t.Fatal(awsParametersErr)
+	}
+	if len(awsParameters) != 2 {
+		t.Fatalf("Expected 2 parameters, found %d", len(awsParameters))
+	}
+	if "Environment" != aws.StringValue(awsParameters[0].ParameterKey) ||
+		"prod" != aws.StringValue(awsParameters[0].ParameterValue) {
+		t.Errorf("Unexpected supplied parameter: %s", awsParameters[0])
+	}
+	if "MemorySize" != aws.StringValue(awsParameters[1].ParameterKey) ||
+		!aws.BoolValue(awsParameters[1].UsePreviousValue) {
+		t.Errorf("Expected previous parameter value to be used: %s", awsParameters[1])
+	}
+	_, undeclaredErr := templateParameterValues(cfTemplate,
+		map[string]string{"Undeclared": "value"},
+		nil)
+	if nil == undeclaredErr {
+		t.Error("Expected error for undeclared template parameter")
+	}
+}
+
+const listStackResourcesResponse = `<ListStackResourcesResponse xmlns="http://cloudformation.amazonaws.com/doc/2010-05-15/">
+  <ListStackResourcesResult>
+    <StackResourceSummaries>%s</StackResourceSummaries>
+  </ListStackResourcesResult>
+</ListStackResourcesResponse>`
+
+const listStackResourcesMember = `
+      <member>
+        <LogicalResourceId>%s</LogicalResourceId>
+        <PhysicalResourceId>%s</PhysicalResourceId>
+        <ResourceType>%s</ResourceType>
+        <ResourceStatus>UPDATE_COMPLETE</ResourceStatus>
+        <LastUpdatedTimestamp>2018-11-28T22:27:06.932Z</LastUpdatedTimestamp>
+      </member>`
+
+func TestListStackResources(t *testing.T) {
+	nestedStackID := "arn:aws:cloudformation:us-west-2:000000000000:stack/MyService-Nested/2"
+	stackMembers := map[string]string{
+		"MyService": fmt.Sprintf(listStackResourcesMember,
+			"MyFunction", "MyService-MyFunction", "AWS::Lambda::Function") +
+			fmt.Sprintf(listStackResourcesMember,
+				"NestedStack", nestedStackID, "AWS::CloudFormation::Stack"),
+		nestedStackID: fmt.Sprintf(listStackResourcesMember,
+			"MyNestedFunction", "MyService-MyNestedFunction", "AWS::Lambda::Function"),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		fmt.Fprintf(w, listStackResourcesResponse, stackMembers[r.FormValue("StackName")])
+	}))
+	defer server.Close()
+
+	awsSession := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	}))
+	resources, resourcesErr := ListStackResources("MyService", awsSession)
+	if nil != resourcesErr {
+		t.Fatal(resourcesErr)
+	}
+	logicalNames := make([]string, 0)
+	for _, eachResource := range resources {
+		logicalNames = append(logicalNames, aws.StringValue(eachResource.LogicalResourceId))
+	}
+	if "MyFunction,NestedStack,MyNestedFunction" != strings.Join(logicalNames, ",") {
+		t.Errorf("Unexpected stack resources: %v", logicalNames)
+	}
+}
@@ -0,0 +1,89 @@
+package aws
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+const (
+	// EnvVarEndpointPrefix is the prefix of the environment variables that
+	// override a service endpoint. The suffix is the uppercase endpoint
+	// ID of the service, eg SPARTA_ENDPOINT_CLOUDFORMATION.
+	EnvVarEndpointPrefix = "SPARTA_ENDPOINT_"
+	// EnvVarS3ForcePathStyle enables path style S3 addressing if it's true
+	EnvVarS3ForcePathStyle = "SPARTA_S3_FORCE_PATH_STYLE"
+)
+
+// environmentEndpoints returns the service endpoint overrides defined by
+// the EnvVarEndpointPrefix environment variables, keyed by endpoint ID
+func environmentEndpoints() map[string]string {
+	serviceEndpoints := make(map[string]string)
+	for _, eachVar := range os.Environ() {
+		if !strings.HasPrefix(eachVar, EnvVarEndpointPrefix) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(eachVar, EnvVarEndpointPrefix), "=", 2)
+		if len(parts) != 2 || "" == parts[0] || "" == parts[1] {
+			continue
+		}
+		serviceEndpoints[strings.ToLower(parts[0])] = parts[1]
+	}
+	return serviceEndpoints
+}
+
+// environmentS3ForcePathStyle returns true if EnvVarS3ForcePathStyle
+// enables path style S3 addressing
+func environmentS3ForcePathStyle() bool {
+	forcePathStyle, _ := strconv.ParseBool(os.Getenv(EnvVarS3ForcePathStyle))
+	return forcePathStyle
+}
+
+// endpointResolver returns the resolver that uses the serviceEndpoints
+// URL for an overridden service and the default endpoint otherwise.
+// The default signing values are preserved so that requests to a local
+// stand-in are signed the same way as requests to AWS.
+func endpointResolver(serviceEndpoints map[string]string) endpoints.Resolver {
+	return endpoints.ResolverFunc(func(service string,
+		region string,
+		opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+		resolved, resolvedErr := endpoints.DefaultResolver().EndpointFor(service, region, opts...)
+		endpointURL, exists := serviceEndpoints[service]
+		if !exists {
+			return resolved, resolvedErr
+		}
+		if nil != resolvedErr {
+			resolved = endpoints.ResolvedEndpoint{}
+		}
+		resolved.URL = endpointURL
+		if "" == resolved.SigningRegion {
+			resolved.SigningRegion = region
+		}
+		return resolved, nil
+	})
+}
+
+// EndpointEnvironment returns the environment variables that apply the
+// current SessionOptions and environment endpoint overrides to sessions
+// created in another process, such as a Lambda function or CloudFormation
+// custom resource handler. It's empty if no endpoints are overridden.
+func EndpointEnvironment() map[string]string {
+	sessionOptions.mutex.Lock()
+	options := sessionOptions.options
+	sessionOptions.mutex.Unlock()
+
+	environment := make(map[string]string)
+	serviceEndpoints := environmentEndpoints()
+	for eachService, eachURL := range options.Endpoints {
+		serviceEndpoints[strings.ToLower(eachService)] = eachURL
+	}
+	for eachService, eachURL := range serviceEndpoints {
+		environment[EnvVarEndpointPrefix+strings.ToUpper(eachService)] = eachURL
+	}
+	if options.S3ForcePathStyle || environmentS3ForcePathStyle() {
+		environment[EnvVarS3ForcePathStyle] = "true"
+	}
+	return environment
+}
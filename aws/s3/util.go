@@ -6,9 +6,11 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"regexp"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -20,6 +22,33 @@ import (
 // RollbackFunction called in the event of a stack provisioning failure
 type RollbackFunction func(logger *logrus.Logger) error
 
+// reVirtualHostedHost matches the host of a virtual hosted style S3 URL
+// (eg, bucket.s3.amazonaws.com or bucket.s3-us-west-2.amazonaws.com).
+// The first group is the bucket name.
+var reVirtualHostedHost = regexp.MustCompile(`^(.+)\.s3(-[a-z0-9-]+)?(\.[a-z0-9-]+)*\.amazonaws\.com(\.cn)?$`)
+
+// ObjectURLParts returns the bucket, key and optional version ID of an S3
+// object URL returned by UploadLocalFileToS3 or ObjectURL. Both virtual
+// hosted and path style URLs are supported. URLs for a custom S3 endpoint
+// are path style.
+func ObjectURLParts(s3ObjectURL string) (bucket string, key string, versionID string, err error) {
+	objectURL, objectURLErr := url.Parse(s3ObjectURL)
+	if nil != objectURLErr {
+		return "", "", "", errors.Wrapf(objectURLErr, "Failed to parse S3 URL")
+	}
+	versionID = objectURL.Query().Get("versionId")
+	objectPath := strings.TrimPrefix(objectURL.Path, "/")
+	hostMatch := reVirtualHostedHost.FindStringSubmatch(objectURL.Hostname())
+	if nil != hostMatch {
+		return hostMatch[1], objectPath, versionID, nil
+	}
+	pathParts := strings.SplitN(objectPath, "/", 2)
+	if len(pathParts) != 2 || "" == pathParts[0] {
+		return "", "", "", errors.Errorf("Invalid path style S3 URL: %s", s3ObjectURL)
+	}
+	return pathParts[0], pathParts[1], versionID, nil
+}
+
 // CreateS3RollbackFunc creates an S3 rollback function that attempts to delete a previously
 // uploaded item. Note that s3ArtifactURL may include a `versionId` query arg
 // to denote the specific version to delete.
@@ -28,18 +57,15 @@ func CreateS3RollbackFunc(awsSession *session.Session, s3ArtifactURL string) Rol
 		logger.WithFields(logrus.Fields{
 			"URL": s3ArtifactURL,
 		}).Info("Deleting S3 object")
-		artifactURLParts, artifactURLPartsErr := url.Parse(s3ArtifactURL)
+		s3Bucket, s3Key, versionID, artifactURLPartsErr := ObjectURLParts(s3ArtifactURL)
 		if nil != artifactURLPartsErr {
 			return artifactURLPartsErr
 		}
-		// Bucket is the first component
-		s3Bucket := strings.Split(artifactURLParts.Host, ".")[0]
 		s3Client := s3.New(awsSession)
 		params := &s3.DeleteObjectInput{
 			Bucket: aws.String(s3Bucket),
-			Key:    aws.String(artifactURLParts.Path),
+			Key:    aws.String(s3Key),
 		}
-		versionID := artifactURLParts.Query().Get("versionId")
 		if "" != versionID {
 			params.VersionId = aws.String(versionID)
 		}
@@ -119,6 +145,41 @@ func UploadLocalFileToS3(localPath string,
 	return locationURL, nil
 }
 
+// ObjectURL returns the URL of the object at S3Bucket/S3KeyName in the
+// same format returned by UploadLocalFileToS3, including the `versionId`
+// query arg if the bucket is versioned. If the object does not exist, the
+// empty string is returned.
+func ObjectURL(awsSession *session.Session,
+	S3Bucket string,
+	S3KeyName string,
+	logger *logrus.Logger) (string, error) {
+
+	s3Client := s3.New(awsSession)
+	req, output := s3Client.HeadObjectRequest(&s3.HeadObjectInput{
+		Bucket: aws.String(S3Bucket),
+		Key:    aws.String(S3KeyName),
+	})
+	headErr := req.Send()
+	if nil != headErr {
+		awsErr, awsErrOk := headErr.(awserr.RequestFailure)
+		if awsErrOk && awsErr.StatusCode() == 404 {
+			logger.WithFields(logrus.Fields{
+				"Bucket": S3Bucket,
+				"Key":    S3KeyName,
+			}).Debug("S3 object does not exist")
+			return "", nil
+		}
+		return "", errors.Wrapf(headErr, "Failed to check S3 object")
+	}
+	objectURL := *req.HTTPRequest.URL
+	objectURL.RawQuery = ""
+	locationURL := objectURL.String()
+	if nil != output.VersionId {
+		locationURL = fmt.Sprintf("%s?versionId=%s", locationURL, *output.VersionId)
+	}
+	return locationURL, nil
+}
+
 // BucketVersioningEnabled determines if a given S3 bucket has object
 // versioning enabled.
 func BucketVersioningEnabled(awsSession *session.Session,
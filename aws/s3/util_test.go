@@ -0,0 +1,40 @@
+package s3
+
+import (
+	"testing"
+)
+
+func TestObjectURLParts(t *testing.T) {
+	testCases := []struct {
+		url       string
+		bucket    string
+		key       string
+		versionID string
+	}{
+		{"https://bucket.s3.amazonaws.com/MyService/code.zip", "bucket", "MyService/code.zip", ""},
+		{"https://my.bucket.s3-us-west-2.amazonaws.com/MyService/code.zip?versionId=v1", "my.bucket", "MyService/code.zip", "v1"},
+		{"https://bucket.s3.eu-west-1.amazonaws.com/code.zip", "bucket", "code.zip", ""},
+		{"https://s3.amazonaws.com/bucket/MyService/code.zip?versionId=v2", "bucket", "MyService/code.zip", "v2"},
+		{"https://s3-us-west-2.amazonaws.com/bucket/code.zip", "bucket", "code.zip", ""},
+		{"http://localhost:4572/bucket/MyService/code.zip", "bucket", "MyService/code.zip", ""},
+	}
+	for _, eachTestCase := range testCases {
+		bucket, key, versionID, partsErr := ObjectURLParts(eachTestCase.url)
+		if nil != partsErr {
+			t.Fatal(partsErr)
+		}
+		if bucket != eachTestCase.bucket ||
+			key != eachTestCase.key ||
+			versionID != eachTestCase.versionID {
+			t.Errorf("Unexpected parts for %s: %s, %s, %s",
+				eachTestCase.url,
+				bucket,
+				key,
+				versionID)
+		}
+	}
+	_, _, _, invalidErr := ObjectURLParts("http://localhost:4572/bucket")
+	if nil == invalidErr {
+		t.Error("Expected error for path style URL without a key")
+	}
+}
@@ -1,12 +1,136 @@
 package aws
 
 import (
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// assumedRoleDuration is how long the assumed role credentials are valid.
+// The SDK default of 15 minutes is shorter than many stack updates.
+const assumedRoleDuration = time.Hour
+
+// SessionOptions are the credential, region and endpoint settings applied
+// to every session returned by the NewSession functions. Empty values use
+// the default credential chain, region and endpoints.
+type SessionOptions struct {
+	// Profile is the named profile in the shared credentials and
+	// config files
+	Profile string
+	// Region is used unless the session's aws.Config includes a region
+	Region string
+	// RoleARN is the IAM role to assume using the profile or default
+	// chain credentials
+	RoleARN string
+	// ExternalID is the external ID required by the role trust policy
+	ExternalID string
+	// MFASerialNumber is the serial number or ARN of the MFA device
+	// required by the role trust policy
+	MFASerialNumber string
+	// MFATokenProvider returns the MFA token code. If nil, the code is
+	// read from stdin.
+	MFATokenProvider func() (string, error)
+	// Endpoints are the service endpoint URLs, keyed by the endpoint ID
+	// of the service (eg, cloudformation, s3, lambda, iam, sts). They
+	// take precedence over the EnvVarEndpointPrefix environment variables
+	// and are typically used to target a local stand-in for AWS.
+	Endpoints map[string]string
+	// S3ForcePathStyle uses path style S3 addressing, which local
+	// stand-ins usually require
+	S3ForcePathStyle bool
+}
+
+// sessionOptions are the options applied to new sessions. The assumed
+// role credentials are shared by all sessions so that the MFA code is
+// only requested when the credentials expire.
+var sessionOptions struct {
+	mutex           sync.Mutex
+	options         SessionOptions
+	roleCredentials *credentials.Credentials
+}
+
+// SetSessionOptions sets the options applied to subsequently created
+// sessions
+func SetSessionOptions(options SessionOptions) error {
+	if "" == options.RoleARN &&
+		("" != options.ExternalID || "" != options.MFASerialNumber) {
+		return errors.New("An external ID or MFA serial number requires a role ARN")
+	}
+	sessionOptions.mutex.Lock()
+	defer sessionOptions.mutex.Unlock()
+	sessionOptions.options = options
+	sessionOptions.roleCredentials = nil
+	return nil
+}
+
+// newOptionsSession returns the session for the awsConfig and the current
+// SessionOptions
+func newOptionsSession(awsConfig *aws.Config) (*session.Session, error) {
+	sessionOptions.mutex.Lock()
+	defer sessionOptions.mutex.Unlock()
+
+	options := sessionOptions.options
+	tokenProvider := options.MFATokenProvider
+	if nil == tokenProvider {
+		tokenProvider = stscreds.StdinTokenProvider
+	}
+	sessOptions := session.Options{
+		Profile: options.Profile,
+		// Profiles may themselves assume a role that requires MFA
+		AssumeRoleTokenProvider: tokenProvider,
+	}
+	sessOptions.Config.MergeIn(awsConfig)
+	if "" != options.Profile {
+		sessOptions.SharedConfigState = session.SharedConfigEnable
+	}
+	if nil == sessOptions.Config.Region && "" != options.Region {
+		sessOptions.Config.Region = aws.String(options.Region)
+	}
+	serviceEndpoints := environmentEndpoints()
+	for eachService, eachURL := range options.Endpoints {
+		serviceEndpoints[strings.ToLower(eachService)] = eachURL
+	}
+	if len(serviceEndpoints) != 0 && nil == sessOptions.Config.EndpointResolver {
+		sessOptions.Config.EndpointResolver = endpointResolver(serviceEndpoints)
+	}
+	if nil == sessOptions.Config.S3ForcePathStyle &&
+		(options.S3ForcePathStyle || environmentS3ForcePathStyle()) {
+		sessOptions.Config.S3ForcePathStyle = aws.Bool(true)
+	}
+	sess, sessErr := session.NewSessionWithOptions(sessOptions)
+	if nil != sessErr {
+		return nil, errors.Wrapf(sessErr, "Failed to create AWS session")
+	}
+	if "" == options.RoleARN {
+		return sess, nil
+	}
+	if nil == sessionOptions.roleCredentials {
+		sessionOptions.roleCredentials = stscreds.NewCredentials(sess,
+			options.RoleARN,
+			func(provider *stscreds.AssumeRoleProvider) {
+				provider.Duration = assumedRoleDuration
+				if "" != options.ExternalID {
+					provider.ExternalID = aws.String(options.ExternalID)
+				}
+				if "" != options.MFASerialNumber {
+					provider.SerialNumber = aws.String(options.MFASerialNumber)
+					provider.TokenProvider = tokenProvider
+				}
+			})
+	}
+	return sess.Copy(&aws.Config{
+		Credentials: sessionOptions.roleCredentials,
+	}), nil
+}
+
 type logrusProxy struct {
 	logger *logrus.Logger
 }
@@ -55,7 +179,18 @@ func NewSessionWithConfigLevel(awsConfig *aws.Config,
 		awsConfig.LogLevel = aws.LogLevel(level)
 	}
 	awsConfig.Logger = &logrusProxy{logger}
-	sess := session.New(awsConfig)
+	sess, sessErr := newOptionsSession(awsConfig)
+	if nil != sessErr {
+		// Report the error when the session is used, the same
+		// as session.New
+		logger.WithFields(logrus.Fields{
+			"Error": sessErr,
+		}).Error("Failed to create AWS session")
+		sess = session.New(awsConfig)
+		sess.Handlers.Validate.PushBack(func(r *request.Request) {
+			r.Error = sessErr
+		})
+	}
 	sess.Handlers.Send.PushFront(func(r *request.Request) {
 		logger.WithFields(logrus.Fields{
 			"Service":   r.ClientInfo.ServiceName,
@@ -0,0 +1,107 @@
+package aws
+
+import (
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSessionOptions(t *testing.T) {
+	defer SetSessionOptions(SessionOptions{})
+	logger := logrus.New()
+
+	invalidErr := SetSessionOptions(SessionOptions{
+		ExternalID: "external",
+	})
+	if nil == invalidErr {
+		t.Fatal("Expected an external ID without a role ARN to fail")
+	}
+	optionsErr := SetSessionOptions(SessionOptions{
+		Region:     "eu-west-1",
+		RoleARN:    "arn:aws:iam::123456789012:role/Deployer",
+		ExternalID: "external",
+	})
+	if nil != optionsErr {
+		t.Fatal(optionsErr)
+	}
+	defaultSession := NewSession(logger)
+	if "eu-west-1" != aws.StringValue(defaultSession.Config.Region) {
+		t.Errorf("Expected session options region, found: %s",
+			aws.StringValue(defaultSession.Config.Region))
+	}
+	regionSession := NewSessionWithConfig(&aws.Config{
+		Region: aws.String("us-east-1"),
+	}, logger)
+	if "us-east-1" != aws.StringValue(regionSession.Config.Region) {
+		t.Errorf("Expected config region, found: %s",
+			aws.StringValue(regionSession.Config.Region))
+	}
+	// The assumed role credentials are shared s.t. the role is only
+	// assumed once
+	if nil == defaultSession.Config.Credentials ||
+		defaultSession.Config.Credentials != regionSession.Config.Credentials {
+		t.Error("Expected sessions to share the assumed role credentials")
+	}
+}
+
+func TestSessionEndpoints(t *testing.T) {
+	defer SetSessionOptions(SessionOptions{})
+	os.Setenv(EnvVarEndpointPrefix+"CLOUDFORMATION", "http://localhost:4581")
+	defer os.Unsetenv(EnvVarEndpointPrefix + "CLOUDFORMATION")
+
+	optionsErr := SetSessionOptions(SessionOptions{
+		Region: "us-east-1",
+		Endpoints: map[string]string{
+			"S3": "http://localhost:4572",
+		},
+		S3ForcePathStyle: true,
+	})
+	if nil != optionsErr {
+		t.Fatal(optionsErr)
+	}
+	sess := NewSession(logrus.New())
+	if !aws.BoolValue(sess.Config.S3ForcePathStyle) {
+		t.Error("Expected path style S3 addressing")
+	}
+	expected := map[string]string{
+		"cloudformation": "http://localhost:4581",
+		"s3":             "http://localhost:4572",
+		"lambda":         "https://lambda.us-east-1.amazonaws.com",
+	}
+	for eachService, eachURL := range expected {
+		resolved, resolvedErr := sess.Config.EndpointResolver.EndpointFor(eachService, "us-east-1")
+		if nil != resolvedErr {
+			t.Fatal(resolvedErr)
+		}
+		if eachURL != resolved.URL || "us-east-1" != resolved.SigningRegion {
+			t.Errorf("Unexpected %s endpoint: %#v", eachService, resolved)
+		}
+	}
+}
+
+func TestEndpointEnvironment(t *testing.T) {
+	defer SetSessionOptions(SessionOptions{})
+	if len(EndpointEnvironment()) != 0 {
+		t.Errorf("Expected empty endpoint environment: %#v", EndpointEnvironment())
+	}
+	os.Setenv(EnvVarEndpointPrefix+"CLOUDFORMATION", "http://localhost:4581")
+	defer os.Unsetenv(EnvVarEndpointPrefix + "CLOUDFORMATION")
+	SetSessionOptions(SessionOptions{
+		Endpoints: map[string]string{
+			"S3": "http://localhost:4572",
+		},
+		S3ForcePathStyle: true,
+	})
+	environment := EndpointEnvironment()
+	for eachKey, eachValue := range map[string]string{
+		EnvVarEndpointPrefix + "CLOUDFORMATION": "http://localhost:4581",
+		EnvVarEndpointPrefix + "S3":             "http://localhost:4572",
+		EnvVarS3ForcePathStyle:                  "true",
+	} {
+		if environment[eachKey] != eachValue {
+			t.Errorf("Expected %s=%s in endpoint environment: %#v", eachKey, eachValue, environment)
+		}
+	}
+}
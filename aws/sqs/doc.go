@@ -0,0 +1,24 @@
+/*
+Package sqs provides types to support unmarshalling SQS event source
+messages into SQS specific event structures. BatchHandler adapts a per-message
+function into a Lambda handler that reports partial batch failures, so that
+only the failed messages are returned to the queue. The EventSourceMapping
+must set ReportBatchItemFailures. Example:
+
+    func processMessage(ctx context.Context, message *spartaSQS.EventRecord) error {
+      logger, _ := ctx.Value(sparta.ContextKeyLogger).(*logrus.Logger)
+      logger.Info("SQS message: ", message.Body)
+      return nil
+    }
+
+    lambdaFn := sparta.HandleAWSLambda("SQSConsumer",
+      spartaSQS.BatchHandler(processMessage),
+      sparta.IAMRoleDefinition{})
+    lambdaFn.EventSourceMappings = append(lambdaFn.EventSourceMappings,
+      &sparta.EventSourceMapping{
+        EventSourceArn:          gocf.GetAtt("OrdersQueue", "Arn"),
+        BatchSize:               10,
+        ReportBatchItemFailures: true,
+      })
+*/
+package sqs
@@ -0,0 +1,100 @@
+package sqs
+
+import (
+	"context"
+	"strings"
+)
+
+/*
+{
+    "Records": [
+        {
+            "messageId": "059f36b4-87a3-44ab-83d2-661975830a7d",
+            "receiptHandle": "AQEBwJnKyrHigUMZj6rYigCgxlaS3SLy0a...",
+            "body": "test",
+            "attributes": {
+                "ApproximateReceiveCount": "1",
+                "SentTimestamp": "1545082649183",
+                "SenderId": "AIDAIENQZJOLO23YVJ4VO",
+                "ApproximateFirstReceiveTimestamp": "1545082649185"
+            },
+            "messageAttributes": {},
+            "md5OfBody": "098f6bcd4621d373cade4e832627b4f6",
+            "eventSource": "aws:sqs",
+            "eventSourceARN": "arn:aws:sqs:us-east-2:123456789012:my-queue",
+            "awsRegion": "us-east-2"
+        }
+    ]
+}
+*/
+
+// MessageAttribute is a message attribute value
+type MessageAttribute struct {
+	StringValue      *string  `json:"stringValue,omitempty"`
+	BinaryValue      []byte   `json:"binaryValue,omitempty"`
+	StringListValues []string `json:"stringListValues"`
+	BinaryListValues [][]byte `json:"binaryListValues"`
+	DataType         string   `json:"dataType"`
+}
+
+// EventRecord event data
+type EventRecord struct {
+	MessageID              string                      `json:"messageId"`
+	ReceiptHandle          string                      `json:"receiptHandle"`
+	Body                   string                      `json:"body"`
+	Attributes             map[string]string           `json:"attributes"`
+	MessageAttributes      map[string]MessageAttribute `json:"messageAttributes"`
+	MD5OfBody              string                      `json:"md5OfBody"`
+	MD5OfMessageAttributes string                      `json:"md5OfMessageAttributes"`
+	EventSource            string                      `json:"eventSource"`
+	EventSourceARN         string                      `json:"eventSourceARN"`
+	AWSRegion              string                      `json:"awsRegion"`
+}
+
+// Event data
+type Event struct {
+	Records []EventRecord
+}
+
+// BatchItemFailure identifies a message that wasn't processed
+type BatchItemFailure struct {
+	ItemIdentifier string `json:"itemIdentifier"`
+}
+
+// BatchResponse is the partial batch response. Messages in
+// BatchItemFailures are returned to the queue and the rest of the batch
+// is deleted.
+type BatchResponse struct {
+	BatchItemFailures []BatchItemFailure `json:"batchItemFailures"`
+}
+
+// RecordHandler processes a single message. A non-nil error reports the
+// message as a batch item failure.
+type RecordHandler func(ctx context.Context, record *EventRecord) error
+
+// BatchHandler returns a Lambda handler that calls recordHandler for each
+// message in the batch and returns the failed messages in the
+// BatchResponse. Messages from a FIFO queue are processed in order, so once
+// a message fails, the remaining messages are reported as failures without
+// being processed.
+func BatchHandler(recordHandler RecordHandler) func(context.Context, Event) (BatchResponse, error) {
+	return func(ctx context.Context, event Event) (BatchResponse, error) {
+		response := BatchResponse{
+			BatchItemFailures: make([]BatchItemFailure, 0),
+		}
+		fifoFailed := false
+		for index := range event.Records {
+			eachRecord := &event.Records[index]
+			if !fifoFailed {
+				handlerErr := recordHandler(ctx, eachRecord)
+				if nil == handlerErr {
+					continue
+				}
+				fifoFailed = strings.HasSuffix(eachRecord.EventSourceARN, ".fifo")
+			}
+			response.BatchItemFailures = append(response.BatchItemFailures,
+				BatchItemFailure{ItemIdentifier: eachRecord.MessageID})
+		}
+		return response, nil
+	}
+}
@@ -0,0 +1,57 @@
+package sqs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func testBatchResponse(t *testing.T, queueArn string, failedIDs ...string) BatchResponse {
+	event := Event{}
+	for _, eachID := range []string{"1", "2", "3"} {
+		event.Records = append(event.Records, EventRecord{
+			MessageID:      eachID,
+			Body:           "message " + eachID,
+			EventSource:    "aws:sqs",
+			EventSourceARN: queueArn,
+		})
+	}
+	failed := make(map[string]bool)
+	for _, eachID := range failedIDs {
+		failed[eachID] = true
+	}
+	handler := BatchHandler(func(ctx context.Context, record *EventRecord) error {
+		if failed[record.MessageID] {
+			return errors.New("failed: " + record.Body)
+		}
+		return nil
+	})
+	response, responseErr := handler(context.Background(), event)
+	if nil != responseErr {
+		t.Fatal(responseErr)
+	}
+	return response
+}
+
+func TestBatchHandler(t *testing.T) {
+	response := testBatchResponse(t, "arn:aws:sqs:us-east-1:123456789012:orders")
+	responseJSON, _ := json.Marshal(response)
+	if `{"batchItemFailures":[]}` != string(responseJSON) {
+		t.Errorf("Expected an empty batch response: %s", string(responseJSON))
+	}
+
+	response = testBatchResponse(t, "arn:aws:sqs:us-east-1:123456789012:orders", "2")
+	if len(response.BatchItemFailures) != 1 ||
+		"2" != response.BatchItemFailures[0].ItemIdentifier {
+		t.Errorf("Expected a single failed message: %#v", response.BatchItemFailures)
+	}
+
+	// FIFO messages after the failure aren't processed
+	response = testBatchResponse(t, "arn:aws:sqs:us-east-1:123456789012:orders.fifo", "2")
+	if len(response.BatchItemFailures) != 2 ||
+		"2" != response.BatchItemFailures[0].ItemIdentifier ||
+		"3" != response.BatchItemFailures[1].ItemIdentifier {
+		t.Errorf("Expected the remaining FIFO messages to fail: %#v", response.BatchItemFailures)
+	}
+}
@@ -1407,12 +1407,16 @@ func (sm *StateMachine) StateMachineDecorator() sparta.ServiceDecoratorHookFunc
 				strings.Join(errorText, ", "))
 		}
 
+		// The function ARN is the alias ARN iff the function has
+		// an alias
 		lambdaFunctionResourceNames := []string{}
+		lambdaFunctionArns := make(map[string]*gocf.StringExpr)
 		for _, eachState := range sm.uniqueStates {
 			taskState, taskStateOk := eachState.(*TaskState)
 			if taskStateOk {
 				lambdaFunctionResourceNames = append(lambdaFunctionResourceNames,
 					taskState.lambdaLogicalResourceName)
+				lambdaFunctionArns[taskState.lambdaLogicalResourceName] = taskState.lambdaFn.FunctionARN()
 			}
 		}
 
@@ -1445,7 +1449,7 @@ func (sm *StateMachine) StateMachineDecorator() sparta.ServiceDecoratorHookFunc
 						Action: []string{
 							"lambda:InvokeFunction",
 						},
-						Resource: gocf.GetAtt(eachLambdaName, "Arn").String(),
+						Resource: lambdaFunctionArns[eachLambdaName],
 					},
 				)
 			}
@@ -1475,15 +1479,19 @@ func (sm *StateMachine) StateMachineDecorator() sparta.ServiceDecoratorHookFunc
 
 		// Great, so we've serialized the "Resource", but we actually
 		// need to replace each lambda "Resource" definition with a
-		// properly quoted Fn::GetAtt. Not sure how to make this as part of
-		// the MarshalJSON, since it's invalid JSON :(
+		// properly quoted Fn::GetAtt or alias Ref. Not sure how to make this
+		// as part of the MarshalJSON, since it's invalid JSON :(
 		stateMachineString := string(jsonBytes)
 		for _, eachLambdaResourceName := range lambdaFunctionResourceNames {
 			// Look for the reserved pattern that was exported in MarshalJSON
 			reReplace := regexp.MustCompile(fmt.Sprintf(`"\{\{%s\}\}"`, eachLambdaResourceName))
-			// Create the replacement text that quotes the GetAtt call
-			replaceText := fmt.Sprintf(`"{"Fn::GetAtt": ["%s","Arn"]}"`, eachLambdaResourceName)
-			stateMachineString = reReplace.ReplaceAllString(stateMachineString, replaceText)
+			// Create the replacement text that quotes the ARN expression
+			arnJSON, arnJSONErr := json.Marshal(lambdaFunctionArns[eachLambdaResourceName])
+			if arnJSONErr != nil {
+				return errors.Errorf("Failed to marshal function ARN: %s", arnJSONErr.Error())
+			}
+			replaceText := fmt.Sprintf(`"%s"`, string(arnJSON))
+			stateMachineString = reReplace.ReplaceAllLiteralString(stateMachineString, replaceText)
 		}
 
 		// Super, now parse this into an Fn::Join representation
@@ -0,0 +1,256 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// envVarConfigFile is the path to the project configuration file
+	envVarConfigFile = "SPARTA_CONFIG"
+	// envVarConfigProfile is the name of the project configuration profile
+	// to apply
+	envVarConfigProfile = "SPARTA_CONFIG_PROFILE"
+	// envVarS3Bucket is the default S3 bucket for provision, plan,
+	// describe, and profile
+	envVarS3Bucket = "SPARTA_S3_BUCKET"
+	// envVarRegion is the AWS region to use
+	envVarRegion = "SPARTA_REGION"
+	// envVarConfigStackName is the CloudFormation stack name to use in
+	// place of the service name. It's distinct from SPARTA_STACK_NAME,
+	// which is published into the function environment.
+	envVarConfigStackName = "SPARTA_CONFIG_STACK_NAME"
+	// envVarBuildTags is the default set of build tags
+	envVarBuildTags = "SPARTA_BUILD_TAGS"
+	// envVarLinkerFlags is the default set of linker flags
+	envVarLinkerFlags = "SPARTA_LDFLAGS"
+	// envVarLogFormat is the default log format
+	envVarLogFormat = "SPARTA_LOG_FORMAT"
+)
+
+// projectConfigFileNames are the files, in order, that are searched for
+// in the working directory if there is no explicit configuration path
+var projectConfigFileNames = []string{
+	"sparta.yaml",
+	"sparta.yml",
+	"sparta.json",
+}
+
+// projectConfigValues are the command line defaults that can be
+// defined in a project configuration file. Empty values are ignored.
+type projectConfigValues struct {
+	// S3Bucket is the default for provision, plan, describe, and profile
+	S3Bucket string `json:"s3Bucket,omitempty" yaml:"s3Bucket,omitempty"`
+	// Region is the AWS region for all AWS API calls
+	Region string `json:"region,omitempty" yaml:"region,omitempty"`
+	// StackName is the CloudFormation stack name to use in place of the
+	// service name supplied to MainEx
+	StackName string `json:"stackName,omitempty" yaml:"stackName,omitempty"`
+	// Stage is the deployment stage (eg, dev, prod)
+	Stage string `json:"stage,omitempty" yaml:"stage,omitempty"`
+	// BuildTags are the build tags used when compiling the binary
+	BuildTags string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// LinkerFlags are the linker flags used when compiling the binary
+	LinkerFlags string `json:"ldflags,omitempty" yaml:"ldflags,omitempty"`
+	// LogLevel is the log level [panic, fatal, error, warn, info, debug]
+	LogLevel string `json:"level,omitempty" yaml:"level,omitempty"`
+	// LogFormat is the log format [text, json]
+	LogFormat string `json:"format,omitempty" yaml:"format,omitempty"`
+	// InPlace enables in-place function updates for provision
+	InPlace bool `json:"inplace,omitempty" yaml:"inplace,omitempty"`
+	// DescribeOutputFile is the HTML output path for describe
+	DescribeOutputFile string `json:"describeOut,omitempty" yaml:"describeOut,omitempty"`
+	// ProfilePort is the pprof web UI port for profile
+	ProfilePort int `json:"profilePort,omitempty" yaml:"profilePort,omitempty"`
+	// Endpoints are the AWS service endpoint URLs, keyed by the service's
+	// endpoint ID (eg, cloudformation, s3, lambda, iam, sts)
+	Endpoints map[string]string `json:"endpoints,omitempty" yaml:"endpoints,omitempty"`
+	// S3ForcePathStyle enables path style S3 addressing
+	S3ForcePathStyle bool `json:"s3ForcePathStyle,omitempty" yaml:"s3ForcePathStyle,omitempty"`
+}
+
+// merge overwrites the receiver's values with the non-empty
+// values in other
+func (values *projectConfigValues) merge(other *projectConfigValues) {
+	if nil == other {
+		return
+	}
+	mergeString := func(target *string, value string) {
+		if "" != value {
+			*target = value
+		}
+	}
+	mergeString(&values.S3Bucket, other.S3Bucket)
+	mergeString(&values.Region, other.Region)
+	mergeString(&values.StackName, other.StackName)
+	mergeString(&values.Stage, other.Stage)
+	mergeString(&values.BuildTags, other.BuildTags)
+	mergeString(&values.LinkerFlags, other.LinkerFlags)
+	mergeString(&values.LogLevel, other.LogLevel)
+	mergeString(&values.LogFormat, other.LogFormat)
+	mergeString(&values.DescribeOutputFile, other.DescribeOutputFile)
+	if other.InPlace {
+		values.InPlace = true
+	}
+	if 0 != other.ProfilePort {
+		values.ProfilePort = other.ProfilePort
+	}
+	for eachService, eachURL := range other.Endpoints {
+		if nil == values.Endpoints {
+			values.Endpoints = make(map[string]string)
+		}
+		values.Endpoints[eachService] = eachURL
+	}
+	if other.S3ForcePathStyle {
+		values.S3ForcePathStyle = true
+	}
+}
+
+// projectConfig is the optional sparta.yaml/sparta.json project
+// configuration. The top level values apply to every invocation. The
+// Profiles values, selected by --configProfile or SPARTA_CONFIG_PROFILE,
+// override the top level values. Command line flags take precedence
+// over both.
+type projectConfig struct {
+	projectConfigValues `yaml:",inline"`
+	Profiles            map[string]*projectConfigValues `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+}
+
+// loadProjectConfig returns the project configuration at configPath. If
+// configPath is empty, the working directory is searched for one of the
+// projectConfigFileNames. The returned path is empty if no configuration
+// file was found.
+func loadProjectConfig(configPath string) (*projectConfig, string, error) {
+	if "" == configPath {
+		configPath = os.Getenv(envVarConfigFile)
+	}
+	if "" == configPath {
+		for _, eachName := range projectConfigFileNames {
+			if _, statErr := os.Stat(eachName); nil == statErr {
+				configPath = eachName
+				break
+			}
+		}
+	}
+	config := &projectConfig{}
+	if "" == configPath {
+		return config, "", nil
+	}
+	configData, configDataErr := ioutil.ReadFile(configPath)
+	if nil != configDataErr {
+		return nil, "", errors.Wrapf(configDataErr, "Failed to read project configuration")
+	}
+	var unmarshalErr error
+	switch strings.ToLower(filepath.Ext(configPath)) {
+	case ".json":
+		unmarshalErr = json.Unmarshal(configData, config)
+	case ".yaml", ".yml":
+		unmarshalErr = yaml.UnmarshalStrict(configData, config)
+	default:
+		unmarshalErr = errors.Errorf("Unsupported file extension. Expected one of: %s",
+			strings.Join(projectConfigFileNames, ", "))
+	}
+	if nil != unmarshalErr {
+		return nil, "", errors.Wrapf(unmarshalErr, "Failed to parse project configuration: %s", configPath)
+	}
+	return config, configPath, nil
+}
+
+// resolve returns the values for the named profile. The precedence, from
+// lowest to highest, is the top level values, the profile values, and
+// then any SPARTA_* environment variables.
+func (config *projectConfig) resolve(profileName string) (*projectConfigValues, error) {
+	resolved := &projectConfigValues{}
+	resolved.merge(&config.projectConfigValues)
+	if "" != profileName {
+		profileValues, exists := config.Profiles[profileName]
+		if !exists {
+			knownProfiles := make([]string, 0)
+			for eachName := range config.Profiles {
+				knownProfiles = append(knownProfiles, eachName)
+			}
+			return nil, errors.Errorf("Unknown configuration profile: %s. Known: %s",
+				profileName,
+				strings.Join(knownProfiles, ", "))
+		}
+		resolved.merge(profileValues)
+	}
+	resolved.merge(&projectConfigValues{
+		S3Bucket:    os.Getenv(envVarS3Bucket),
+		Region:      os.Getenv(envVarRegion),
+		StackName:   os.Getenv(envVarConfigStackName),
+		Stage:       os.Getenv(envVarStage),
+		BuildTags:   os.Getenv(envVarBuildTags),
+		LinkerFlags: os.Getenv(envVarLinkerFlags),
+		LogFormat:   os.Getenv(envVarLogFormat),
+	})
+	return resolved, nil
+}
+
+// applyProjectConfig assigns the resolved values to the command's flags
+// that weren't explicitly set on the command line. Flags that the
+// command doesn't define are ignored. The AWS region is applied to the
+// global --region flag.
+func applyProjectConfig(cmd *cobra.Command, values *projectConfigValues) error {
+	flagValues := map[string]string{
+		"s3Bucket": values.S3Bucket,
+		"region":   values.Region,
+		"stage":    values.Stage,
+		"tags":     values.BuildTags,
+		"ldflags":  values.LinkerFlags,
+		"level":    values.LogLevel,
+		"format":   values.LogFormat,
+	}
+	if values.InPlace {
+		flagValues["inplace"] = "true"
+	}
+	if cmd.Name() == "describe" {
+		flagValues["out"] = values.DescribeOutputFile
+	}
+	if cmd.Name() == "profile" && 0 != values.ProfilePort {
+		flagValues["port"] = strconv.Itoa(values.ProfilePort)
+	}
+	for eachName, eachValue := range flagValues {
+		flag := cmd.Flags().Lookup(eachName)
+		if nil == flag || flag.Changed || "" == eachValue {
+			continue
+		}
+		setErr := flag.Value.Set(eachValue)
+		if nil != setErr {
+			return errors.Wrapf(setErr, "Invalid project configuration value for %s", eachName)
+		}
+	}
+	return nil
+}
+
+// projectConfigDefaults loads the project configuration, resolves the
+// profile, and applies the values to the command. It returns the
+// resolved values and the path to the configuration file, if any.
+func projectConfigDefaults(cmd *cobra.Command) (*projectConfigValues, string, error) {
+	config, configPath, configErr := loadProjectConfig(OptionsGlobal.ConfigFile)
+	if nil != configErr {
+		return nil, "", configErr
+	}
+	if "" == OptionsGlobal.ConfigProfile {
+		OptionsGlobal.ConfigProfile = os.Getenv(envVarConfigProfile)
+	}
+	values, valuesErr := config.resolve(OptionsGlobal.ConfigProfile)
+	if nil != valuesErr {
+		return nil, "", valuesErr
+	}
+	applyErr := applyProjectConfig(cmd, values)
+	if nil != applyErr {
+		return nil, "", applyErr
+	}
+	return values, configPath, nil
+}
@@ -0,0 +1,160 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+const testProjectConfigYAML = `
+s3Bucket: default-bucket
+tags: shared
+endpoints:
+  cloudformation: http://localhost:4581
+profiles:
+  dev:
+    s3Bucket: dev-bucket
+    stackName: MyService-dev
+    s3ForcePathStyle: true
+    endpoints:
+      s3: http://localhost:4572
+  prod:
+    s3Bucket: prod-bucket
+    region: us-west-2
+    stackName: MyService-prod
+`
+
+const testProjectConfigJSON = `{
+	"s3Bucket": "default-bucket",
+	"profiles": {
+		"dev": {
+			"s3Bucket": "dev-bucket"
+		}
+	}
+}`
+
+func writeTestProjectConfig(t *testing.T, fileName string, contents string) string {
+	tempDir, tempDirErr := ioutil.TempDir("", "sparta-config")
+	if nil != tempDirErr {
+		t.Fatal(tempDirErr)
+	}
+	configPath := filepath.Join(tempDir, fileName)
+	writeErr := ioutil.WriteFile(configPath, []byte(contents), os.ModePerm)
+	if nil != writeErr {
+		t.Fatal(writeErr)
+	}
+	return configPath
+}
+
+func TestProjectConfigProfiles(t *testing.T) {
+	yamlPath := writeTestProjectConfig(t, "sparta.yaml", testProjectConfigYAML)
+	defer os.RemoveAll(filepath.Dir(yamlPath))
+	jsonPath := writeTestProjectConfig(t, "sparta.json", testProjectConfigJSON)
+	defer os.RemoveAll(filepath.Dir(jsonPath))
+
+	testCases := []struct {
+		configPath string
+		profile    string
+		s3Bucket   string
+		stackName  string
+	}{
+		{yamlPath, "", "default-bucket", ""},
+		{yamlPath, "dev", "dev-bucket", "MyService-dev"},
+		{yamlPath, "prod", "prod-bucket", "MyService-prod"},
+		{jsonPath, "dev", "dev-bucket", ""},
+	}
+	for _, eachTestCase := range testCases {
+		config, _, configErr := loadProjectConfig(eachTestCase.configPath)
+		if nil != configErr {
+			t.Fatalf("Failed to load %s: %s", eachTestCase.configPath, configErr)
+		}
+		values, valuesErr := config.resolve(eachTestCase.profile)
+		if nil != valuesErr {
+			t.Fatalf("Failed to resolve profile %s: %s", eachTestCase.profile, valuesErr)
+		}
+		if values.S3Bucket != eachTestCase.s3Bucket {
+			t.Errorf("Expected bucket %s for profile %#v, got %s",
+				eachTestCase.s3Bucket,
+				eachTestCase.profile,
+				values.S3Bucket)
+		}
+		if values.StackName != eachTestCase.stackName {
+			t.Errorf("Expected stack name %s for profile %#v, got %s",
+				eachTestCase.stackName,
+				eachTestCase.profile,
+				values.StackName)
+		}
+	}
+	config, _, _ := loadProjectConfig(yamlPath)
+	devValues, _ := config.resolve("dev")
+	if len(devValues.Endpoints) != 2 ||
+		"http://localhost:4572" != devValues.Endpoints["s3"] ||
+		!devValues.S3ForcePathStyle {
+		t.Errorf("Expected profile endpoints to be merged, got %#v", devValues.Endpoints)
+	}
+	_, unknownErr := config.resolve("staging")
+	if nil == unknownErr {
+		t.Fatalf("Expected error for unknown profile")
+	}
+}
+
+func TestProjectConfigPrecedence(t *testing.T) {
+	os.Setenv(envVarS3Bucket, "env-bucket")
+	defer os.Unsetenv(envVarS3Bucket)
+
+	config := &projectConfig{}
+	config.BuildTags = "configTags"
+	config.LinkerFlags = "configFlags"
+	values, valuesErr := config.resolve("")
+	if nil != valuesErr {
+		t.Fatal(valuesErr)
+	}
+	if values.S3Bucket != "env-bucket" {
+		t.Fatalf("Expected environment variable to override configuration, got %s", values.S3Bucket)
+	}
+	// SPARTA_STACK_NAME is the function runtime value and doesn't override
+	// the configuration
+	config.StackName = "config-stack"
+	os.Setenv(envVarStackName, "runtime-stack")
+	defer os.Unsetenv(envVarStackName)
+	values, _ = config.resolve("")
+	if values.StackName != "config-stack" {
+		t.Errorf("Expected SPARTA_STACK_NAME to be ignored, got %s", values.StackName)
+	}
+	os.Setenv(envVarConfigStackName, "env-stack")
+	defer os.Unsetenv(envVarConfigStackName)
+	values, _ = config.resolve("")
+	if values.StackName != "env-stack" {
+		t.Errorf("Expected SPARTA_CONFIG_STACK_NAME to override configuration, got %s", values.StackName)
+	}
+
+	var s3Bucket, buildTags, linkerFlags string
+	cmd := &cobra.Command{
+		Use: "provision",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&s3Bucket, "s3Bucket", "", "")
+	cmd.Flags().StringVar(&buildTags, "tags", "", "")
+	cmd.Flags().StringVar(&linkerFlags, "ldflags", "", "")
+	parseErr := cmd.ParseFlags([]string{"--tags", "flagTags"})
+	if nil != parseErr {
+		t.Fatal(parseErr)
+	}
+	applyErr := applyProjectConfig(cmd, values)
+	if nil != applyErr {
+		t.Fatal(applyErr)
+	}
+	if s3Bucket != "env-bucket" || linkerFlags != "configFlags" {
+		t.Errorf("Expected unset flags to use configuration values. Got: %s, %s", s3Bucket, linkerFlags)
+	}
+	if buildTags != "flagTags" {
+		t.Errorf("Expected command line flag to take precedence, got %s", buildTags)
+	}
+}
@@ -14,6 +14,10 @@ const (
 	// pointer in the request
 	// DEPRECATED
 	ContextKeyLambdaContext
+	// ContextKeyStage is the string deployment stage (eg, dev, prod)
+	// the function was provisioned with. The value is empty if
+	// the service was provisioned without a stage.
+	ContextKeyStage
 )
 
 const (
@@ -6,14 +6,24 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
 	spartaAWS "github.com/mweagle/Sparta/aws"
 )
 
 // Delete the provided serviceName.  Failing to delete a non-existent
-// service is not considered an error.  Note that the delete does
+// service is not considered an error.  A stack with termination protection
+// enabled is not deleted. Use DeleteEx to override the protection.
 func Delete(serviceName string, logger *logrus.Logger) error {
+	return DeleteEx(serviceName, false, logger)
+}
+
+// DeleteEx deletes the provided serviceName. If the stack has termination
+// protection enabled, it's only deleted if overrideProtection is true,
+// in which case the protection is disabled first. A stack whose exports are
+// imported by other stacks isn't deleted, and its protection is unchanged.
+func DeleteEx(serviceName string, overrideProtection bool, logger *logrus.Logger) error {
 	session := spartaAWS.NewSession(logger)
 	awsCloudFormation := cloudformation.New(session)
 
@@ -27,7 +37,42 @@ func Delete(serviceName string, logger *logrus.Logger) error {
 	}).Info("Stack existence check")
 
 	if exists {
-
+		// CloudFormation won't delete a stack whose exports are imported,
+		// so check before the termination protection is changed
+		exportImports, exportImportsErr := spartaCF.StackExportImports(serviceName, session)
+		if nil != exportImportsErr {
+			logger.WithFields(logrus.Fields{
+				"Error": exportImportsErr,
+			}).Warn("Failed to determine if stack exports are imported")
+		}
+		if len(exportImports) != 0 {
+			for eachExport, eachImportingStacks := range exportImports {
+				logger.WithFields(logrus.Fields{
+					"Export":          eachExport,
+					"ImportingStacks": eachImportingStacks,
+				}).Error("Stack export is still imported by other stacks")
+			}
+			return errors.Errorf("Stack %s can't be deleted while %d of its exports are imported by other stacks",
+				serviceName,
+				len(exportImports))
+		}
+		protected, protectedErr := spartaCF.StackTerminationProtection(serviceName, session)
+		if nil != protectedErr {
+			return protectedErr
+		}
+		if protected {
+			if !overrideProtection {
+				return errors.Errorf("Stack %s has termination protection enabled. Use --overrideProtection to delete it",
+					serviceName)
+			}
+			updateErr := spartaCF.UpdateTerminationProtection(serviceName,
+				false,
+				session,
+				logger)
+			if nil != updateErr {
+				return updateErr
+			}
+		}
 		params := &cloudformation.DeleteStackInput{
 			StackName: aws.String(serviceName),
 		}
@@ -37,6 +82,18 @@ func Delete(serviceName string, logger *logrus.Logger) error {
 				"Response": resp,
 			}).Info("Delete request submitted")
 		}
+		// Restore the protection if the stack wasn't deleted
+		if nil != err && protected {
+			updateErr := spartaCF.UpdateTerminationProtection(serviceName,
+				true,
+				session,
+				logger)
+			if nil != updateErr {
+				logger.WithFields(logrus.Fields{
+					"Error": updateErr,
+				}).Error("Failed to re-enable stack termination protection")
+			}
+		}
 		return err
 	}
 	logger.Info("Stack does not exist")
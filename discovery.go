@@ -48,6 +48,8 @@ type DiscoveryInfo struct {
 	StackID string
 	// StackName (eg, Sparta service name)
 	StackName string
+	// Stage is the optional deployment stage (eg, dev, prod)
+	Stage string
 	// Map of resources this Go function has explicit `DependsOn` relationship
 	Resources map[string]DiscoveryResource
 }
@@ -95,6 +97,8 @@ func initializeDiscovery(logger *logrus.Logger) {
 			}
 			decodedErr = unmarshalErr
 		}
+		// The stage is published as a separate environment variable
+		cachedDiscoveryInfo.Stage = os.Getenv(envVarStage)
 		return cachedDiscoveryInfo, decodedErr
 	}
 }
@@ -0,0 +1,415 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// propertyDrift is a single property whose deployed value differs
+// from the template value
+type propertyDrift struct {
+	PropertyPath   string `json:"propertyPath"`
+	ExpectedValue  string `json:"expectedValue"`
+	ActualValue    string `json:"actualValue"`
+	DifferenceType string `json:"differenceType"`
+}
+
+// resourceDrift is a stack resource that was modified or deleted
+// outside of CloudFormation
+type resourceDrift struct {
+	LogicalResourceName string           `json:"logicalResourceName"`
+	ResourceType        string           `json:"resourceType"`
+	PhysicalResourceID  string           `json:"physicalResourceId,omitempty"`
+	StackID             string           `json:"stackId,omitempty"`
+	Status              string           `json:"status"`
+	Functions           []string         `json:"functions,omitempty"`
+	Differences         []*propertyDrift `json:"differences,omitempty"`
+}
+
+// serviceDrift is the drift detection result for the service stack
+type serviceDrift struct {
+	StackName             string           `json:"stackName"`
+	StackDriftStatus      string           `json:"stackDriftStatus"`
+	DetectionStatus       string           `json:"detectionStatus"`
+	DetectionStatusReason string           `json:"detectionStatusReason,omitempty"`
+	Resources             []*resourceDrift `json:"resources"`
+}
+
+// templateResourceRefs returns the logical resource names that the
+// template value references via Ref, Fn::GetAtt or DependsOn
+func templateResourceRefs(value interface{}, refs map[string]bool) {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		for eachKey, eachValue := range typedValue {
+			switch eachKey {
+			case "Ref":
+				if refName, isString := eachValue.(string); isString {
+					refs[refName] = true
+				}
+			case "Fn::GetAtt":
+				switch attrValue := eachValue.(type) {
+				case []interface{}:
+					if len(attrValue) != 0 {
+						if refName, isString := attrValue[0].(string); isString {
+							refs[refName] = true
+						}
+					}
+				case string:
+					refs[strings.Split(attrValue, ".")[0]] = true
+				}
+			case "DependsOn":
+				switch dependsValue := eachValue.(type) {
+				case string:
+					refs[dependsValue] = true
+				case []interface{}:
+					for _, eachDependency := range dependsValue {
+						if refName, isString := eachDependency.(string); isString {
+							refs[refName] = true
+						}
+					}
+				}
+			default:
+				templateResourceRefs(eachValue, refs)
+			}
+		}
+	case []interface{}:
+		for _, eachValue := range typedValue {
+			templateResourceRefs(eachValue, refs)
+		}
+	}
+}
+
+// nestedStackParameterRefs returns the parent template resources that
+// each nested stack parameter value references, keyed by the nested stack
+// logical resource name and then the parameter name
+func nestedStackParameterRefs(templateBody string) (map[string]map[string]map[string]bool, error) {
+	var template struct {
+		Resources map[string]struct {
+			Type       string
+			Properties struct {
+				Parameters map[string]interface{}
+			}
+		}
+	}
+	unmarshalErr := json.Unmarshal([]byte(templateBody), &template)
+	if nil != unmarshalErr {
+		return nil, errors.Wrapf(unmarshalErr, "Failed to parse stack template")
+	}
+	stackParameterRefs := make(map[string]map[string]map[string]bool)
+	for eachResourceName, eachResource := range template.Resources {
+		if "AWS::CloudFormation::Stack" != eachResource.Type {
+			continue
+		}
+		parameterRefs := make(map[string]map[string]bool)
+		for eachParameterName, eachValue := range eachResource.Properties.Parameters {
+			refs := make(map[string]bool)
+			templateResourceRefs(eachValue, refs)
+			parameterRefs[eachParameterName] = refs
+		}
+		stackParameterRefs[eachResourceName] = parameterRefs
+	}
+	return stackParameterRefs, nil
+}
+
+// templateResourceFunctions maps each template resource to the names of
+// the Sparta functions that own it. A resource that references a function,
+// such as an event source mapping or a decorator resource, is owned by that
+// function. A resource that is only referenced by functions, such as an
+// IAM role, is owned by each of them. The optional parameterRefs are the
+// parent template resources that the parameters of a nested stack template
+// reference, so that a nested resource that references a function through
+// a parameter is owned by that function.
+func templateResourceFunctions(templateBody string,
+	parameterRefs map[string]map[string]bool,
+	lambdaAWSInfos []*LambdaAWSInfo) (map[string][]string, error) {
+
+	var template struct {
+		Resources map[string]interface{}
+	}
+	unmarshalErr := json.Unmarshal([]byte(templateBody), &template)
+	if nil != unmarshalErr {
+		return nil, errors.Wrapf(unmarshalErr, "Failed to parse stack template")
+	}
+	functionNames := make(map[string]string)
+	for _, eachLambdaInfo := range lambdaAWSInfos {
+		functionNames[eachLambdaInfo.LogicalResourceName()] = eachLambdaInfo.lambdaFunctionName()
+		for _, eachCustomResource := range eachLambdaInfo.customResources {
+			functionNames[eachCustomResource.logicalName()] = eachCustomResource.userFunctionName
+		}
+	}
+	resourceRefs := make(map[string]map[string]bool)
+	for eachResourceName, eachResource := range template.Resources {
+		refs := make(map[string]bool)
+		templateResourceRefs(eachResource, refs)
+		for eachParameterName, eachParentRefs := range parameterRefs {
+			if !refs[eachParameterName] {
+				continue
+			}
+			for eachParentRef := range eachParentRefs {
+				refs[eachParentRef] = true
+			}
+		}
+		resourceRefs[eachResourceName] = refs
+	}
+
+	owners := make(map[string]map[string]bool)
+	addOwner := func(resourceName string, functionName string) {
+		if _, exists := owners[resourceName]; !exists {
+			owners[resourceName] = make(map[string]bool)
+		}
+		owners[resourceName][functionName] = true
+	}
+	for eachResourceName, eachRefs := range resourceRefs {
+		if functionName, isFunction := functionNames[eachResourceName]; isFunction {
+			addOwner(eachResourceName, functionName)
+			continue
+		}
+		for eachRef := range eachRefs {
+			if functionName, isFunction := functionNames[eachRef]; isFunction {
+				addOwner(eachResourceName, functionName)
+			}
+		}
+	}
+	// Resources that don't reference a function are owned by the
+	// functions that reference them
+	referencedBy := make(map[string]map[string]bool)
+	for eachResourceName, eachRefs := range resourceRefs {
+		functionName, isFunction := functionNames[eachResourceName]
+		if !isFunction {
+			continue
+		}
+		for eachRef := range eachRefs {
+			if _, exists := referencedBy[eachRef]; !exists {
+				referencedBy[eachRef] = make(map[string]bool)
+			}
+			referencedBy[eachRef][functionName] = true
+		}
+	}
+	for eachResourceName, eachFunctionNames := range referencedBy {
+		_, isOwned := owners[eachResourceName]
+		_, isResource := template.Resources[eachResourceName]
+		if isOwned || !isResource {
+			continue
+		}
+		for eachFunctionName := range eachFunctionNames {
+			addOwner(eachResourceName, eachFunctionName)
+		}
+	}
+
+	resourceFunctions := make(map[string][]string)
+	for eachResourceName, eachOwners := range owners {
+		names := make([]string, 0)
+		for eachName := range eachOwners {
+			names = append(names, eachName)
+		}
+		sort.Strings(names)
+		resourceFunctions[eachResourceName] = names
+	}
+	return resourceFunctions, nil
+}
+
+// mergeStackDriftResults combines the drift results for the service stack
+// and its nested stacks. The service is drifted if any stack is drifted,
+// and the detection failed if it failed for any stack.
+func mergeStackDriftResults(results []*spartaCF.StackDriftResult) *spartaCF.StackDriftResult {
+	merged := &spartaCF.StackDriftResult{
+		StackDriftStatus: spartaCF.StackDriftStatusInSync,
+		DetectionStatus:  spartaCF.StackDriftDetectionStatusComplete,
+		ResourceDrifts:   make([]*spartaCF.StackResourceDrift, 0),
+	}
+	reasons := make([]string, 0)
+	for eachIndex, eachResult := range results {
+		if 0 == eachIndex || spartaCF.StackDriftStatusDrifted == eachResult.StackDriftStatus {
+			merged.StackDriftStatus = eachResult.StackDriftStatus
+		}
+		if 0 == eachIndex || spartaCF.StackDriftDetectionStatusFailed == eachResult.DetectionStatus {
+			merged.DetectionStatus = eachResult.DetectionStatus
+		}
+		if "" != eachResult.DetectionStatusReason {
+			reasons = append(reasons, eachResult.DetectionStatusReason)
+		}
+		merged.ResourceDrifts = append(merged.ResourceDrifts, eachResult.ResourceDrifts...)
+	}
+	merged.DetectionStatusReason = strings.Join(reasons, "; ")
+	return merged
+}
+
+// newServiceDrift annotates the drift detection result with the
+// owning Sparta functions
+func newServiceDrift(stackName string,
+	result *spartaCF.StackDriftResult,
+	resourceFunctions map[string][]string) *serviceDrift {
+	drift := &serviceDrift{
+		StackName:             stackName,
+		StackDriftStatus:      result.StackDriftStatus,
+		DetectionStatus:       result.DetectionStatus,
+		DetectionStatusReason: result.DetectionStatusReason,
+		Resources:             make([]*resourceDrift, 0),
+	}
+	for _, eachDrift := range result.ResourceDrifts {
+		logicalName := aws.StringValue(eachDrift.LogicalResourceID)
+		resource := &resourceDrift{
+			LogicalResourceName: logicalName,
+			ResourceType:        aws.StringValue(eachDrift.ResourceType),
+			PhysicalResourceID:  aws.StringValue(eachDrift.PhysicalResourceID),
+			StackID:             aws.StringValue(eachDrift.StackID),
+			Status:              aws.StringValue(eachDrift.StackResourceDriftStatus),
+			Functions:           resourceFunctions[logicalName],
+		}
+		for _, eachDifference := range eachDrift.PropertyDifferences {
+			resource.Differences = append(resource.Differences, &propertyDrift{
+				PropertyPath:   aws.StringValue(eachDifference.PropertyPath),
+				ExpectedValue:  aws.StringValue(eachDifference.ExpectedValue),
+				ActualValue:    aws.StringValue(eachDifference.ActualValue),
+				DifferenceType: aws.StringValue(eachDifference.DifferenceType),
+			})
+		}
+		drift.Resources = append(drift.Resources, resource)
+	}
+	sort.Slice(drift.Resources, func(i, j int) bool {
+		return drift.Resources[i].LogicalResourceName < drift.Resources[j].LogicalResourceName
+	})
+	return drift
+}
+
+// logServiceDrift outputs the drift result using the logger
+func logServiceDrift(drift *serviceDrift, logger *logrus.Logger) {
+	logger.Info(headerDivider)
+	logger.WithFields(logrus.Fields{
+		"StackName":       drift.StackName,
+		"DriftStatus":     drift.StackDriftStatus,
+		"DetectionStatus": drift.DetectionStatus,
+		"DriftedCount":    len(drift.Resources),
+	}).Info("Stack drift")
+	if "" != drift.DetectionStatusReason {
+		logger.WithFields(logrus.Fields{
+			"Reason": drift.DetectionStatusReason,
+		}).Warn("Drift detection was incomplete")
+	}
+	for _, eachResource := range drift.Resources {
+		logger.Info(subheaderDivider)
+		logger.WithFields(logrus.Fields{
+			"Type":         eachResource.ResourceType,
+			"PhysicalName": eachResource.PhysicalResourceID,
+			"StackId":      eachResource.StackID,
+			"Status":       eachResource.Status,
+			"Function":     strings.Join(eachResource.Functions, ", "),
+		}).Warn(eachResource.LogicalResourceName)
+		for _, eachDifference := range eachResource.Differences {
+			logger.WithFields(logrus.Fields{
+				"Expected":   eachDifference.ExpectedValue,
+				"Actual":     eachDifference.ActualValue,
+				"Difference": eachDifference.DifferenceType,
+			}).Warn(eachDifference.PropertyPath)
+		}
+	}
+	logger.Info(headerDivider)
+}
+
+// Drift runs CloudFormation drift detection on the service stack and its
+// nested stacks, and reports each resource that was modified or deleted
+// outside of CloudFormation, together with the expected and actual property
+// values. Drifted resources are mapped back to the Sparta function that owns
+// them when possible. The outputFormat is either StatusFormatText or
+// StatusFormatJSON, and is validated before any AWS calls are made.
+func Drift(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	outputFormat string,
+	outputWriter io.Writer,
+	logger *logrus.Logger) error {
+
+	switch outputFormat {
+	case StatusFormatJSON, StatusFormatText, "":
+	default:
+		return fmt.Errorf("Unsupported drift format: %s", outputFormat)
+	}
+	awsSession := spartaAWS.NewSession(logger)
+	exists, existsErr := spartaCF.StackExists(serviceName, awsSession, logger)
+	if nil != existsErr {
+		return existsErr
+	}
+	if !exists {
+		return errors.Errorf("Stack %s does not exist", serviceName)
+	}
+	// Drift detection doesn't include the resources of nested stacks, so
+	// each nested stack is checked as well
+	stackNames := []string{serviceName}
+	stackLogicalNames := make(map[string]string)
+	stackResources, stackResourcesErr := spartaCF.ListStackResources(serviceName, awsSession)
+	if nil != stackResourcesErr {
+		return stackResourcesErr
+	}
+	for _, eachSummary := range stackResources {
+		if "AWS::CloudFormation::Stack" == aws.StringValue(eachSummary.ResourceType) &&
+			"" != aws.StringValue(eachSummary.PhysicalResourceId) {
+			stackName := aws.StringValue(eachSummary.PhysicalResourceId)
+			stackNames = append(stackNames, stackName)
+			stackLogicalNames[stackName] = aws.StringValue(eachSummary.LogicalResourceId)
+		}
+	}
+	// Nested stacks reference the service functions through the
+	// parameters that the service stack supplies
+	var stackParameterRefs map[string]map[string]map[string]bool
+	resourceFunctions := make(map[string][]string)
+	results := make([]*spartaCF.StackDriftResult, 0)
+	for _, eachStackName := range stackNames {
+		templateOutput, templateErr := cloudformation.New(awsSession).GetTemplate(&cloudformation.GetTemplateInput{
+			StackName: aws.String(eachStackName),
+		})
+		if nil != templateErr {
+			return errors.Wrapf(templateErr, "Failed to get stack template")
+		}
+		templateBody := aws.StringValue(templateOutput.TemplateBody)
+		if serviceName == eachStackName {
+			var parameterRefsErr error
+			stackParameterRefs, parameterRefsErr = nestedStackParameterRefs(templateBody)
+			if nil != parameterRefsErr {
+				logger.WithFields(logrus.Fields{
+					"StackName": eachStackName,
+					"Error":     parameterRefsErr,
+				}).Warn("Failed to map nested stack parameters")
+			}
+		}
+		stackFunctions, stackFunctionsErr := templateResourceFunctions(templateBody,
+			stackParameterRefs[stackLogicalNames[eachStackName]],
+			lambdaAWSInfos)
+		if nil != stackFunctionsErr {
+			// The drift is still useful without the function names
+			logger.WithFields(logrus.Fields{
+				"StackName": eachStackName,
+				"Error":     stackFunctionsErr,
+			}).Warn("Failed to map stack resources to functions")
+		}
+		for eachResourceName, eachFunctions := range stackFunctions {
+			resourceFunctions[eachResourceName] = eachFunctions
+		}
+		result, resultErr := spartaCF.DetectStackDrift(eachStackName, awsSession, logger)
+		if nil != resultErr {
+			return resultErr
+		}
+		results = append(results, result)
+	}
+	result := mergeStackDriftResults(results)
+	drift := newServiceDrift(serviceName, result, resourceFunctions)
+
+	if StatusFormatJSON == outputFormat {
+		encoder := json.NewEncoder(outputWriter)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(drift)
+	}
+	logServiceDrift(drift, logger)
+	return nil
+}
@@ -0,0 +1,189 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+)
+
+func TestDriftResourceFunctions(t *testing.T) {
+	logger, _ := NewLogger("info")
+	lambdaFn1 := HandleAWSLambda(LambdaName(mockLambda1), mockLambda1, LambdaExecuteARN)
+	lambdaFn2 := HandleAWSLambda(LambdaName(mockLambda2), mockLambda2, LambdaExecuteARN)
+	lambdaName1 := lambdaFn1.LogicalResourceName()
+	lambdaName2 := lambdaFn2.LogicalResourceName()
+
+	templateBody := fmt.Sprintf(`{
+	"Resources": {
+		"%s": {
+			"Type": "AWS::Lambda::Function",
+			"Properties": {"Role": {"Fn::GetAtt": ["SharedRole", "Arn"]}}
+		},
+		"%s": {
+			"Type": "AWS::Lambda::Function",
+			"Properties": {"Role": {"Fn::GetAtt": ["SharedRole", "Arn"]}},
+			"DependsOn": ["DecoratorTable"]
+		},
+		"SharedRole": {
+			"Type": "AWS::IAM::Role"
+		},
+		"DecoratorTable": {
+			"Type": "AWS::DynamoDB::Table"
+		},
+		"EventSourceMapping": {
+			"Type": "AWS::Lambda::EventSourceMapping",
+			"Properties": {"FunctionName": {"Ref": "%s"}}
+		},
+		"Unowned": {
+			"Type": "AWS::S3::Bucket"
+		}
+	}
+}`, lambdaName1, lambdaName2, lambdaName1)
+
+	resourceFunctions, resourceFunctionsErr := templateResourceFunctions(templateBody,
+		nil,
+		[]*LambdaAWSInfo{lambdaFn1, lambdaFn2})
+	if nil != resourceFunctionsErr {
+		t.Fatal(resourceFunctionsErr)
+	}
+	functionName1 := lambdaFn1.lambdaFunctionName()
+	functionName2 := lambdaFn2.lambdaFunctionName()
+	expected := map[string][]string{
+		lambdaName1:          {functionName1},
+		lambdaName2:          {functionName2},
+		"SharedRole":         {functionName1, functionName2},
+		"DecoratorTable":     {functionName2},
+		"EventSourceMapping": {functionName1},
+		"Unowned":            nil,
+	}
+	for eachResource, eachExpected := range expected {
+		if !reflect.DeepEqual(resourceFunctions[eachResource], eachExpected) {
+			t.Errorf("Unexpected functions for %s: %v. Expected: %v",
+				eachResource,
+				resourceFunctions[eachResource],
+				eachExpected)
+		}
+	}
+
+	result := &spartaCF.StackDriftResult{
+		StackDriftStatus: spartaCF.StackDriftStatusDrifted,
+		DetectionStatus:  spartaCF.StackDriftDetectionStatusComplete,
+		ResourceDrifts: []*spartaCF.StackResourceDrift{
+			{
+				LogicalResourceID:        aws.String(lambdaName1),
+				ResourceType:             aws.String("AWS::Lambda::Function"),
+				StackResourceDriftStatus: aws.String(spartaCF.StackResourceDriftStatusModified),
+				PropertyDifferences: []*spartaCF.PropertyDifference{
+					{
+						PropertyPath:   aws.String("/Environment/Variables/LEVEL"),
+						ExpectedValue:  aws.String("info"),
+						ActualValue:    aws.String("debug"),
+						DifferenceType: aws.String("NOT_EQUAL"),
+					},
+				},
+			},
+		},
+	}
+	drift := newServiceDrift("DriftService", result, resourceFunctions)
+	if len(drift.Resources) != 1 ||
+		!reflect.DeepEqual(drift.Resources[0].Functions, []string{functionName1}) {
+		t.Errorf("Unexpected drift resources: %#v", drift.Resources)
+	}
+	logServiceDrift(drift, logger)
+}
+
+func TestDriftNestedResourceFunctions(t *testing.T) {
+	lambdaFn := HandleAWSLambda(LambdaName(mockLambda1), mockLambda1, LambdaExecuteARN)
+	lambdaName := lambdaFn.LogicalResourceName()
+
+	rootTemplateBody := fmt.Sprintf(`{
+	"Resources": {
+		"%s": {
+			"Type": "AWS::Lambda::Function"
+		},
+		"Permissions1": {
+			"Type": "AWS::CloudFormation::Stack",
+			"Properties": {
+				"TemplateURL": "https://s3.amazonaws.com/bucket/Permissions1.json",
+				"Parameters": {
+					"FunctionArn": {"Fn::GetAtt": ["%s", "Arn"]},
+					"StackName": {"Ref": "AWS::StackName"}
+				}
+			}
+		}
+	}
+}`, lambdaName, lambdaName)
+	stackParameterRefs, stackParameterRefsErr := nestedStackParameterRefs(rootTemplateBody)
+	if nil != stackParameterRefsErr {
+		t.Fatal(stackParameterRefsErr)
+	}
+	childTemplateBody := `{
+	"Parameters": {
+		"FunctionArn": {"Type": "String"},
+		"StackName": {"Type": "String"}
+	},
+	"Resources": {
+		"InvokePermission": {
+			"Type": "AWS::Lambda::Permission",
+			"Properties": {"FunctionName": {"Ref": "FunctionArn"}}
+		},
+		"Unowned": {
+			"Type": "AWS::S3::Bucket",
+			"Properties": {"BucketName": {"Ref": "StackName"}}
+		}
+	}
+}`
+	resourceFunctions, resourceFunctionsErr := templateResourceFunctions(childTemplateBody,
+		stackParameterRefs["Permissions1"],
+		[]*LambdaAWSInfo{lambdaFn})
+	if nil != resourceFunctionsErr {
+		t.Fatal(resourceFunctionsErr)
+	}
+	expected := map[string][]string{
+		"InvokePermission": {lambdaFn.lambdaFunctionName()},
+		"Unowned":          nil,
+	}
+	for eachResource, eachExpected := range expected {
+		if !reflect.DeepEqual(resourceFunctions[eachResource], eachExpected) {
+			t.Errorf("Unexpected functions for nested %s: %v. Expected: %v",
+				eachResource,
+				resourceFunctions[eachResource],
+				eachExpected)
+		}
+	}
+}
+
+func TestMergeStackDriftResults(t *testing.T) {
+	nestedDrift := &spartaCF.StackResourceDrift{
+		LogicalResourceID:        aws.String("NestedFunction"),
+		StackID:                  aws.String("arn:aws:cloudformation:us-west-2:000000000000:stack/Nested/2"),
+		StackResourceDriftStatus: aws.String(spartaCF.StackResourceDriftStatusDeleted),
+	}
+	result := mergeStackDriftResults([]*spartaCF.StackDriftResult{
+		{
+			StackDriftStatus: spartaCF.StackDriftStatusInSync,
+			DetectionStatus:  spartaCF.StackDriftDetectionStatusComplete,
+		},
+		{
+			StackDriftStatus:      spartaCF.StackDriftStatusDrifted,
+			DetectionStatus:       spartaCF.StackDriftDetectionStatusFailed,
+			DetectionStatusReason: "Unsupported resource",
+			ResourceDrifts:        []*spartaCF.StackResourceDrift{nestedDrift},
+		},
+	})
+	if spartaCF.StackDriftStatusDrifted != result.StackDriftStatus ||
+		spartaCF.StackDriftDetectionStatusFailed != result.DetectionStatus ||
+		"Unsupported resource" != result.DetectionStatusReason {
+		t.Errorf("Unexpected merged drift status: %#v", result)
+	}
+	drift := newServiceDrift("DriftService", result, nil)
+	if len(drift.Resources) != 1 ||
+		aws.StringValue(nestedDrift.StackID) != drift.Resources[0].StackID {
+		t.Errorf("Expected nested stack resource drift: %#v", drift.Resources)
+	}
+}
@@ -2,13 +2,26 @@ package sparta
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"os"
 	"reflect"
 	"regexp"
 	"strings"
 
+	awsLambdaContext "github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
+// StampedServiceName is the name stamp
+// https://blog.cloudflare.com/setting-go-variables-at-compile-time/
+// StampedServiceName is the serviceName stamped into this binary
+var StampedServiceName string
+
+// StampedBuildID is the buildID stamped into the binary
+var StampedBuildID string
+
 var (
 	reSplitCustomType = regexp.MustCompile(`\:+`)
 
@@ -35,6 +48,16 @@ func awsLambdaInternalName(internalFunctionName string) string {
 	return strings.Join(internalNameParts, functionNameDelimiter)
 }
 
+// awsLambdaPhysicalName returns the deployed function name for the
+// given stack. It's the literal form of the awsLambdaFunctionName
+// expression once the stack name is known.
+func awsLambdaPhysicalName(stackName string, internalFunctionName string) string {
+	return fmt.Sprintf("%s%s%s",
+		stackName,
+		functionNameDelimiter,
+		awsLambdaInternalName(internalFunctionName))
+}
+
 func validateArguments(handler reflect.Type) error {
 	handlerTakesContext := false
 	if handler.NumIn() > 2 {
@@ -90,3 +113,80 @@ func ensureValidSignature(lambdaName string, handlerSymbol interface{}) error {
 	}
 	return nil
 }
+
+func takesContext(handler reflect.Type) bool {
+	handlerTakesContext := false
+	if handler.NumIn() > 0 {
+		contextType := reflect.TypeOf((*context.Context)(nil)).Elem()
+		argumentType := handler.In(0)
+		handlerTakesContext = argumentType.Implements(contextType)
+	}
+	return handlerTakesContext
+}
+
+// tappedHandler wraps the user supplied handler so that the logger
+// values are available in the context. It's shared by the AWS Lambda
+// dispatcher and the local `explore` server so that both exercise the
+// same reflection path.
+func tappedHandler(handlerSymbol interface{},
+	logger *logrus.Logger) func(context.Context, json.RawMessage) (interface{}, error) {
+
+	// Tap the call chain to inject the context params...
+	handler := reflect.ValueOf(handlerSymbol)
+	handlerType := reflect.TypeOf(handlerSymbol)
+	takesContext := takesContext(handlerType)
+
+	return func(ctx context.Context, msg json.RawMessage) (interface{}, error) {
+		ctx = context.WithValue(ctx, ContextKeyLogger, logger)
+		ctx = context.WithValue(ctx, ContextKeyStage, os.Getenv(envVarStage))
+
+		// Create the entry logger that has some context information
+		var logrusEntry *logrus.Entry
+		lambdaContext, lambdaContextOk := awsLambdaContext.FromContext(ctx)
+		if lambdaContextOk {
+			logrusEntry = logrus.
+				NewEntry(logger).
+				WithFields(logrus.Fields{
+					"reqID": lambdaContext.AwsRequestID,
+					"arn":   lambdaContext.InvokedFunctionArn,
+					"build": StampedBuildID,
+				})
+		} else {
+			logrusEntry = logrus.
+				NewEntry(logger).
+				WithFields(logrus.Fields{})
+		}
+		ctx = context.WithValue(ctx, ContextKeyRequestLogger, logrusEntry)
+
+		// construct arguments
+		var args []reflect.Value
+		if takesContext {
+			args = append(args, reflect.ValueOf(ctx))
+		}
+		if (handlerType.NumIn() == 1 && !takesContext) ||
+			handlerType.NumIn() == 2 {
+			eventType := handlerType.In(handlerType.NumIn() - 1)
+			event := reflect.New(eventType)
+			unmarshalErr := json.Unmarshal(msg, event.Interface())
+			if unmarshalErr != nil {
+				return nil, unmarshalErr
+			}
+			args = append(args, event.Elem())
+		}
+		response := handler.Call(args)
+
+		// If the user function
+		// convert return values into (interface{}, error)
+		var err error
+		if len(response) > 0 {
+			if errVal, ok := response[len(response)-1].Interface().(error); ok {
+				err = errVal
+			}
+		}
+		var val interface{}
+		if len(response) > 1 {
+			val = response[0].Interface()
+		}
+		return val, err
+	}
+}
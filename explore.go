@@ -0,0 +1,258 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	cryptoRand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	awsLambdaContext "github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// exploreFunctionRootPath is the URL path prefix under which
+	// each exported function accepts POSTed events
+	exploreFunctionRootPath = "/functions/"
+	// exploreAccountID is the placeholder account used to build the
+	// InvokedFunctionArn for local invocations
+	exploreAccountID = "000000000000"
+)
+
+// exploreFunction is a single, locally invokable handler that is
+// published by the explore server
+type exploreFunction struct {
+	// Name is the sanitized name used in the request path
+	Name string `json:"name"`
+	// FunctionName is the Sparta internal function name
+	FunctionName string `json:"functionName"`
+	// LogicalResourceName is the CloudFormation logical name, if this
+	// is a user function
+	LogicalResourceName string `json:"logicalResourceName,omitempty"`
+	// CustomResource is true iff this is a user defined CustomResource
+	// handler
+	CustomResource bool `json:"customResource"`
+	// Signature is the Go type of the handler
+	Signature string `json:"signature"`
+	// URL is the relative path to POST events to
+	URL string `json:"url"`
+	// The handler to invoke
+	handlerSymbol interface{}
+}
+
+// exploreResponse is the JSON envelope returned for each invocation
+type exploreResponse struct {
+	RequestID string      `json:"requestID"`
+	Function  string      `json:"function"`
+	Duration  string      `json:"duration"`
+	Result    interface{} `json:"result,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+func newExploreFunction(functionName string,
+	logicalResourceName string,
+	customResource bool,
+	handlerSymbol interface{}) *exploreFunction {
+	name := awsLambdaInternalName(functionName)
+	return &exploreFunction{
+		Name:                name,
+		FunctionName:        functionName,
+		LogicalResourceName: logicalResourceName,
+		CustomResource:      customResource,
+		Signature:           reflect.TypeOf(handlerSymbol).String(),
+		URL:                 fmt.Sprintf("%s%s", exploreFunctionRootPath, name),
+		handlerSymbol:       handlerSymbol,
+	}
+}
+
+// exploreFunctions returns the map of all user functions and user defined
+// custom resources, keyed by the sanitized name
+func exploreFunctions(lambdaAWSInfos []*LambdaAWSInfo) (map[string]*exploreFunction, error) {
+	functions := make(map[string]*exploreFunction)
+	insertFunction := func(exploreFunc *exploreFunction) error {
+		_, exists := functions[exploreFunc.Name]
+		if exists {
+			return errors.Errorf("Multiple definitions of lambda: %s", exploreFunc.Name)
+		}
+		functions[exploreFunc.Name] = exploreFunc
+		return nil
+	}
+	for _, eachLambdaInfo := range lambdaAWSInfos {
+		insertErr := insertFunction(newExploreFunction(eachLambdaInfo.lambdaFunctionName(),
+			eachLambdaInfo.LogicalResourceName(),
+			false,
+			eachLambdaInfo.handlerSymbol))
+		if insertErr != nil {
+			return nil, insertErr
+		}
+		for _, eachCustomResource := range eachLambdaInfo.customResources {
+			insertErr = insertFunction(newExploreFunction(eachCustomResource.userFunctionName,
+				eachCustomResource.logicalName(),
+				true,
+				eachCustomResource.handlerSymbol))
+			if insertErr != nil {
+				return nil, insertErr
+			}
+		}
+	}
+	return functions, nil
+}
+
+func exploreRequestID() string {
+	randomBytes := make([]byte, 16)
+	_, err := cryptoRand.Read(randomBytes)
+	if err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(randomBytes)
+}
+
+func writeExploreJSON(w http.ResponseWriter, statusCode int, value interface{}, logger *logrus.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encodeErr := encoder.Encode(value)
+	if encodeErr != nil {
+		logger.WithFields(logrus.Fields{
+			"Error": encodeErr,
+		}).Warn("Failed to write explore response")
+	}
+}
+
+// exploreHandler returns the http.Handler that lists the available functions
+// in response to a GET and dispatches POSTed events to them
+func exploreHandler(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	logger *logrus.Logger) (http.Handler, error) {
+
+	functions, functionsErr := exploreFunctions(lambdaAWSInfos)
+	if functionsErr != nil {
+		return nil, functionsErr
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		sortedFunctions := make([]*exploreFunction, 0)
+		for _, eachFunction := range functions {
+			sortedFunctions = append(sortedFunctions, eachFunction)
+		}
+		sort.Slice(sortedFunctions, func(i, j int) bool {
+			return sortedFunctions[i].Name < sortedFunctions[j].Name
+		})
+		writeExploreJSON(w, http.StatusOK, map[string]interface{}{
+			"service":   serviceName,
+			"functions": sortedFunctions,
+		}, logger)
+	})
+	mux.HandleFunc(exploreFunctionRootPath, func(w http.ResponseWriter, r *http.Request) {
+		functionName := strings.TrimPrefix(r.URL.Path, exploreFunctionRootPath)
+		exploreFunc, exists := functions[functionName]
+		if !exists {
+			writeExploreJSON(w, http.StatusNotFound, &exploreResponse{
+				Function: functionName,
+				Error:    fmt.Sprintf("Unknown function: %s", functionName),
+			}, logger)
+			return
+		}
+		if r.Method == http.MethodGet {
+			writeExploreJSON(w, http.StatusOK, exploreFunc, logger)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		defer r.Body.Close()
+		body, bodyErr := ioutil.ReadAll(r.Body)
+		if bodyErr != nil {
+			http.Error(w, bodyErr.Error(), http.StatusBadRequest)
+			return
+		}
+		// An empty body is treated as an empty JSON object so that
+		// handlers without an event argument can be invoked
+		if len(strings.TrimSpace(string(body))) == 0 {
+			body = []byte("{}")
+		}
+		requestID := exploreRequestID()
+		lambdaContext := &awsLambdaContext.LambdaContext{
+			AwsRequestID: requestID,
+			InvokedFunctionArn: fmt.Sprintf("arn:aws:lambda:local:%s:function:%s%s%s",
+				exploreAccountID,
+				serviceName,
+				functionNameDelimiter,
+				exploreFunc.Name),
+		}
+		ctx := awsLambdaContext.NewContext(r.Context(), lambdaContext)
+
+		logger.WithFields(logrus.Fields{
+			"Function":  exploreFunc.Name,
+			"RequestID": requestID,
+		}).Info("Invoking function")
+
+		startTime := time.Now()
+		result, resultErr := tappedHandler(exploreFunc.handlerSymbol, logger)(ctx, json.RawMessage(body))
+		response := &exploreResponse{
+			RequestID: requestID,
+			Function:  exploreFunc.Name,
+			Duration:  time.Since(startTime).String(),
+			Result:    result,
+		}
+		statusCode := http.StatusOK
+		if resultErr != nil {
+			response.Error = resultErr.Error()
+			statusCode = http.StatusInternalServerError
+		}
+		logger.WithFields(logrus.Fields{
+			"Function":  exploreFunc.Name,
+			"RequestID": requestID,
+			"Duration":  response.Duration,
+			"Error":     resultErr,
+		}).Info("Function invocation complete")
+		writeExploreJSON(w, statusCode, response, logger)
+	})
+	return mux, nil
+}
+
+// Explore is an interactive command that starts a localhost HTTP server
+// that lists the service's functions and accepts POSTed JSON events
+// for local invocation. Events are dispatched via the same reflection
+// path used by the AWS Lambda binary.
+func Explore(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	port int,
+	logger *logrus.Logger) error {
+
+	validationErr := validateSpartaPreconditions(lambdaAWSInfos, logger)
+	if validationErr != nil {
+		return validationErr
+	}
+	// Ensure the discovery service is initialized
+	initializeDiscovery(logger)
+
+	handler, handlerErr := exploreHandler(serviceName, lambdaAWSInfos, logger)
+	if handlerErr != nil {
+		return handlerErr
+	}
+	listenAddress := fmt.Sprintf("localhost:%d", port)
+	logger.WithFields(logrus.Fields{
+		"URL": fmt.Sprintf("http://%s", listenAddress),
+	}).Info(fmt.Sprintf("Starting explore server. POST JSON events to http://%s%s<name>. Enter Ctrl+C to exit.",
+		listenAddress,
+		exploreFunctionRootPath))
+	return http.ListenAndServe(listenAddress, handler)
+}
@@ -0,0 +1,70 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExplore(t *testing.T) {
+	logger, _ := NewLogger("info")
+	lambdaFunctions := testLambdaData()
+	handler, handlerErr := exploreHandler("SampleExplore", lambdaFunctions, logger)
+	if nil != handlerErr {
+		t.Fatalf("Failed to create explore handler: %s", handlerErr)
+	}
+	testServer := httptest.NewServer(handler)
+	defer testServer.Close()
+
+	// List the functions
+	listResp, listErr := http.Get(testServer.URL)
+	if nil != listErr {
+		t.Fatalf("Failed to list functions: %s", listErr)
+	}
+	defer listResp.Body.Close()
+	listing := struct {
+		Functions []*exploreFunction `json:"functions"`
+	}{}
+	decodeErr := json.NewDecoder(listResp.Body).Decode(&listing)
+	if nil != decodeErr {
+		t.Fatalf("Failed to decode listing: %s", decodeErr)
+	}
+	if len(listing.Functions) != len(lambdaFunctions) {
+		t.Fatalf("Expected %d functions, got %d", len(lambdaFunctions), len(listing.Functions))
+	}
+
+	// Invoke the first one
+	invokeURL := testServer.URL + listing.Functions[0].URL
+	invokeResp, invokeErr := http.Post(invokeURL, "application/json", strings.NewReader("{}"))
+	if nil != invokeErr {
+		t.Fatalf("Failed to invoke function: %s", invokeErr)
+	}
+	defer invokeResp.Body.Close()
+	if invokeResp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected invoke status: %d", invokeResp.StatusCode)
+	}
+	response := exploreResponse{}
+	decodeErr = json.NewDecoder(invokeResp.Body).Decode(&response)
+	if nil != decodeErr {
+		t.Fatalf("Failed to decode response: %s", decodeErr)
+	}
+	if response.Result != "mockLambda1!" {
+		t.Errorf("Unexpected invoke result: %#v", response.Result)
+	}
+
+	// Unknown function
+	missingResp, missingErr := http.Post(testServer.URL+exploreFunctionRootPath+"missing",
+		"application/json",
+		strings.NewReader("{}"))
+	if nil != missingErr {
+		t.Fatalf("Failed to POST to missing function: %s", missingErr)
+	}
+	defer missingResp.Body.Close()
+	if missingResp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for missing function, got %d", missingResp.StatusCode)
+	}
+}
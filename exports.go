@@ -0,0 +1,73 @@
+package sparta
+
+import (
+	"fmt"
+	"regexp"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+// reServiceExportName is the set of valid export names, which are
+// also used as the logical name of the template output
+var reServiceExportName = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+// ServiceExport identifies a value that a Sparta service exports so that
+// other stacks can import it with Fn::ImportValue. The CloudFormation
+// export name is derived from the service name, so that exports from
+// different services don't collide.
+type ServiceExport struct {
+	// ServiceName is the name of the exporting service stack
+	ServiceName string
+	// Name identifies the value within the service. It must be
+	// alphanumeric, since it's also the template output name.
+	Name string
+}
+
+// ExportName returns the CloudFormation export name
+func (export ServiceExport) ExportName() string {
+	return fmt.Sprintf("%s-%s", export.ServiceName, export.Name)
+}
+
+// ImportValue returns the Fn::ImportValue expression for the exported
+// value. The expression can be used as an EventSourceMapping.EventSourceArn,
+// IAMRolePrivilege.Resource, BasePermission.SourceArn or
+// LambdaFunctionOptions.Environment value.
+func (export ServiceExport) ImportValue() *gocf.StringExpr {
+	return gocf.ImportValue(gocf.String(export.ExportName())).String()
+}
+
+// AddOutput adds a template output that exports value. It's typically
+// called from a ServiceDecoratorHook, with a Ref or Fn::GetAtt expression
+// for a resource that the decorator provisions.
+func (export ServiceExport) AddOutput(template *gocf.Template,
+	value gocf.Stringable,
+	description string) error {
+	if "" == export.ServiceName {
+		return errors.Errorf("ServiceExport (%s) must include the ServiceName", export.Name)
+	}
+	if !reServiceExportName.MatchString(export.Name) {
+		return errors.Errorf("Invalid ServiceExport name (%s). Names must be alphanumeric",
+			export.Name)
+	}
+	if _, exists := template.Outputs[export.Name]; exists {
+		return errors.Errorf("Template output (%s) has already been defined", export.Name)
+	}
+	template.Outputs[export.Name] = &gocf.Output{
+		Description: description,
+		Value:       value.String(),
+		Export: &gocf.OutputExport{
+			Name: gocf.String(export.ExportName()),
+		},
+	}
+	return nil
+}
+
+// ImportServiceValue returns the Fn::ImportValue expression for the
+// value that the serviceName service exports with the given name
+func ImportServiceValue(serviceName string, name string) *gocf.StringExpr {
+	return ServiceExport{
+		ServiceName: serviceName,
+		Name:        name,
+	}.ImportValue()
+}
@@ -0,0 +1,56 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+func TestServiceExport(t *testing.T) {
+	template := gocf.NewTemplate()
+	export := ServiceExport{
+		ServiceName: "OrdersService",
+		Name:        "OrdersTopicArn",
+	}
+	addErr := export.AddOutput(template, gocf.Ref("OrdersTopic"), "Orders topic")
+	if nil != addErr {
+		t.Fatal(addErr)
+	}
+	outputJSON, _ := json.Marshal(template.Outputs)
+	if !strings.Contains(string(outputJSON), `"Export":{"Name":"OrdersService-OrdersTopicArn"}`) {
+		t.Errorf("Unexpected export output: %s", string(outputJSON))
+	}
+	if nil == export.AddOutput(template, gocf.Ref("OrdersTopic"), "") {
+		t.Error("Expected error for duplicate export")
+	}
+	if nil == (ServiceExport{ServiceName: "OrdersService", Name: "Orders-Topic"}).AddOutput(template,
+		gocf.Ref("OrdersTopic"),
+		"") {
+		t.Error("Expected error for invalid export name")
+	}
+
+	// The import is usable wherever a dynamic ARN is accepted
+	importValue := ImportServiceValue("OrdersService", "OrdersTopicArn")
+	expectedImport := `{"Fn::ImportValue":"OrdersService-OrdersTopicArn"}`
+	privilege := IAMRolePrivilege{
+		Actions:  []string{"sns:Publish"},
+		Resource: importValue,
+	}
+	for _, eachExpr := range []interface{}{importValue,
+		privilege.resourceExpr(),
+		spartaCF.DynamicValueToStringExpr(importValue)} {
+		exprJSON, _ := json.Marshal(eachExpr)
+		if expectedImport != string(exprJSON) {
+			t.Errorf("Unexpected import expression: %s", string(exprJSON))
+		}
+	}
+	ref, refErr := resolveResourceRef(importValue)
+	if nil != refErr || nil != ref {
+		t.Errorf("Expected imported value to be unresolved: %#v (%v)", ref, refErr)
+	}
+}
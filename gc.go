@@ -0,0 +1,282 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	humanize "github.com/dustin/go-humanize"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	spartaS3 "github.com/mweagle/Sparta/aws/s3"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// pruneMinimumAge is how old an unreferenced object must be before it's
+// deleted. It protects the artifacts of a provision that's in progress.
+const pruneMinimumAge = 1 * time.Hour
+
+// pruneBatchSize is the maximum number of objects in a DeleteObjects request
+const pruneBatchSize = 1000
+
+// serviceObject is a single S3 object version under the service key prefix
+type serviceObject struct {
+	key          string
+	versionID    string
+	lastModified time.Time
+	size         int64
+}
+
+// serviceObjects returns every object, or every object version if the bucket
+// is versioned, under the service key prefix
+func serviceObjects(serviceName string,
+	s3Bucket string,
+	versioned bool,
+	s3Svc *s3.S3) ([]*serviceObject, error) {
+
+	objects := make([]*serviceObject, 0)
+	prefix := aws.String(fmt.Sprintf("%s/", serviceName))
+	if versioned {
+		listErr := s3Svc.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+			Bucket: aws.String(s3Bucket),
+			Prefix: prefix,
+		}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+			for _, eachVersion := range page.Versions {
+				objects = append(objects, &serviceObject{
+					key:          aws.StringValue(eachVersion.Key),
+					versionID:    aws.StringValue(eachVersion.VersionId),
+					lastModified: aws.TimeValue(eachVersion.LastModified),
+					size:         aws.Int64Value(eachVersion.Size),
+				})
+			}
+			for _, eachMarker := range page.DeleteMarkers {
+				objects = append(objects, &serviceObject{
+					key:          aws.StringValue(eachMarker.Key),
+					versionID:    aws.StringValue(eachMarker.VersionId),
+					lastModified: aws.TimeValue(eachMarker.LastModified),
+				})
+			}
+			return true
+		})
+		return objects, listErr
+	}
+	listErr := s3Svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s3Bucket),
+		Prefix: prefix,
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, eachObject := range page.Contents {
+			objects = append(objects, &serviceObject{
+				key:          aws.StringValue(eachObject.Key),
+				lastModified: aws.TimeValue(eachObject.LastModified),
+				size:         aws.Int64Value(eachObject.Size),
+			})
+		}
+		return true
+	})
+	return objects, listErr
+}
+
+// liveStackReferences returns the build ID and template body of the
+// deployed stack. Both are empty if the stack doesn't exist.
+func liveStackReferences(serviceName string,
+	awsSession *session.Session,
+	logger *logrus.Logger) (string, string, error) {
+
+	exists, existsErr := spartaCF.StackExists(serviceName, awsSession, logger)
+	if nil != existsErr || !exists {
+		return "", "", existsErr
+	}
+	cfSvc := cloudformation.New(awsSession)
+	describeOutput, describeErr := cfSvc.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(serviceName),
+	})
+	if nil != describeErr {
+		return "", "", describeErr
+	}
+	buildID := ""
+	for _, eachStack := range describeOutput.Stacks {
+		for _, eachTag := range eachStack.Tags {
+			if SpartaTagBuildIDKey == aws.StringValue(eachTag.Key) {
+				buildID = aws.StringValue(eachTag.Value)
+			}
+		}
+	}
+	templateOutput, templateErr := cfSvc.GetTemplate(&cloudformation.GetTemplateInput{
+		StackName: aws.String(serviceName),
+	})
+	if nil != templateErr {
+		return "", "", templateErr
+	}
+	return buildID, aws.StringValue(templateOutput.TemplateBody), nil
+}
+
+// retainedObjectKeys returns the set of keys that must not be deleted. These
+// are the artifacts of the live stack and of the keepCount most recent builds.
+func retainedObjectKeys(manifests []*buildManifest,
+	serviceName string,
+	liveBuildID string,
+	liveTemplateBody string,
+	objects []*serviceObject,
+	keepCount int) map[string]bool {
+
+	retained := make(map[string]bool)
+	artifactPaths := make([]string, 0)
+	for index, eachManifest := range manifests {
+		if index >= keepCount && eachManifest.BuildID != liveBuildID {
+			continue
+		}
+		retained[buildManifestKey(serviceName, eachManifest.BuildID)] = true
+		for _, eachURL := range eachManifest.artifactURLs() {
+			artifactURL := newS3UploadURL(eachURL)
+			if nil != artifactURL {
+				artifactPaths = append(artifactPaths, artifactURL.keyName())
+			}
+		}
+	}
+	for _, eachObject := range objects {
+		for _, eachPath := range artifactPaths {
+			if eachPath == eachObject.key {
+				retained[eachObject.key] = true
+			}
+		}
+		// The live template may reference objects from a build that predates
+		// the manifests, so look for them directly
+		if "" != liveTemplateBody && strings.Contains(liveTemplateBody, eachObject.key) {
+			retained[eachObject.key] = true
+		}
+	}
+	return retained
+}
+
+// deleteServiceObjects deletes the objects in batches
+func deleteServiceObjects(s3Bucket string,
+	objects []*serviceObject,
+	s3Svc *s3.S3) error {
+
+	for start := 0; start < len(objects); start += pruneBatchSize {
+		end := start + pruneBatchSize
+		if end > len(objects) {
+			end = len(objects)
+		}
+		deleteIdentifiers := make([]*s3.ObjectIdentifier, 0)
+		for _, eachObject := range objects[start:end] {
+			identifier := &s3.ObjectIdentifier{
+				Key: aws.String(eachObject.key),
+			}
+			if "" != eachObject.versionID {
+				identifier.VersionId = aws.String(eachObject.versionID)
+			}
+			deleteIdentifiers = append(deleteIdentifiers, identifier)
+		}
+		deleteOutput, deleteErr := s3Svc.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(s3Bucket),
+			Delete: &s3.Delete{
+				Objects: deleteIdentifiers,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if nil != deleteErr {
+			return errors.Wrapf(deleteErr, "Failed to delete S3 objects")
+		}
+		if len(deleteOutput.Errors) != 0 {
+			return errors.Errorf("Failed to delete %d S3 object(s). First error: %s (%s)",
+				len(deleteOutput.Errors),
+				aws.StringValue(deleteOutput.Errors[0].Message),
+				aws.StringValue(deleteOutput.Errors[0].Key))
+		}
+	}
+	return nil
+}
+
+// Prune deletes the service's S3 artifacts that are no longer needed. The
+// artifacts referenced by the deployed stack and by the keepCount most
+// recent builds are retained. If noop is true, the objects that would
+// be deleted are logged.
+func Prune(serviceName string,
+	s3Bucket string,
+	keepCount int,
+	noop bool,
+	logger *logrus.Logger) error {
+
+	awsSession := spartaAWS.NewSession(logger)
+	return pruneServiceObjects(serviceName, s3Bucket, keepCount, noop, awsSession, logger)
+}
+
+func pruneServiceObjects(serviceName string,
+	s3Bucket string,
+	keepCount int,
+	noop bool,
+	awsSession *session.Session,
+	logger *logrus.Logger) error {
+
+	versioned, versionedErr := spartaS3.BucketVersioningEnabled(awsSession, s3Bucket, logger)
+	if nil != versionedErr {
+		return versionedErr
+	}
+	liveBuildID, liveTemplateBody, liveErr := liveStackReferences(serviceName, awsSession, logger)
+	if nil != liveErr {
+		return errors.Wrapf(liveErr, "Failed to determine deployed artifacts")
+	}
+	manifests, manifestsErr := buildManifests(serviceName, s3Bucket, awsSession, logger)
+	if nil != manifestsErr {
+		return manifestsErr
+	}
+	s3Svc := s3.New(awsSession)
+	objects, objectsErr := serviceObjects(serviceName, s3Bucket, versioned, s3Svc)
+	if nil != objectsErr {
+		return errors.Wrapf(objectsErr, "Failed to list S3 objects")
+	}
+	retained := retainedObjectKeys(manifests,
+		serviceName,
+		liveBuildID,
+		liveTemplateBody,
+		objects,
+		keepCount)
+
+	minimumAgeTime := time.Now().Add(-pruneMinimumAge)
+	deleteObjects := make([]*serviceObject, 0)
+	deleteSize := int64(0)
+	for _, eachObject := range objects {
+		if retained[eachObject.key] || eachObject.lastModified.After(minimumAgeTime) {
+			continue
+		}
+		logEntry := logger.WithFields(logrus.Fields{
+			"Key":          eachObject.key,
+			"LastModified": eachObject.lastModified,
+			"Size":         humanize.Bytes(uint64(eachObject.size)),
+		})
+		if "" != eachObject.versionID {
+			logEntry = logEntry.WithField("VersionID", eachObject.versionID)
+		}
+		if noop {
+			logEntry.Info(noopMessage("S3 object delete"))
+		} else {
+			logEntry.Debug("Deleting S3 object")
+		}
+		deleteObjects = append(deleteObjects, eachObject)
+		deleteSize += eachObject.size
+	}
+	if !noop {
+		deleteErr := deleteServiceObjects(s3Bucket, deleteObjects, s3Svc)
+		if nil != deleteErr {
+			return deleteErr
+		}
+	}
+	logger.WithFields(logrus.Fields{
+		"Bucket":       s3Bucket,
+		"Builds":       len(manifests),
+		"LiveBuildID":  liveBuildID,
+		"Retained":     len(objects) - len(deleteObjects),
+		"Deleted":      len(deleteObjects),
+		"DeletedBytes": humanize.Bytes(uint64(deleteSize)),
+		"NOOP":         noop,
+	}).Info("Pruned S3 artifacts")
+	return nil
+}
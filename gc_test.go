@@ -0,0 +1,61 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetainedObjectKeys(t *testing.T) {
+	now := time.Now()
+	manifests := make([]*buildManifest, 0)
+	objects := make([]*serviceObject, 0)
+	for i := 0; i != 4; i++ {
+		buildID := fmt.Sprintf("build%d", i)
+		manifests = append(manifests, &buildManifest{
+			BuildID:     buildID,
+			Created:     now.Add(time.Duration(-i) * time.Hour),
+			TemplateURL: fmt.Sprintf("https://bucket.s3.amazonaws.com/MyService/MyService-cftemplate-%d.json", i),
+			CodeURL:     fmt.Sprintf("https://s3.amazonaws.com/bucket/MyService/MyService-code-%d.zip?versionId=v%d", i, i),
+		})
+		objects = append(objects,
+			&serviceObject{key: buildManifestKey("MyService", buildID)},
+			&serviceObject{key: fmt.Sprintf("MyService/MyService-cftemplate-%d.json", i)},
+			&serviceObject{key: fmt.Sprintf("MyService/MyService-code-%d.zip", i)})
+	}
+	objects = append(objects,
+		&serviceObject{key: "MyService/MyService-code-legacy.zip"},
+		&serviceObject{key: "MyService/MyService-code-orphan.zip"})
+	liveTemplate := `{"S3Key": "MyService/MyService-code-legacy.zip"}`
+
+	retained := retainedObjectKeys(manifests,
+		"MyService",
+		"build3",
+		liveTemplate,
+		objects,
+		2)
+
+	expected := map[string]bool{
+		"MyService/builds/build0.json":          true,
+		"MyService/MyService-cftemplate-0.json": true,
+		"MyService/MyService-code-0.zip":        true,
+		"MyService/builds/build1.json":          true,
+		"MyService/MyService-cftemplate-1.json": true,
+		"MyService/MyService-code-1.zip":        true,
+		"MyService/builds/build2.json":          false,
+		"MyService/MyService-cftemplate-2.json": false,
+		"MyService/MyService-code-2.zip":        false,
+		"MyService/builds/build3.json":          true,
+		"MyService/MyService-cftemplate-3.json": true,
+		"MyService/MyService-code-3.zip":        true,
+		"MyService/MyService-code-legacy.zip":   true,
+		"MyService/MyService-code-orphan.zip":   false,
+	}
+	for eachKey, eachRetained := range expected {
+		if retained[eachKey] != eachRetained {
+			t.Errorf("Unexpected retention for %s. Expected: %t", eachKey, eachRetained)
+		}
+	}
+}
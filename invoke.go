@@ -0,0 +1,204 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	spartaCWLogs "github.com/mweagle/Sparta/aws/cloudwatchlogs"
+	spartaDynamoDB "github.com/mweagle/Sparta/aws/dynamodb"
+	spartaEvents "github.com/mweagle/Sparta/aws/events"
+	spartaKinesis "github.com/mweagle/Sparta/aws/kinesis"
+	spartaS3 "github.com/mweagle/Sparta/aws/s3"
+	spartaSES "github.com/mweagle/Sparta/aws/ses"
+	spartaSNS "github.com/mweagle/Sparta/aws/sns"
+	spartaSQS "github.com/mweagle/Sparta/aws/sqs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// invokeEventTemplates are the event payload skeletons, based on the
+// aws/* event types, that can be used as the starting point for
+// an invoke payload
+var invokeEventTemplates = map[string]func() interface{}{
+	"apigateway": func() interface{} {
+		return &spartaEvents.APIGatewayRequest{}
+	},
+	"cloudwatchlogs": func() interface{} {
+		return &spartaCWLogs.Event{}
+	},
+	"dynamodb": func() interface{} {
+		return &spartaDynamoDB.Event{Records: []spartaDynamoDB.EventRecord{{}}}
+	},
+	"kinesis": func() interface{} {
+		return &spartaKinesis.Event{Records: []spartaKinesis.EventRecord{{}}}
+	},
+	"s3": func() interface{} {
+		return &spartaS3.Event{Records: []spartaS3.EventRecord{{}}}
+	},
+	"ses": func() interface{} {
+		return &spartaSES.Event{Records: []spartaSES.EventRecord{{}}}
+	},
+	"sns": func() interface{} {
+		return &spartaSNS.Event{Records: []spartaSNS.EventRecord{{}}}
+	},
+	// The messageId identifies the record in a partial batch failure
+	// response
+	"sqs": func() interface{} {
+		return &spartaSQS.Event{Records: []spartaSQS.EventRecord{{
+			MessageID:   "00000000-0000-0000-0000-000000000000",
+			EventSource: "aws:sqs",
+		}}}
+	},
+}
+
+// InvokeEventTemplate writes the JSON skeleton for the named event type
+// to the outputWriter. The skeleton can be edited and supplied as the
+// payload to Invoke.
+func InvokeEventTemplate(eventType string, outputWriter io.Writer) error {
+	templateFactory, exists := invokeEventTemplates[strings.ToLower(eventType)]
+	if !exists {
+		knownTypes := make([]string, 0)
+		for eachType := range invokeEventTemplates {
+			knownTypes = append(knownTypes, eachType)
+		}
+		sort.Strings(knownTypes)
+		return errors.Errorf("Unknown event template: %s. Known: %s",
+			eventType,
+			strings.Join(knownTypes, ", "))
+	}
+	templateJSON, templateJSONErr := json.MarshalIndent(templateFactory(), "", "  ")
+	if nil != templateJSONErr {
+		return errors.Wrapf(templateJSONErr, "Failed to marshal event template")
+	}
+	_, writeErr := fmt.Fprintln(outputWriter, string(templateJSON))
+	return writeErr
+}
+
+// writeInvokeOutput writes the invocation results, including the decoded
+// log tail, to the outputWriter
+func writeInvokeOutput(functionName string,
+	output *lambda.InvokeOutput,
+	outputWriter io.Writer) error {
+
+	logTail := aws.StringValue(output.LogResult)
+	if "" != logTail {
+		decodedTail, decodedTailErr := base64.StdEncoding.DecodeString(logTail)
+		if nil != decodedTailErr {
+			return errors.Wrapf(decodedTailErr, "Failed to decode log tail")
+		}
+		enableColors := isTerminal(outputWriter)
+		for _, eachLine := range strings.Split(strings.TrimSpace(string(decodedTail)), "\n") {
+			fmt.Fprintln(outputWriter, formatLogMessage(functionName, eachLine, enableColors))
+		}
+	}
+	if len(output.Payload) != 0 {
+		var formatted bytes.Buffer
+		if nil == json.Indent(&formatted, output.Payload, "", "  ") {
+			fmt.Fprintln(outputWriter, formatted.String())
+		} else {
+			fmt.Fprintln(outputWriter, string(output.Payload))
+		}
+	}
+	return nil
+}
+
+// newInvokeInput returns the request that invokes the target. Functions
+// with an alias are invoked with the alias as the Qualifier, so that the
+// published version is called rather than $LATEST.
+func newInvokeInput(target *deployedFunction,
+	payload []byte,
+	async bool) *lambda.InvokeInput {
+	invokeInput := &lambda.InvokeInput{
+		FunctionName:   aws.String(target.physicalName),
+		Payload:        payload,
+		InvocationType: aws.String(lambda.InvocationTypeRequestResponse),
+		LogType:        aws.String(lambda.LogTypeTail),
+	}
+	if "" != target.qualifier {
+		invokeInput.Qualifier = aws.String(target.qualifier)
+	}
+	if async {
+		invokeInput.InvocationType = aws.String(lambda.InvocationTypeEvent)
+		invokeInput.LogType = aws.String(lambda.LogTypeNone)
+	}
+	return invokeInput
+}
+
+// Invoke calls the deployed version of the function that Sparta knows as
+// functionName with the payload read from payloadReader. Synchronous
+// invocations write the response, including any function error and the
+// tail of the execution log, to outputWriter. If async is true, the event
+// is queued and Invoke returns once it's been accepted.
+func Invoke(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	functionName string,
+	payloadReader io.Reader,
+	async bool,
+	outputWriter io.Writer,
+	logger *logrus.Logger) error {
+
+	if "" == functionName {
+		return errors.New("Invoke requires a function name")
+	}
+	targets, targetsErr := deployedFunctions(serviceName, lambdaAWSInfos, functionName)
+	if nil != targetsErr {
+		return targetsErr
+	}
+	if len(targets) != 1 {
+		return errors.Errorf("Function name %s is ambiguous", functionName)
+	}
+	target := targets[0]
+
+	payload, payloadErr := ioutil.ReadAll(payloadReader)
+	if nil != payloadErr {
+		return errors.Wrapf(payloadErr, "Failed to read payload")
+	}
+	if len(bytes.TrimSpace(payload)) == 0 {
+		payload = []byte("{}")
+	}
+	if !json.Valid(payload) {
+		return errors.New("Invoke payload must be valid JSON")
+	}
+
+	invokeInput := newInvokeInput(target, payload, async)
+	logger.WithFields(logrus.Fields{
+		"Function":       target.functionName,
+		"PhysicalName":   target.physicalName,
+		"Qualifier":      aws.StringValue(invokeInput.Qualifier),
+		"InvocationType": aws.StringValue(invokeInput.InvocationType),
+		"PayloadSize":    len(payload),
+	}).Info("Invoking function")
+
+	awsLambda := lambda.New(spartaAWS.NewSession(logger))
+	invokeOutput, invokeErr := awsLambda.Invoke(invokeInput)
+	if nil != invokeErr {
+		return errors.Wrapf(invokeErr, "Failed to invoke %s", target.physicalName)
+	}
+	logger.WithFields(logrus.Fields{
+		"StatusCode":      aws.Int64Value(invokeOutput.StatusCode),
+		"ExecutedVersion": aws.StringValue(invokeOutput.ExecutedVersion),
+	}).Info("Invocation complete")
+
+	writeErr := writeInvokeOutput(target.functionName, invokeOutput, outputWriter)
+	if nil != writeErr {
+		return writeErr
+	}
+	if "" != aws.StringValue(invokeOutput.FunctionError) {
+		return errors.Errorf("Function %s returned error (%s)",
+			target.functionName,
+			aws.StringValue(invokeOutput.FunctionError))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+func TestInvokeEventTemplate(t *testing.T) {
+	for eachType := range invokeEventTemplates {
+		var output bytes.Buffer
+		templateErr := InvokeEventTemplate(eachType, &output)
+		if nil != templateErr {
+			t.Fatalf("Failed to create %s template: %s", eachType, templateErr)
+		}
+		if !json.Valid(output.Bytes()) {
+			t.Errorf("Invalid JSON for %s template: %s", eachType, output.String())
+		}
+	}
+	var output bytes.Buffer
+	templateErr := InvokeEventTemplate("unknownEvent", &output)
+	if nil == templateErr {
+		t.Errorf("Expected error for unknown template type")
+	}
+}
+
+func TestInvokeOutput(t *testing.T) {
+	logTail := "START RequestId: abc-123 Version: $LATEST\n" +
+		`{"level":"info","msg":"Hello World","reqID":"abc-123"}` + "\n" +
+		"END RequestId: abc-123\n"
+	invokeOutput := &lambda.InvokeOutput{
+		StatusCode: aws.Int64(200),
+		LogResult:  aws.String(base64.StdEncoding.EncodeToString([]byte(logTail))),
+		Payload:    []byte(`"mockLambda1!"`),
+	}
+	var output bytes.Buffer
+	writeErr := writeInvokeOutput("main.mockLambda1", invokeOutput, &output)
+	if nil != writeErr {
+		t.Fatalf("Failed to write invoke output: %s", writeErr)
+	}
+	for _, eachExpected := range []string{"START RequestId", "Hello World", "mockLambda1!"} {
+		if !strings.Contains(output.String(), eachExpected) {
+			t.Errorf("Expected invoke output to include %s: %s", eachExpected, output.String())
+		}
+	}
+}
+
+func TestInvokeAliasQualifier(t *testing.T) {
+	lambdaFunctions := testLambdaData()
+	lambdaFunctions[0].Options = &LambdaFunctionOptions{
+		Alias: &LambdaAliasOptions{
+			Name: "live",
+		},
+	}
+	targets, targetsErr := deployedFunctions("SampleInvoke", lambdaFunctions, "")
+	if nil != targetsErr {
+		t.Fatal(targetsErr)
+	}
+	for eachIndex, eachTarget := range targets {
+		invokeInput := newInvokeInput(eachTarget, []byte("{}"), false)
+		expectedQualifier := ""
+		if 0 == eachIndex {
+			expectedQualifier = "live"
+		}
+		if expectedQualifier != aws.StringValue(invokeInput.Qualifier) {
+			t.Errorf("Unexpected Qualifier for %s: %s",
+				eachTarget.functionName,
+				aws.StringValue(invokeInput.Qualifier))
+		}
+	}
+}
+
+func TestInvokeSQSEventTemplate(t *testing.T) {
+	var output bytes.Buffer
+	templateErr := InvokeEventTemplate("sqs", &output)
+	if nil != templateErr {
+		t.Fatal(templateErr)
+	}
+	if !strings.Contains(output.String(), `"messageId"`) {
+		t.Errorf("Expected SQS template to include the messageId: %s", output.String())
+	}
+}
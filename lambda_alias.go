@@ -0,0 +1,97 @@
+package sparta
+
+import (
+	"fmt"
+	"regexp"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+// reLambdaAliasName is the set of valid alias names. Lambda also rejects
+// names that are entirely numeric, since they're version numbers.
+var reLambdaAliasName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+var reLambdaVersionNumber = regexp.MustCompile(`^[0-9]+$`)
+
+// LambdaAliasOptions publishes a version of the function for each build
+// and points the named alias at it. A version is only published when the
+// function configuration or code changes. Event sources, permissions, API
+// Gateway integrations and Step Functions tasks invoke the alias rather
+// than the unqualified function ($LATEST). Functions that use the
+// decorator.CodeDeployServiceUpdateDecorator shouldn't also define an
+// Alias, since the decorator manages its own `live` alias.
+type LambdaAliasOptions struct {
+	// Name of the alias (eg, "live")
+	Name string
+	// RetainedVersionCount is the number of previously published versions
+	// that are retained when a new version is published. Older versions
+	// are deleted by the stack update. The version the alias targets is
+	// always retained.
+	RetainedVersionCount int
+}
+
+func (aliasOptions *LambdaAliasOptions) validate() error {
+	if !reLambdaAliasName.MatchString(aliasOptions.Name) ||
+		reLambdaVersionNumber.MatchString(aliasOptions.Name) {
+		return errors.Errorf("Invalid Lambda alias name: %s", aliasOptions.Name)
+	}
+	if aliasOptions.RetainedVersionCount < 0 {
+		return errors.Errorf("Lambda alias (%s) RetainedVersionCount must not be negative: %d",
+			aliasOptions.Name,
+			aliasOptions.RetainedVersionCount)
+	}
+	return nil
+}
+
+// lambdaAliasResourceName returns the logical resource name of the alias
+// for the function with the given logical resource name. The name doesn't
+// depend on the alias name, so the function has at most one alias.
+func lambdaAliasResourceName(lambdaLogicalResourceName string) string {
+	return fmt.Sprintf("%sAlias", lambdaLogicalResourceName)
+}
+
+// lambdaFunctionArn returns the ARN that invokes the function defined by
+// the lambdaLogicalResourceName template resource. If the function has
+// an alias, it's the alias ARN.
+func lambdaFunctionArn(template *gocf.Template, lambdaLogicalResourceName string) *gocf.StringExpr {
+	aliasResourceName := lambdaAliasResourceName(lambdaLogicalResourceName)
+	if _, exists := template.Resources[aliasResourceName]; exists {
+		return gocf.Ref(aliasResourceName).String()
+	}
+	return gocf.GetAtt(lambdaLogicalResourceName, "Arn")
+}
+
+// FunctionARN returns the ARN that invokes the function. If the function
+// has an Alias, it's the alias ARN. Otherwise it's the unqualified
+// function ARN.
+func (info *LambdaAWSInfo) FunctionARN() *gocf.StringExpr {
+	if nil != info.Options && nil != info.Options.Alias {
+		return gocf.Ref(lambdaAliasResourceName(info.LogicalResourceName())).String()
+	}
+	return gocf.GetAtt(info.LogicalResourceName(), "Arn")
+}
+
+// exportAlias adds the AWS::Lambda::Alias resource. The alias
+// FunctionVersion is set once the template is complete, since the
+// published version depends on the final function configuration.
+func (info *LambdaAWSInfo) exportAlias(template *gocf.Template) error {
+	aliasOptions := info.Options.Alias
+	validateErr := aliasOptions.validate()
+	if nil != validateErr {
+		return validateErr
+	}
+	aliasResource := &lambdaAliasResource{
+		LambdaAlias: gocf.LambdaAlias{
+			FunctionName: gocf.Ref(info.LogicalResourceName()).String(),
+			Name:         gocf.String(aliasOptions.Name),
+		},
+	}
+	if nil != info.Options.ProvisionedConcurrency {
+		concurrencyErr := info.exportProvisionedConcurrency(aliasResource, template)
+		if nil != concurrencyErr {
+			return concurrencyErr
+		}
+	}
+	template.AddResource(lambdaAliasResourceName(info.LogicalResourceName()), aliasResource)
+	return nil
+}
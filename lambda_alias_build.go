@@ -0,0 +1,194 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// lambdaVersionMetadataKey is the AWS::Lambda::Version resource metadata
+// key that identifies the function and when the version was published
+const lambdaVersionMetadataKey = "spartaLambdaVersion"
+
+// lambdaVersionMetadata is the version resource metadata value
+type lambdaVersionMetadata struct {
+	Function  string    `json:"function"`
+	Published time.Time `json:"published"`
+}
+
+// liveTemplateResource is a resource in the deployed stack template
+type liveTemplateResource struct {
+	Type       string
+	Metadata   map[string]json.RawMessage
+	Properties json.RawMessage
+}
+
+// publishedVersion is a version resource in the deployed stack template
+type publishedVersion struct {
+	resourceName string
+	resource     *liveTemplateResource
+	metadata     lambdaVersionMetadata
+}
+
+// liveTemplateResources returns the resources in the deployed template body
+func liveTemplateResources(templateBody string) (map[string]*liveTemplateResource, error) {
+	var liveTemplate struct {
+		Resources map[string]*liveTemplateResource
+	}
+	if "" == templateBody {
+		return nil, nil
+	}
+	decodeErr := json.NewDecoder(strings.NewReader(templateBody)).Decode(&liveTemplate)
+	if nil != decodeErr {
+		return nil, errors.Wrapf(decodeErr, "Failed to parse deployed template")
+	}
+	return liveTemplate.Resources, nil
+}
+
+// publishedVersions returns the function's version resources in the
+// deployed template, ordered from most to least recently published
+func publishedVersions(lambdaLogicalResourceName string,
+	liveResources map[string]*liveTemplateResource) []*publishedVersion {
+	versions := make([]*publishedVersion, 0)
+	for eachName, eachResource := range liveResources {
+		if "AWS::Lambda::Version" != eachResource.Type {
+			continue
+		}
+		metadataJSON, metadataExists := eachResource.Metadata[lambdaVersionMetadataKey]
+		if !metadataExists {
+			continue
+		}
+		version := &publishedVersion{
+			resourceName: eachName,
+			resource:     eachResource,
+		}
+		unmarshalErr := json.Unmarshal(metadataJSON, &version.metadata)
+		if nil != unmarshalErr || version.metadata.Function != lambdaLogicalResourceName {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(lhs int, rhs int) bool {
+		return versions[lhs].metadata.Published.After(versions[rhs].metadata.Published)
+	})
+	return versions
+}
+
+// addLambdaVersionResources adds the AWS::Lambda::Version resource for the
+// function's current configuration and points the alias at it. The
+// version resource name is derived from the function properties, so a
+// new version is only published when they change. The most recently
+// published versions in the deployed template are retained, subject to
+// the alias RetainedVersionCount. Returns the version resource name.
+func addLambdaVersionResources(info *LambdaAWSInfo,
+	template *gocf.Template,
+	liveResources map[string]*liveTemplateResource,
+	published time.Time,
+	logger *logrus.Logger) (string, error) {
+
+	lambdaResourceName := info.LogicalResourceName()
+	aliasOptions := info.Options.Alias
+	lambdaResource, lambdaResourceExists := template.Resources[lambdaResourceName]
+	if !lambdaResourceExists {
+		return "", errors.Errorf("Unable to locate lambda function for alias: %s", lambdaResourceName)
+	}
+	aliasResource, aliasResourceExists := template.Resources[lambdaAliasResourceName(lambdaResourceName)]
+	if !aliasResourceExists {
+		return "", errors.Errorf("Unable to locate alias for lambda function: %s", lambdaResourceName)
+	}
+	lambdaAlias, lambdaAliasOk := aliasResource.Properties.(*lambdaAliasResource)
+	if !lambdaAliasOk {
+		return "", errors.Errorf("CloudFormation resource exists, but is incorrect type: %s",
+			aliasResource.Properties.CfnResourceType())
+	}
+	propertiesJSON, propertiesJSONErr := json.Marshal(lambdaResource.Properties)
+	if nil != propertiesJSONErr {
+		return "", errors.Wrapf(propertiesJSONErr, "Failed to marshal lambda function properties")
+	}
+	versionResourceName := CloudFormationResourceName(fmt.Sprintf("%sVersion", lambdaResourceName),
+		string(propertiesJSON))
+
+	retainedCount := 0
+	for _, eachVersion := range publishedVersions(lambdaResourceName, liveResources) {
+		// The current configuration has already been published
+		if eachVersion.resourceName == versionResourceName {
+			published = eachVersion.metadata.Published
+			continue
+		}
+		if retainedCount >= aliasOptions.RetainedVersionCount {
+			logger.WithFields(logrus.Fields{
+				"Resource":  eachVersion.resourceName,
+				"Published": eachVersion.metadata.Published,
+			}).Info("Deleting Lambda version")
+			continue
+		}
+		retainedCount++
+		retainedResource := template.AddResource(eachVersion.resourceName,
+			&uploadedResourceProperties{
+				resourceType: eachVersion.resource.Type,
+				properties:   eachVersion.resource.Properties,
+			})
+		safeMetadataInsert(retainedResource, lambdaVersionMetadataKey, eachVersion.metadata)
+	}
+	versionResource := template.AddResource(versionResourceName, &gocf.LambdaVersion{
+		FunctionName: gocf.Ref(lambdaResourceName).String(),
+	})
+	safeMetadataInsert(versionResource, lambdaVersionMetadataKey, lambdaVersionMetadata{
+		Function:  lambdaResourceName,
+		Published: published.UTC(),
+	})
+	lambdaAlias.FunctionVersion = gocf.GetAtt(versionResourceName, "Version").String()
+
+	logger.WithFields(logrus.Fields{
+		"Alias":            aliasOptions.Name,
+		"Version":          versionResourceName,
+		"RetainedVersions": retainedCount,
+	}).Debug("Lambda alias version")
+	return versionResourceName, nil
+}
+
+// annotateLambdaAliases publishes the versions that the function aliases
+// target. The versions depend on the final function properties, so this
+// runs once the template is complete.
+func annotateLambdaAliases(ctx *workflowContext) error {
+	aliasLambdas := make([]*LambdaAWSInfo, 0)
+	for _, eachLambda := range ctx.userdata.lambdaAWSInfos {
+		if nil != eachLambda.Options && nil != eachLambda.Options.Alias {
+			aliasLambdas = append(aliasLambdas, eachLambda)
+		}
+	}
+	if len(aliasLambdas) == 0 {
+		return nil
+	}
+	// The deployed template has the previously published versions
+	_, liveTemplateBody, liveErr := liveStackReferences(ctx.userdata.serviceName,
+		ctx.context.awsSession,
+		ctx.logger)
+	if nil != liveErr {
+		return errors.Wrapf(liveErr, "Failed to determine published Lambda versions")
+	}
+	liveResources, liveResourcesErr := liveTemplateResources(liveTemplateBody)
+	if nil != liveResourcesErr {
+		return liveResourcesErr
+	}
+	published := time.Now()
+	for _, eachLambda := range aliasLambdas {
+		_, versionErr := addLambdaVersionResources(eachLambda,
+			ctx.context.cfTemplate,
+			liveResources,
+			published,
+			ctx.logger)
+		if nil != versionErr {
+			return versionErr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/sirupsen/logrus"
+)
+
+func testAliasExport(t *testing.T, aliasOptions *LambdaAliasOptions) (*LambdaAWSInfo, *gocf.Template) {
+	lambdaFn, template, exportErr := testExportLambda(&LambdaFunctionOptions{
+		Alias: aliasOptions,
+	}, &EventSourceMapping{
+		StartingPosition: "TRIM_HORIZON",
+		EventSourceArn:   "arn:aws:kinesis:us-east-1:123456789012:stream/Orders",
+		BatchSize:        10,
+	})
+	if nil != exportErr {
+		t.Fatal(exportErr)
+	}
+	return lambdaFn, template
+}
+
+func TestLambdaAliasExport(t *testing.T) {
+	lambdaFn, template := testAliasExport(t, &LambdaAliasOptions{
+		Name: "live",
+	})
+	aliasResourceName := lambdaAliasResourceName(lambdaFn.LogicalResourceName())
+	aliasRef := fmt.Sprintf(`{"Ref":"%s"}`, aliasResourceName)
+	for _, eachExpr := range []*gocf.StringExpr{lambdaFn.FunctionARN(),
+		lambdaFunctionArn(template, lambdaFn.LogicalResourceName())} {
+		exprJSON, _ := json.Marshal(eachExpr)
+		if aliasRef != string(exprJSON) {
+			t.Errorf("Expected alias ARN, found: %s", string(exprJSON))
+		}
+	}
+	templateJSON, _ := json.Marshal(template)
+	for _, eachExpected := range []string{
+		`"Type":"AWS::Lambda::Alias"`,
+		`"Name":"live"`,
+		`"FunctionName":` + aliasRef,
+	} {
+		if !strings.Contains(string(templateJSON), eachExpected) {
+			t.Errorf("Expected template to include %s: %s", eachExpected, string(templateJSON))
+		}
+	}
+
+	// Without an alias, the unqualified function is invoked
+	lambdaFn, template = testAliasExport(t, nil)
+	exprJSON, _ := json.Marshal(lambdaFunctionArn(template, lambdaFn.LogicalResourceName()))
+	if fmt.Sprintf(`{"Fn::GetAtt":["%s","Arn"]}`, lambdaFn.LogicalResourceName()) != string(exprJSON) {
+		t.Errorf("Expected function ARN, found: %s", string(exprJSON))
+	}
+
+	for _, eachInvalid := range []*LambdaAliasOptions{
+		{Name: "42"},
+		{Name: "$LATEST"},
+		{Name: "live", RetainedVersionCount: -1},
+	} {
+		if nil == eachInvalid.validate() {
+			t.Errorf("Expected invalid alias options: %#v", eachInvalid)
+		}
+	}
+}
+
+func TestLambdaAliasVersions(t *testing.T) {
+	logger := logrus.New()
+	lambdaFn, template := testAliasExport(t, &LambdaAliasOptions{
+		Name:                 "live",
+		RetainedVersionCount: 1,
+	})
+	lambdaResourceName := lambdaFn.LogicalResourceName()
+	liveVersion := func(function string, published time.Time) *liveTemplateResource {
+		metadataJSON, _ := json.Marshal(lambdaVersionMetadata{
+			Function:  function,
+			Published: published,
+		})
+		return &liveTemplateResource{
+			Type: "AWS::Lambda::Version",
+			Metadata: map[string]json.RawMessage{
+				lambdaVersionMetadataKey: metadataJSON,
+			},
+			Properties: json.RawMessage(fmt.Sprintf(`{"FunctionName":{"Ref":"%s"}}`, function)),
+		}
+	}
+	now := time.Now().Truncate(time.Second)
+	liveResources := map[string]*liveTemplateResource{
+		"Version1":      liveVersion(lambdaResourceName, now.Add(-3*time.Hour)),
+		"Version2":      liveVersion(lambdaResourceName, now.Add(-2*time.Hour)),
+		"OtherVersion1": liveVersion("OtherLambda", now.Add(-1*time.Hour)),
+	}
+	versionResourceName, versionErr := addLambdaVersionResources(lambdaFn,
+		template,
+		liveResources,
+		now,
+		logger)
+	if nil != versionErr {
+		t.Fatal(versionErr)
+	}
+	for eachName, eachExpected := range map[string]bool{
+		versionResourceName: true,
+		"Version2":          true,
+		"Version1":          false,
+		"OtherVersion1":     false,
+	} {
+		if _, exists := template.Resources[eachName]; exists != eachExpected {
+			t.Errorf("Unexpected version resource %s (exists: %t)", eachName, exists)
+		}
+	}
+	aliasJSON, _ := json.Marshal(template.Resources[lambdaAliasResourceName(lambdaResourceName)])
+	if !strings.Contains(string(aliasJSON), fmt.Sprintf(`"FunctionVersion":{"Fn::GetAtt":["%s","Version"]}`,
+		versionResourceName)) {
+		t.Errorf("Expected alias to target the published version: %s", string(aliasJSON))
+	}
+
+	// An unchanged function keeps the published version
+	_, template = testAliasExport(t, lambdaFn.Options.Alias)
+	liveResources[versionResourceName] = liveVersion(lambdaResourceName, now.Add(-1*time.Hour))
+	unchangedResourceName, unchangedErr := addLambdaVersionResources(lambdaFn,
+		template,
+		liveResources,
+		now,
+		logger)
+	if nil != unchangedErr {
+		t.Fatal(unchangedErr)
+	}
+	if unchangedResourceName != versionResourceName {
+		t.Errorf("Expected unchanged version resource: %s != %s", unchangedResourceName, versionResourceName)
+	}
+	if _, exists := template.Resources["Version2"]; !exists {
+		t.Error("Expected the current version to be excluded from the retained count")
+	}
+	metadataJSON, _ := json.Marshal(template.Resources[versionResourceName].Metadata)
+	if !strings.Contains(string(metadataJSON), now.Add(-1*time.Hour).UTC().Format(time.RFC3339)) {
+		t.Errorf("Expected the original publish time: %s", string(metadataJSON))
+	}
+}
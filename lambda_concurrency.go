@@ -0,0 +1,172 @@
+package sparta
+
+import (
+	"fmt"
+	"time"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+// ProvisionedConcurrencyScheduledAction is a scheduled change to the
+// provisioned concurrency range. For example, a pair of actions can raise
+// the provisioned concurrency during business hours and lower it
+// afterwards.
+type ProvisionedConcurrencyScheduledAction struct {
+	// Name of the action. It must be unique within the function.
+	Name string
+	// Schedule expression. One of at(yyyy-mm-ddThh:mm:ss), rate(value unit)
+	// or cron(fields). See
+	// https://docs.aws.amazon.com/autoscaling/application/APIReference/API_PutScheduledAction.html
+	Schedule string
+	// Optional time zone of the schedule (eg, "America/New_York"). Defaults
+	// to UTC.
+	Timezone string
+	// Minimum provisioned concurrency while the action is in effect
+	MinCapacity int64
+	// Maximum provisioned concurrency while the action is in effect
+	MaxCapacity int64
+	// Optional times that the schedule starts and stops
+	StartTime *time.Time
+	EndTime   *time.Time
+}
+
+// ProvisionedConcurrencyOptions keeps a number of initialized execution
+// environments ready for the function's Alias. Provisioned concurrency
+// requires an Alias, since it can't be allocated to $LATEST.
+type ProvisionedConcurrencyOptions struct {
+	// Number of execution environments that are allocated to the alias
+	ProvisionedConcurrentExecutions int64
+	// Optional scheduled changes to the provisioned concurrency. If
+	// defined, an Application Auto Scaling scalable target is created
+	// whose capacity defaults to ProvisionedConcurrentExecutions.
+	ScheduledActions []*ProvisionedConcurrencyScheduledAction
+}
+
+func (concurrencyOptions *ProvisionedConcurrencyOptions) validate(lambdaOptions *LambdaFunctionOptions) error {
+	if nil == lambdaOptions.Alias {
+		return errors.Errorf("ProvisionedConcurrency requires an Alias")
+	}
+	if concurrencyOptions.ProvisionedConcurrentExecutions <= 0 {
+		return errors.Errorf("ProvisionedConcurrentExecutions must be greater than zero: %d",
+			concurrencyOptions.ProvisionedConcurrentExecutions)
+	}
+	reserved := lambdaOptions.ReservedConcurrentExecutions
+	if reserved != 0 && concurrencyOptions.ProvisionedConcurrentExecutions > reserved {
+		return errors.Errorf("ProvisionedConcurrentExecutions (%d) must not exceed ReservedConcurrentExecutions (%d)",
+			concurrencyOptions.ProvisionedConcurrentExecutions,
+			reserved)
+	}
+	actionNames := make(map[string]bool)
+	for _, eachAction := range concurrencyOptions.ScheduledActions {
+		if "" == eachAction.Name || "" == eachAction.Schedule {
+			return errors.Errorf("Provisioned concurrency scheduled actions must include a Name and Schedule: %#v",
+				eachAction)
+		}
+		if actionNames[eachAction.Name] {
+			return errors.Errorf("Provisioned concurrency scheduled action (%s) is defined more than once",
+				eachAction.Name)
+		}
+		actionNames[eachAction.Name] = true
+		if eachAction.MinCapacity < 0 || eachAction.MaxCapacity < eachAction.MinCapacity {
+			return errors.Errorf("Invalid capacity range for provisioned concurrency scheduled action (%s): [%d, %d]",
+				eachAction.Name,
+				eachAction.MinCapacity,
+				eachAction.MaxCapacity)
+		}
+		if reserved != 0 && eachAction.MaxCapacity > reserved {
+			return errors.Errorf("Provisioned concurrency scheduled action (%s) MaxCapacity (%d) must not exceed ReservedConcurrentExecutions (%d)",
+				eachAction.Name,
+				eachAction.MaxCapacity,
+				reserved)
+		}
+	}
+	return nil
+}
+
+// lambdaProvisionedConcurrencyConfiguration is the alias
+// ProvisionedConcurrencyConfig property
+type lambdaProvisionedConcurrencyConfiguration struct {
+	ProvisionedConcurrentExecutions *gocf.IntegerExpr `json:"ProvisionedConcurrentExecutions,omitempty"`
+}
+
+// lambdaAliasResource is an AWS::Lambda::Alias that includes the
+// ProvisionedConcurrencyConfig property, which go-cloudformation
+// doesn't support
+type lambdaAliasResource struct {
+	gocf.LambdaAlias
+	ProvisionedConcurrencyConfig *lambdaProvisionedConcurrencyConfiguration `json:"ProvisionedConcurrencyConfig,omitempty"`
+}
+
+// scheduledActionResource is a scalable target ScheduledAction. The
+// go-cloudformation type always includes the StartTime and EndTime
+// properties and doesn't support the Timezone property.
+type scheduledActionResource struct {
+	EndTime              *time.Time                                                     `json:"EndTime,omitempty"`
+	ScalableTargetAction *gocf.ApplicationAutoScalingScalableTargetScalableTargetAction `json:"ScalableTargetAction,omitempty"`
+	Schedule             *gocf.StringExpr                                               `json:"Schedule,omitempty"`
+	ScheduledActionName  *gocf.StringExpr                                               `json:"ScheduledActionName,omitempty"`
+	StartTime            *time.Time                                                     `json:"StartTime,omitempty"`
+	Timezone             *gocf.StringExpr                                               `json:"Timezone,omitempty"`
+}
+
+// scalableTargetResource is an AWS::ApplicationAutoScaling::ScalableTarget
+// with the scheduledActionResource actions
+type scalableTargetResource struct {
+	gocf.ApplicationAutoScalingScalableTarget
+	ScheduledActions []*scheduledActionResource `json:"ScheduledActions,omitempty"`
+}
+
+// exportProvisionedConcurrency configures the alias provisioned concurrency
+// and adds the optional scalable target that applies the scheduled actions
+func (info *LambdaAWSInfo) exportProvisionedConcurrency(aliasResource *lambdaAliasResource,
+	template *gocf.Template) error {
+	concurrencyOptions := info.Options.ProvisionedConcurrency
+	validateErr := concurrencyOptions.validate(info.Options)
+	if nil != validateErr {
+		return validateErr
+	}
+	provisioned := concurrencyOptions.ProvisionedConcurrentExecutions
+	aliasResource.ProvisionedConcurrencyConfig = &lambdaProvisionedConcurrencyConfiguration{
+		ProvisionedConcurrentExecutions: gocf.Integer(provisioned),
+	}
+	if len(concurrencyOptions.ScheduledActions) == 0 {
+		return nil
+	}
+	scalableTarget := &scalableTargetResource{
+		ApplicationAutoScalingScalableTarget: gocf.ApplicationAutoScalingScalableTarget{
+			MaxCapacity: gocf.Integer(provisioned),
+			MinCapacity: gocf.Integer(provisioned),
+			ResourceID: gocf.Join("",
+				gocf.String("function:"),
+				gocf.Ref(info.LogicalResourceName()),
+				gocf.String(":"),
+				gocf.String(info.Options.Alias.Name)),
+			ScalableDimension: gocf.String("lambda:function:ProvisionedConcurrency"),
+			ServiceNamespace:  gocf.String("lambda"),
+		},
+	}
+	for _, eachAction := range concurrencyOptions.ScheduledActions {
+		scheduledAction := &scheduledActionResource{
+			EndTime: eachAction.EndTime,
+			ScalableTargetAction: &gocf.ApplicationAutoScalingScalableTargetScalableTargetAction{
+				MaxCapacity: gocf.Integer(eachAction.MaxCapacity),
+				MinCapacity: gocf.Integer(eachAction.MinCapacity),
+			},
+			Schedule:            gocf.String(eachAction.Schedule),
+			ScheduledActionName: gocf.String(eachAction.Name),
+			StartTime:           eachAction.StartTime,
+		}
+		if "" != eachAction.Timezone {
+			scheduledAction.Timezone = gocf.String(eachAction.Timezone)
+		}
+		scalableTarget.ScheduledActions = append(scalableTarget.ScheduledActions, scheduledAction)
+	}
+	aliasResourceName := lambdaAliasResourceName(info.LogicalResourceName())
+	// The scalable target manages the alias provisioned concurrency, so the
+	// alias must exist first
+	cfResource := template.AddResource(fmt.Sprintf("%sScalableTarget", aliasResourceName),
+		scalableTarget)
+	cfResource.DependsOn = append(cfResource.DependsOn, aliasResourceName)
+	return nil
+}
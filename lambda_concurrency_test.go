@@ -0,0 +1,135 @@
+package sparta
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProvisionedConcurrencyExport(t *testing.T) {
+	startTime := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	lambdaFn, template, exportErr := testExportLambda(&LambdaFunctionOptions{
+		Timeout: 3,
+		Alias: &LambdaAliasOptions{
+			Name: "live",
+		},
+		ProvisionedConcurrency: &ProvisionedConcurrencyOptions{
+			ProvisionedConcurrentExecutions: 5,
+			ScheduledActions: []*ProvisionedConcurrencyScheduledAction{
+				{
+					Name:        "BusinessHours",
+					Schedule:    "cron(0 8 ? * MON-FRI *)",
+					Timezone:    "America/New_York",
+					MinCapacity: 20,
+					MaxCapacity: 20,
+					StartTime:   &startTime,
+				},
+				{
+					Name:        "AfterHours",
+					Schedule:    "cron(0 18 ? * MON-FRI *)",
+					Timezone:    "America/New_York",
+					MinCapacity: 5,
+					MaxCapacity: 5,
+				},
+			},
+		},
+	})
+	if nil != exportErr {
+		t.Fatal(exportErr)
+	}
+	aliasResourceName := lambdaAliasResourceName(lambdaFn.LogicalResourceName())
+	aliasJSON, _ := json.Marshal(template.Resources[aliasResourceName])
+	if !strings.Contains(string(aliasJSON), `"ProvisionedConcurrencyConfig":{"ProvisionedConcurrentExecutions":5}`) {
+		t.Errorf("Expected alias provisioned concurrency: %s", string(aliasJSON))
+	}
+	targetResource, targetExists := template.Resources[aliasResourceName+"ScalableTarget"]
+	if !targetExists {
+		t.Fatalf("Expected scalable target resource")
+	}
+	targetJSON, _ := json.Marshal(targetResource)
+	for _, eachExpected := range []string{
+		`"Type":"AWS::ApplicationAutoScaling::ScalableTarget"`,
+		`"DependsOn":["` + aliasResourceName + `"]`,
+		`"ScalableDimension":"lambda:function:ProvisionedConcurrency"`,
+		`"ScheduledActionName":"BusinessHours"`,
+		`"Timezone":"America/New_York"`,
+		`"StartTime":"2020-01-01T00:00:00Z"`,
+	} {
+		if !strings.Contains(string(targetJSON), eachExpected) {
+			t.Errorf("Expected scalable target to include %s: %s", eachExpected, string(targetJSON))
+		}
+	}
+	// Only the BusinessHours action has a StartTime
+	if strings.Count(string(targetJSON), `"StartTime"`) != 1 ||
+		strings.Contains(string(targetJSON), `"EndTime"`) {
+		t.Errorf("Expected optional scheduled action times: %s", string(targetJSON))
+	}
+
+	// Without scheduled actions, there's no scalable target
+	_, template, exportErr = testExportLambda(&LambdaFunctionOptions{
+		Timeout: 3,
+		Alias: &LambdaAliasOptions{
+			Name: "live",
+		},
+		ProvisionedConcurrency: &ProvisionedConcurrencyOptions{
+			ProvisionedConcurrentExecutions: 5,
+		},
+	})
+	if nil != exportErr {
+		t.Fatal(exportErr)
+	}
+	if _, targetExists := template.Resources[aliasResourceName+"ScalableTarget"]; targetExists {
+		t.Error("Unexpected scalable target resource")
+	}
+}
+
+func TestProvisionedConcurrencyValidation(t *testing.T) {
+	for _, eachInvalid := range []*LambdaFunctionOptions{
+		// No alias
+		{
+			ProvisionedConcurrency: &ProvisionedConcurrencyOptions{
+				ProvisionedConcurrentExecutions: 5,
+			},
+		},
+		// Exceeds the reserved concurrency
+		{
+			Alias:                        &LambdaAliasOptions{Name: "live"},
+			ReservedConcurrentExecutions: 2,
+			ProvisionedConcurrency: &ProvisionedConcurrencyOptions{
+				ProvisionedConcurrentExecutions: 5,
+			},
+		},
+		// Invalid capacity range
+		{
+			Alias: &LambdaAliasOptions{Name: "live"},
+			ProvisionedConcurrency: &ProvisionedConcurrencyOptions{
+				ProvisionedConcurrentExecutions: 5,
+				ScheduledActions: []*ProvisionedConcurrencyScheduledAction{
+					{
+						Name:        "Invalid",
+						Schedule:    "rate(1 day)",
+						MinCapacity: 10,
+						MaxCapacity: 5,
+					},
+				},
+			},
+		},
+		// Duplicate action names
+		{
+			Alias: &LambdaAliasOptions{Name: "live"},
+			ProvisionedConcurrency: &ProvisionedConcurrencyOptions{
+				ProvisionedConcurrentExecutions: 5,
+				ScheduledActions: []*ProvisionedConcurrencyScheduledAction{
+					{Name: "Daily", Schedule: "rate(1 day)", MaxCapacity: 5},
+					{Name: "Daily", Schedule: "rate(1 day)", MaxCapacity: 5},
+				},
+			},
+		},
+	} {
+		_, _, exportErr := testExportLambda(eachInvalid)
+		if nil == exportErr {
+			t.Errorf("Expected invalid provisioned concurrency: %#v", eachInvalid.ProvisionedConcurrency)
+		}
+	}
+}
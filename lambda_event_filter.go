@@ -0,0 +1,196 @@
+package sparta
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxEventFilterPatterns is the number of filters an EventSourceMapping
+// supports
+const maxEventFilterPatterns = 5
+
+// EventFilterMatcher is a set of values that match an event field. Create
+// matchers with the EventFilter* functions.
+type EventFilterMatcher struct {
+	values []interface{}
+	err    error
+}
+
+// EventFilterEquals matches fields that equal any of the values
+func EventFilterEquals(values ...interface{}) *EventFilterMatcher {
+	return &EventFilterMatcher{
+		values: values,
+	}
+}
+
+// EventFilterNull matches fields that are null
+func EventFilterNull() *EventFilterMatcher {
+	return &EventFilterMatcher{
+		values: []interface{}{nil},
+	}
+}
+
+// EventFilterEmpty matches fields that are the empty string
+func EventFilterEmpty() *EventFilterMatcher {
+	return EventFilterEquals("")
+}
+
+// EventFilterPrefix matches string fields that start with prefix
+func EventFilterPrefix(prefix string) *EventFilterMatcher {
+	return &EventFilterMatcher{
+		values: []interface{}{map[string]interface{}{"prefix": prefix}},
+	}
+}
+
+// EventFilterAnythingBut matches fields that don't equal any of the values
+func EventFilterAnythingBut(values ...interface{}) *EventFilterMatcher {
+	return &EventFilterMatcher{
+		values: []interface{}{map[string]interface{}{"anything-but": values}},
+	}
+}
+
+// EventFilterExists matches events that include the field if exists is
+// true, and events that don't if it's false
+func EventFilterExists(exists bool) *EventFilterMatcher {
+	return &EventFilterMatcher{
+		values: []interface{}{map[string]interface{}{"exists": exists}},
+	}
+}
+
+// EventFilterNumeric matches numeric fields that satisfy the comparison. The
+// operator is one of "=", ">", ">=", "<" or "<=".
+func EventFilterNumeric(operator string, value float64) *EventFilterMatcher {
+	return eventFilterNumeric(operator, value)
+}
+
+// EventFilterNumericRange matches numeric fields that satisfy both
+// comparisons (eg, EventFilterNumericRange(">=", 0, "<", 100)). The
+// lowerOperator is one of ">" or ">=" and the upperOperator is one of "<"
+// or "<=".
+func EventFilterNumericRange(lowerOperator string,
+	lower float64,
+	upperOperator string,
+	upper float64) *EventFilterMatcher {
+	if (">" != lowerOperator && ">=" != lowerOperator) ||
+		("<" != upperOperator && "<=" != upperOperator) {
+		return &EventFilterMatcher{
+			err: errors.Errorf("Invalid numeric range operators: %s, %s", lowerOperator, upperOperator),
+		}
+	}
+	return eventFilterNumeric(lowerOperator, lower, upperOperator, upper)
+}
+
+func eventFilterNumeric(comparisons ...interface{}) *EventFilterMatcher {
+	for index := 0; index < len(comparisons); index += 2 {
+		switch comparisons[index] {
+		case "=", ">", ">=", "<", "<=":
+		default:
+			return &EventFilterMatcher{
+				err: errors.Errorf("Invalid numeric operator: %v", comparisons[index]),
+			}
+		}
+	}
+	return &EventFilterMatcher{
+		values: []interface{}{map[string]interface{}{"numeric": comparisons}},
+	}
+}
+
+// EventFilterPattern is an EventSourceMapping filter pattern. Records
+// that match every field in the pattern are sent to the function. See
+// https://docs.aws.amazon.com/lambda/latest/dg/invocation-eventfiltering.html
+// for the record fields each event source supports. Example:
+//
+//	sparta.NewEventFilterPattern().
+//	  Field("body.Location", sparta.EventFilterEquals("New York")).
+//	  Field("body.Temperature", sparta.EventFilterNumeric(">", 90))
+type EventFilterPattern struct {
+	fields map[string]interface{}
+	err    error
+}
+
+// NewEventFilterPattern returns an empty filter pattern
+func NewEventFilterPattern() *EventFilterPattern {
+	return &EventFilterPattern{
+		fields: make(map[string]interface{}),
+	}
+}
+
+// Field adds a condition on the record field. Nested fields are separated
+// by periods (eg, "dynamodb.NewImage.Status.S"). The field matches if any
+// of the matchers match.
+func (pattern *EventFilterPattern) Field(fieldPath string, matchers ...*EventFilterMatcher) *EventFilterPattern {
+	if nil != pattern.err {
+		return pattern
+	}
+	if len(matchers) == 0 {
+		pattern.err = errors.Errorf("Event filter field (%s) requires at least one matcher", fieldPath)
+		return pattern
+	}
+	values := make([]interface{}, 0)
+	for _, eachMatcher := range matchers {
+		if nil != eachMatcher.err {
+			pattern.err = errors.Wrapf(eachMatcher.err, "Invalid event filter field: %s", fieldPath)
+			return pattern
+		}
+		values = append(values, eachMatcher.values...)
+	}
+	pathParts := strings.Split(fieldPath, ".")
+	parentFields := pattern.fields
+	for index, eachPart := range pathParts {
+		if "" == eachPart {
+			pattern.err = errors.Errorf("Invalid event filter field: %s", fieldPath)
+			return pattern
+		}
+		existing, existingOk := parentFields[eachPart]
+		if index == len(pathParts)-1 {
+			if existingOk {
+				pattern.err = errors.Errorf("Event filter field (%s) is defined more than once", fieldPath)
+				return pattern
+			}
+			parentFields[eachPart] = values
+			break
+		}
+		if !existingOk {
+			existing = make(map[string]interface{})
+			parentFields[eachPart] = existing
+		}
+		childFields, childFieldsOk := existing.(map[string]interface{})
+		if !childFieldsOk {
+			pattern.err = errors.Errorf("Event filter field (%s) conflicts with an existing field", fieldPath)
+			return pattern
+		}
+		parentFields = childFields
+	}
+	return pattern
+}
+
+// patternJSON returns the filter pattern JSON. Numeric operators aren't
+// HTML escaped, so the pattern is readable in the template.
+func (pattern *EventFilterPattern) patternJSON() (string, error) {
+	if nil != pattern.err {
+		return "", pattern.err
+	}
+	if len(pattern.fields) == 0 {
+		return "", errors.Errorf("Event filter pattern doesn't define any fields")
+	}
+	var output bytes.Buffer
+	encoder := json.NewEncoder(&output)
+	encoder.SetEscapeHTML(false)
+	encodeErr := encoder.Encode(pattern.fields)
+	if nil != encodeErr {
+		return "", encodeErr
+	}
+	return strings.TrimSpace(output.String()), nil
+}
+
+// MarshalJSON returns the filter pattern JSON
+func (pattern *EventFilterPattern) MarshalJSON() ([]byte, error) {
+	patternJSON, patternJSONErr := pattern.patternJSON()
+	if nil != patternJSONErr {
+		return nil, patternJSONErr
+	}
+	return []byte(patternJSON), nil
+}
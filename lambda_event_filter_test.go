@@ -0,0 +1,47 @@
+package sparta
+
+import (
+	"testing"
+)
+
+func TestEventFilterPattern(t *testing.T) {
+	pattern := NewEventFilterPattern().
+		Field("body.Location", EventFilterEquals("New York", "Boston")).
+		Field("body.Temperature", EventFilterNumericRange(">", 90, "<=", 120)).
+		Field("body.Sensor", EventFilterPrefix("temp-"), EventFilterNull()).
+		Field("body.Status", EventFilterAnythingBut("OFFLINE")).
+		Field("body.Alarm", EventFilterExists(true)).
+		Field("eventSource", EventFilterEquals("aws:sqs"))
+	patternJSON, patternErr := pattern.patternJSON()
+	if nil != patternErr {
+		t.Fatal(patternErr)
+	}
+	expectedJSON := `{"body":{` +
+		`"Alarm":[{"exists":true}],` +
+		`"Location":["New York","Boston"],` +
+		`"Sensor":[{"prefix":"temp-"},null],` +
+		`"Status":[{"anything-but":["OFFLINE"]}],` +
+		`"Temperature":[{"numeric":[">",90,"<=",120]}]},` +
+		`"eventSource":["aws:sqs"]}`
+	if expectedJSON != patternJSON {
+		t.Errorf("Unexpected filter pattern: %s", patternJSON)
+	}
+
+	for _, eachInvalid := range []*EventFilterPattern{
+		NewEventFilterPattern(),
+		NewEventFilterPattern().Field("body"),
+		NewEventFilterPattern().Field("body..Location", EventFilterEquals("Boston")),
+		NewEventFilterPattern().Field("body.Temperature", EventFilterNumeric("!=", 90)),
+		NewEventFilterPattern().Field("body.Temperature", EventFilterNumericRange("<", 0, ">", 90)),
+		NewEventFilterPattern().
+			Field("body", EventFilterExists(true)).
+			Field("body.Location", EventFilterEquals("Boston")),
+		NewEventFilterPattern().
+			Field("body.Location", EventFilterEquals("Boston")).
+			Field("body.Location", EventFilterEquals("New York")),
+	} {
+		if _, patternErr := eachInvalid.patternJSON(); nil == patternErr {
+			t.Errorf("Expected invalid filter pattern: %#v", eachInvalid)
+		}
+	}
+}
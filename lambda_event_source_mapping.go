@@ -0,0 +1,75 @@
+package sparta
+
+import (
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+const (
+	// maxEventSourceMappingBatchingWindow is the largest
+	// MaximumBatchingWindowInSeconds value
+	maxEventSourceMappingBatchingWindow = 300
+	// minEventSourceMappingConcurrency and maxEventSourceMappingConcurrency
+	// are the MaximumConcurrency bounds for SQS event sources
+	minEventSourceMappingConcurrency = 2
+	maxEventSourceMappingConcurrency = 1000
+	// maxEventSourceMappingParallelizationFactor is the largest number of
+	// concurrent batches per stream shard
+	maxEventSourceMappingParallelizationFactor = 10
+	// maxEventSourceMappingRetryAttempts is the largest finite
+	// MaximumRetryAttempts value
+	maxEventSourceMappingRetryAttempts = 10000
+	// minEventSourceMappingRecordAge and maxEventSourceMappingRecordAge are
+	// the finite MaximumRecordAgeInSeconds bounds
+	minEventSourceMappingRecordAge = 60
+	maxEventSourceMappingRecordAge = 604800
+	// maxEventSourceMappingTumblingWindow is the largest
+	// TumblingWindowInSeconds value
+	maxEventSourceMappingTumblingWindow = 900
+)
+
+// lambdaEventSourceMappingScalingConfig is the event source mapping
+// ScalingConfig property
+type lambdaEventSourceMappingScalingConfig struct {
+	MaximumConcurrency *gocf.IntegerExpr `json:"MaximumConcurrency,omitempty"`
+}
+
+// lambdaEventSourceMappingOnFailure is the event source mapping
+// DestinationConfig OnFailure property
+type lambdaEventSourceMappingOnFailure struct {
+	Destination *gocf.StringExpr `json:"Destination,omitempty"`
+}
+
+// lambdaEventSourceMappingDestinationConfig is the event source mapping
+// DestinationConfig property
+type lambdaEventSourceMappingDestinationConfig struct {
+	OnFailure *lambdaEventSourceMappingOnFailure `json:"OnFailure,omitempty"`
+}
+
+// lambdaEventSourceMappingFilter is an event source mapping FilterCriteria
+// filter. The Pattern is the JSON encoded filter pattern.
+type lambdaEventSourceMappingFilter struct {
+	Pattern *gocf.StringExpr `json:"Pattern,omitempty"`
+}
+
+// lambdaEventSourceMappingFilterCriteria is the event source mapping
+// FilterCriteria property
+type lambdaEventSourceMappingFilterCriteria struct {
+	Filters []*lambdaEventSourceMappingFilter `json:"Filters,omitempty"`
+}
+
+// lambdaEventSourceMappingResource is an AWS::Lambda::EventSourceMapping
+// that includes the properties go-cloudformation doesn't support
+type lambdaEventSourceMappingResource struct {
+	gocf.LambdaEventSourceMapping
+	BisectBatchOnFunctionError     *gocf.BoolExpr                             `json:"BisectBatchOnFunctionError,omitempty"`
+	DestinationConfig              *lambdaEventSourceMappingDestinationConfig `json:"DestinationConfig,omitempty"`
+	FilterCriteria                 *lambdaEventSourceMappingFilterCriteria    `json:"FilterCriteria,omitempty"`
+	FunctionResponseTypes          *gocf.StringListExpr                       `json:"FunctionResponseTypes,omitempty"`
+	MaximumBatchingWindowInSeconds *gocf.IntegerExpr                          `json:"MaximumBatchingWindowInSeconds,omitempty"`
+	MaximumRecordAgeInSeconds      *gocf.IntegerExpr                          `json:"MaximumRecordAgeInSeconds,omitempty"`
+	MaximumRetryAttempts           *gocf.IntegerExpr                          `json:"MaximumRetryAttempts,omitempty"`
+	ParallelizationFactor          *gocf.IntegerExpr                          `json:"ParallelizationFactor,omitempty"`
+	ScalingConfig                  *lambdaEventSourceMappingScalingConfig     `json:"ScalingConfig,omitempty"`
+	StartingPositionTimestamp      *gocf.IntegerExpr                          `json:"StartingPositionTimestamp,omitempty"`
+	TumblingWindowInSeconds        *gocf.IntegerExpr                          `json:"TumblingWindowInSeconds,omitempty"`
+}
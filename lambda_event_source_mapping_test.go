@@ -0,0 +1,319 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/sirupsen/logrus"
+)
+
+// testEventSourceMappingNames returns the event source mapping resource
+// names in the template
+func testEventSourceMappingNames(template *gocf.Template) []string {
+	mappingNames := make([]string, 0)
+	for eachName, eachResource := range template.Resources {
+		if "AWS::Lambda::EventSourceMapping" == eachResource.Properties.CfnResourceType() {
+			mappingNames = append(mappingNames, eachName)
+		}
+	}
+	return mappingNames
+}
+
+func TestSQSEventSourceMappingExport(t *testing.T) {
+	_, template, exportErr := testExportLambda(nil, &EventSourceMapping{
+		EventSourceArn:                 gocf.GetAtt("OrdersQueue", "Arn"),
+		BatchSize:                      100,
+		MaximumBatchingWindowInSeconds: 10,
+		MaximumConcurrency:             5,
+		ReportBatchItemFailures:        true,
+	})
+	if nil != exportErr {
+		t.Fatal(exportErr)
+	}
+	templateJSON, _ := json.Marshal(template)
+	for _, eachExpected := range []string{
+		`"Type":"AWS::Lambda::EventSourceMapping"`,
+		`"EventSourceArn":{"Fn::GetAtt":["OrdersQueue","Arn"]}`,
+		`"MaximumBatchingWindowInSeconds":10`,
+		`"ScalingConfig":{"MaximumConcurrency":5}`,
+		`"FunctionResponseTypes":["ReportBatchItemFailures"]`,
+	} {
+		if !strings.Contains(string(templateJSON), eachExpected) {
+			t.Errorf("Expected template to include %s: %s", eachExpected, string(templateJSON))
+		}
+	}
+	if strings.Contains(string(templateJSON), "StartingPosition") {
+		t.Errorf("Unexpected StartingPosition for SQS event source: %s", string(templateJSON))
+	}
+
+	for _, eachInvalid := range []*EventSourceMapping{
+		{EventSourceArn: "arn:aws:sqs:us-east-1:123456789012:orders", MaximumConcurrency: 1},
+		{EventSourceArn: "arn:aws:sqs:us-east-1:123456789012:orders", MaximumBatchingWindowInSeconds: 301},
+	} {
+		_, _, exportErr = testExportLambda(nil, eachInvalid)
+		if nil == exportErr {
+			t.Errorf("Expected invalid EventSourceMapping: %#v", eachInvalid)
+		}
+	}
+}
+
+func TestSQSEventSourceMappingPolicies(t *testing.T) {
+	logger := logrus.New()
+	template := gocf.NewTemplate()
+	template.AddResource("OrdersQueue", &gocf.SQSQueue{})
+
+	for _, eachArn := range []interface{}{
+		"arn:aws:sqs:us-east-1:123456789012:orders",
+		gocf.GetAtt("OrdersQueue", "Arn"),
+	} {
+		resource, resourceErr := resolveResourceRef(eachArn)
+		if nil != resourceErr {
+			t.Fatal(resourceErr)
+		}
+		statements, statementsErr := eventSourceMappingPoliciesForResource(resource, template, logger)
+		if nil != statementsErr {
+			t.Fatal(statementsErr)
+		}
+		statementsJSON, _ := json.Marshal(statements)
+		if !strings.Contains(string(statementsJSON), "sqs:ReceiveMessage") {
+			t.Errorf("Expected SQS policy statements for %#v: %s", eachArn, string(statementsJSON))
+		}
+	}
+
+	// The Ref is the queue URL
+	resource, _ := resolveResourceRef(gocf.Ref("OrdersQueue"))
+	_, statementsErr := eventSourceMappingPoliciesForResource(resource, template, logger)
+	if nil == statementsErr {
+		t.Error("Expected error for SQS queue Ref event source")
+	}
+}
+
+func TestStreamEventSourceMappingExport(t *testing.T) {
+	streamArn := "arn:aws:kinesis:us-east-1:123456789012:stream/Orders"
+	_, baseTemplate, exportErr := testExportLambda(nil, &EventSourceMapping{
+		StartingPosition: "TRIM_HORIZON",
+		EventSourceArn:   streamArn,
+		BatchSize:        10,
+	})
+	if nil != exportErr {
+		t.Fatal(exportErr)
+	}
+	maximumRetryAttempts := int64(0)
+	mapping := &EventSourceMapping{
+		StartingPosition:           "AT_TIMESTAMP",
+		StartingPositionTimestamp:  time.Unix(1577836800, 0),
+		EventSourceArn:             streamArn,
+		BatchSize:                  10,
+		ParallelizationFactor:      4,
+		MaximumRetryAttempts:       &maximumRetryAttempts,
+		MaximumRecordAgeInSeconds:  3600,
+		BisectBatchOnFunctionError: true,
+		OnFailureDestinationArn:    gocf.GetAtt("FailedQueue", "Arn"),
+		TumblingWindowInSeconds:    60,
+		FilterCriteria: []*EventFilterPattern{
+			NewEventFilterPattern().Field("data.status", EventFilterEquals("CREATED")),
+		},
+	}
+	_, template, exportErr := testExportLambda(nil, mapping)
+	if nil != exportErr {
+		t.Fatal(exportErr)
+	}
+	templateJSON, _ := json.Marshal(template)
+	for _, eachExpected := range []string{
+		`"StartingPosition":"AT_TIMESTAMP"`,
+		`"StartingPositionTimestamp":1577836800`,
+		`"ParallelizationFactor":4`,
+		`"MaximumRetryAttempts":0`,
+		`"MaximumRecordAgeInSeconds":3600`,
+		`"BisectBatchOnFunctionError":true`,
+		`"DestinationConfig":{"OnFailure":{"Destination":{"Fn::GetAtt":["FailedQueue","Arn"]}}}`,
+		`"TumblingWindowInSeconds":60`,
+		`"FilterCriteria":{"Filters":[{"Pattern":"{\"data\":{\"status\":[\"CREATED\"]}}"}]}`,
+	} {
+		if !strings.Contains(string(templateJSON), eachExpected) {
+			t.Errorf("Expected template to include %s: %s", eachExpected, string(templateJSON))
+		}
+	}
+
+	// Each option is reflected in the resource name
+	resourceNames := map[string]bool{}
+	for _, eachName := range testEventSourceMappingNames(baseTemplate) {
+		resourceNames[eachName] = true
+	}
+	for _, eachName := range testEventSourceMappingNames(template) {
+		resourceNames[eachName] = true
+	}
+	mapping.FilterCriteria = []*EventFilterPattern{
+		NewEventFilterPattern().Field("data.status", EventFilterEquals("DELETED")),
+	}
+	_, template, exportErr = testExportLambda(nil, mapping)
+	if nil != exportErr {
+		t.Fatal(exportErr)
+	}
+	for _, eachName := range testEventSourceMappingNames(template) {
+		resourceNames[eachName] = true
+	}
+	if len(resourceNames) != 3 {
+		t.Errorf("Expected unique EventSourceMapping names: %#v", resourceNames)
+	}
+
+	invalidRetryAttempts := int64(-2)
+	for _, eachInvalid := range []*EventSourceMapping{
+		{StartingPosition: "AT_TIMESTAMP", EventSourceArn: streamArn},
+		{StartingPosition: "LATEST", StartingPositionTimestamp: time.Now(), EventSourceArn: streamArn},
+		{StartingPosition: "LATEST", EventSourceArn: streamArn, ParallelizationFactor: 11},
+		{StartingPosition: "LATEST", EventSourceArn: streamArn, MaximumRetryAttempts: &invalidRetryAttempts},
+		{StartingPosition: "LATEST", EventSourceArn: streamArn, MaximumRecordAgeInSeconds: 30},
+		{StartingPosition: "LATEST", EventSourceArn: streamArn, TumblingWindowInSeconds: 901},
+		{StartingPosition: "LATEST", EventSourceArn: streamArn, FilterCriteria: []*EventFilterPattern{
+			NewEventFilterPattern(),
+		}},
+	} {
+		_, _, exportErr = testExportLambda(nil, eachInvalid)
+		if nil == exportErr {
+			t.Errorf("Expected invalid EventSourceMapping: %#v", eachInvalid)
+		}
+	}
+}
+
+func TestEventSourceMappingDestinationPolicies(t *testing.T) {
+	logger := logrus.New()
+	template := gocf.NewTemplate()
+	template.AddResource("FailedQueue", &gocf.SQSQueue{})
+	template.AddResource("FailedTopic", &gocf.SNSTopic{})
+	template.AddResource("FailedStream", &gocf.KinesisStream{})
+
+	for eachArn, eachExpected := range map[interface{}]string{
+		"arn:aws:sqs:us-east-1:123456789012:failed": "sqs:SendMessage",
+		"arn:aws:sns:us-east-1:123456789012:failed": "sns:Publish",
+		gocf.GetAtt("FailedQueue", "Arn"):           "sqs:SendMessage",
+		gocf.Ref("FailedTopic"):                     "sns:Publish",
+	} {
+		resource, _ := resolveResourceRef(eachArn)
+		statements, statementsErr := eventSourceMappingDestinationPoliciesForResource(resource, template, logger)
+		if nil != statementsErr {
+			t.Fatal(statementsErr)
+		}
+		statementsJSON, _ := json.Marshal(statements)
+		if !strings.Contains(string(statementsJSON), eachExpected) {
+			t.Errorf("Expected %s policy statement: %s", eachExpected, string(statementsJSON))
+		}
+	}
+	for _, eachInvalid := range []interface{}{
+		"arn:aws:kinesis:us-east-1:123456789012:stream/failed",
+		gocf.Ref("FailedQueue"),
+		gocf.GetAtt("FailedStream", "Arn"),
+	} {
+		resource, _ := resolveResourceRef(eachInvalid)
+		_, statementsErr := eventSourceMappingDestinationPoliciesForResource(resource, template, logger)
+		if nil == statementsErr {
+			t.Errorf("Expected invalid on-failure destination: %#v", eachInvalid)
+		}
+	}
+}
+
+func TestSQSEventSourceMappingName(t *testing.T) {
+	mapping := &EventSourceMapping{
+		EventSourceArn:          "arn:aws:sqs:us-east-1:123456789012:orders",
+		BatchSize:               10,
+		MaximumConcurrency:      5,
+		ReportBatchItemFailures: true,
+	}
+	functionArn := "arn:aws:lambda:us-east-1:123456789012:function:orders"
+	template := gocf.NewTemplate()
+	exportErr := mapping.export("TestExportService",
+		"main.orders",
+		gocf.String(functionArn),
+		"artifacts",
+		"TestExportService/code.zip",
+		template,
+		logrus.New())
+	if nil != exportErr {
+		t.Fatal(exportErr)
+	}
+	// The resource name must not change for existing SQS mappings
+	hash := sha1.New()
+	for _, eachHashPart := range []string{
+		"main.orders",
+		"arn:aws:sqs:us-east-1:123456789012:orders",
+		functionArn,
+		"10",
+		"",
+		"MaximumConcurrency:5",
+		"ReportBatchItemFailures",
+	} {
+		hash.Write([]byte(eachHashPart))
+	}
+	expectedName := "LambdaES" + hex.EncodeToString(hash.Sum(nil))
+	if _, exists := template.Resources[expectedName]; !exists {
+		t.Errorf("Expected EventSourceMapping %s: %v", expectedName, testEventSourceMappingNames(template))
+	}
+}
+
+func TestEventSourceMappingTypePolicies(t *testing.T) {
+	importedArn := ImportServiceValue("OrdersService", "OrdersQueueArn")
+	_, _, exportErr := testExportLambda(nil, &EventSourceMapping{
+		EventSourceArn:  importedArn,
+		EventSourceType: "mq",
+	})
+	if nil == exportErr {
+		t.Error("Expected error for invalid EventSourceType")
+	}
+
+	for eachType, eachExpected := range map[string]string{
+		"":                      "",
+		EventSourceTypeSQS:      "sqs:ReceiveMessage",
+		EventSourceTypeKinesis:  "kinesis:GetRecords",
+		EventSourceTypeDynamoDB: "dynamodb:GetRecords",
+	} {
+		lambdaFn := HandleAWSLambda("TestExport", testExportHandler, "TestRole")
+		lambdaFn.EventSourceMappings = append(lambdaFn.EventSourceMappings,
+			&EventSourceMapping{
+				EventSourceArn:  importedArn,
+				EventSourceType: eachType,
+			})
+		template := gocf.NewTemplate()
+		template.AddResource("TestRole", gocf.IAMRole{
+			Policies: &gocf.IAMRolePolicyList{},
+		})
+		exportErr := lambdaFn.export("TestExportService",
+			"bootstrap",
+			"artifacts",
+			"TestExportService/code.zip",
+			"",
+			"testBuildID",
+			map[string]*gocf.StringExpr{"TestRole": gocf.GetAtt("TestRole", "Arn")},
+			template,
+			nil,
+			logrus.New())
+		if nil != exportErr {
+			t.Fatal(exportErr)
+		}
+		annotateErr := annotateEventSourceMappings([]*LambdaAWSInfo{lambdaFn},
+			template,
+			logrus.New())
+		if nil != annotateErr {
+			t.Fatal(annotateErr)
+		}
+		policiesJSON, _ := json.Marshal(template.Resources["TestRole"].Properties)
+		if "" == eachExpected {
+			if strings.Contains(string(policiesJSON), "LambdaEventSourceMappingPolicy") {
+				t.Errorf("Unexpected policy for untyped imported event source: %s", string(policiesJSON))
+			}
+			continue
+		}
+		if !strings.Contains(string(policiesJSON), eachExpected) ||
+			!strings.Contains(string(policiesJSON), `"Resource":{"Fn::ImportValue":"OrdersService-OrdersQueueArn"}`) {
+			t.Errorf("Expected %s policy statement for imported event source: %s",
+				eachExpected,
+				string(policiesJSON))
+		}
+	}
+}
@@ -96,7 +96,7 @@ func (perm BasePermission) export(principal *gocf.StringExpr,
 
 	lambdaPermission := gocf.LambdaPermission{
 		Action:       gocf.String("lambda:InvokeFunction"),
-		FunctionName: gocf.GetAtt(lambdaLogicalCFResourceName, "Arn"),
+		FunctionName: lambdaFunctionArn(template, lambdaLogicalCFResourceName),
 		Principal:    principal,
 	}
 	// If the Arn isn't the wildcard value, then include it.
@@ -207,7 +207,7 @@ func (perm S3Permission) export(serviceName string,
 	}
 	s3Resource.ServiceToken = gocf.GetAtt(configuratorResName, "Arn")
 	s3Resource.BucketArn = sourceArnExpression
-	s3Resource.LambdaTargetArn = gocf.GetAtt(lambdaLogicalCFResourceName, "Arn")
+	s3Resource.LambdaTargetArn = lambdaFunctionArn(template, lambdaLogicalCFResourceName)
 	s3Resource.Events = perm.Events
 	if nil != perm.Filter.Key {
 		s3Resource.Filter = &perm.Filter
@@ -302,7 +302,7 @@ func (perm SNSPermission) export(serviceName string,
 	}
 	customResource := newResource.(*cfCustomResources.SNSLambdaEventSourceResource)
 	customResource.ServiceToken = gocf.GetAtt(configuratorResName, "Arn")
-	customResource.LambdaTargetArn = gocf.GetAtt(lambdaLogicalCFResourceName, "Arn")
+	customResource.LambdaTargetArn = lambdaFunctionArn(template, lambdaLogicalCFResourceName)
 	customResource.SNSTopicArn = sourceArnExpression
 
 	// Name?
@@ -671,7 +671,7 @@ func (perm SESPermission) export(serviceName string,
 	for _, eachReceiptRule := range perm.ReceiptRules {
 		sesRules = append(sesRules, eachReceiptRule.toResourceRule(
 			serviceName,
-			gocf.GetAtt(lambdaLogicalCFResourceName, "Arn"),
+			lambdaFunctionArn(template, lambdaLogicalCFResourceName),
 			perm.MessageBodyStorage))
 	}
 	customResource.Rules = sesRules
@@ -842,7 +842,7 @@ func (perm CloudWatchEventsPermission) export(serviceName string,
 		cwEventsRuleTargetList := gocf.EventsRuleTargetList{}
 		cwEventsRuleTargetList = append(cwEventsRuleTargetList,
 			gocf.EventsRuleTarget{
-				Arn: gocf.GetAtt(lambdaLogicalCFResourceName, "Arn"),
+				Arn: lambdaFunctionArn(template, lambdaLogicalCFResourceName),
 				ID:  gocf.String(uniqueRuleName),
 			},
 		)
@@ -1021,7 +1021,7 @@ func (perm CloudWatchLogsPermission) export(serviceName string,
 	}
 	customResource := newResource.(*cfCustomResources.CloudWatchLogsLambdaEventSourceResource)
 	customResource.ServiceToken = gocf.GetAtt(configurationResourceName, "Arn")
-	customResource.LambdaTargetArn = gocf.GetAtt(lambdaLogicalCFResourceName, "Arn")
+	customResource.LambdaTargetArn = lambdaFunctionArn(template, lambdaLogicalCFResourceName)
 	// Build up the filters...
 	customResource.Filters = make([]*cfCustomResources.CloudWatchLogsLambdaEventSourceFilter, 0)
 	for eachName, eachFilter := range globallyUniqueFilters {
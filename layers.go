@@ -0,0 +1,141 @@
+package sparta
+
+import (
+	"fmt"
+	"regexp"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+// maxLambdaLayers is the maximum number of layers a function may use
+const maxLambdaLayers = 5
+
+// reLambdaLayerName is the set of valid LambdaLayer names, which are
+// also used to create the logical resource name
+var reLambdaLayerName = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+// LambdaLayer is a service level AWS Lambda layer that's packaged from a
+// local directory. The directory contents are archived, uploaded to the
+// service's S3 bucket and published as an AWS::Lambda::LayerVersion.
+// Each layer version is identified by the hash of its archive, so a new
+// version is only published when the directory contents change. A
+// LambdaLayer is included in a function by adding it to the
+// LambdaFunctionOptions.Layers slice. Functions that include the same
+// LambdaLayer share the layer version.
+type LambdaLayer struct {
+	// Name of the layer. It must be alphanumeric and unique within the
+	// service. The published layer name is prefixed with the service name.
+	Name string
+	// SourcePath is the local directory whose contents are archived. The
+	// paths in the archive are relative to this directory, so it should
+	// use the /opt layout that the function expects (eg, bin/, lib/).
+	SourcePath string
+	// Optional layer description
+	Description string
+	// Optional license information for the layer
+	LicenseInfo string
+	// Optional runtimes the layer is compatible with. Defaults to
+	// the Sparta Go runtime.
+	CompatibleRuntimes []string
+
+	// Local archive and its content hash, which are set when the
+	// service is packaged
+	archivePath string
+	contentHash string
+}
+
+// NewLambdaLayer returns a LambdaLayer that archives the contents of
+// the sourcePath directory
+func NewLambdaLayer(name string, sourcePath string) *LambdaLayer {
+	return &LambdaLayer{
+		Name:       name,
+		SourcePath: sourcePath,
+	}
+}
+
+// LogicalResourceName returns the CloudFormation logical resource name of
+// the layer version. The name includes the content hash s.t. a new layer
+// version is published whenever the layer contents change.
+func (layer *LambdaLayer) LogicalResourceName() string {
+	return CloudFormationResourceName(fmt.Sprintf("%sLayer", layer.Name),
+		layer.contentHash)
+}
+
+// String returns the Ref to the layer version, which is the layer
+// version ARN. It satisfies the gocf.Stringable interface so that a
+// LambdaLayer can be included in LambdaFunctionOptions.Layers.
+func (layer *LambdaLayer) String() *gocf.StringExpr {
+	return gocf.Ref(layer.LogicalResourceName()).String()
+}
+
+func (layer *LambdaLayer) validate() error {
+	if !reLambdaLayerName.MatchString(layer.Name) {
+		return errors.Errorf("Invalid LambdaLayer name (%s). Names must be alphanumeric",
+			layer.Name)
+	}
+	if "" == layer.SourcePath {
+		return errors.Errorf("LambdaLayer (%s) must include the SourcePath", layer.Name)
+	}
+	return nil
+}
+
+// lambdaLayerVersionContent is the location of the layer archive
+type lambdaLayerVersionContent struct {
+	S3Bucket        *gocf.StringExpr `json:"S3Bucket,omitempty"`
+	S3Key           *gocf.StringExpr `json:"S3Key,omitempty"`
+	S3ObjectVersion *gocf.StringExpr `json:"S3ObjectVersion,omitempty"`
+}
+
+// lambdaLayerVersion is the AWS::Lambda::LayerVersion resource, which
+// go-cloudformation doesn't support
+type lambdaLayerVersion struct {
+	CompatibleRuntimes *gocf.StringListExpr       `json:"CompatibleRuntimes,omitempty"`
+	Content            *lambdaLayerVersionContent `json:"Content,omitempty"`
+	Description        *gocf.StringExpr           `json:"Description,omitempty"`
+	LayerName          *gocf.StringExpr           `json:"LayerName,omitempty"`
+	LicenseInfo        *gocf.StringExpr           `json:"LicenseInfo,omitempty"`
+}
+
+// CfnResourceType returns AWS::Lambda::LayerVersion to implement the
+// gocf.ResourceProperties interface
+func (layerVersion lambdaLayerVersion) CfnResourceType() string {
+	return "AWS::Lambda::LayerVersion"
+}
+
+// lambdaFunctionResource is an AWS::Lambda::Function that includes the
+// Layers property, which go-cloudformation doesn't support. It's only
+// used for functions with layers so that other functions are still
+// gocf.LambdaFunction values.
+type lambdaFunctionResource struct {
+	gocf.LambdaFunction
+	Layers *gocf.StringListExpr `json:"Layers,omitempty"`
+}
+
+// lambdaFunctionProperties returns the gocf.LambdaFunction for the
+// properties of a resource created by LambdaAWSInfo.export
+func lambdaFunctionProperties(properties gocf.ResourceProperties) (gocf.LambdaFunction, bool) {
+	switch typedProperties := properties.(type) {
+	case gocf.LambdaFunction:
+		return typedProperties, true
+	case lambdaFunctionResource:
+		return typedProperties.LambdaFunction, true
+	default:
+		return gocf.LambdaFunction{}, false
+	}
+}
+
+// lambdaLayersList returns the Layers property value for the layers
+func lambdaLayersList(layers []gocf.Stringable) (*gocf.StringListExpr, error) {
+	if len(layers) > maxLambdaLayers {
+		return nil, errors.Errorf("Lambda functions may include at most %d layers, found: %d",
+			maxLambdaLayers,
+			len(layers))
+	}
+	for eachIndex, eachLayer := range layers {
+		if nil == eachLayer {
+			return nil, errors.Errorf("Layer at index %d is nil", eachIndex)
+		}
+	}
+	return gocf.StringList(layers...), nil
+}
@@ -0,0 +1,166 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	spartaZip "github.com/mweagle/Sparta/zip"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// serviceLambdaLayers returns the distinct LambdaLayers that the service's
+// functions include
+func serviceLambdaLayers(lambdaAWSInfos []*LambdaAWSInfo) ([]*LambdaLayer, error) {
+	layers := make([]*LambdaLayer, 0)
+	layerNames := make(map[string]*LambdaLayer)
+	for _, eachLambda := range lambdaAWSInfos {
+		if nil == eachLambda.Options {
+			continue
+		}
+		for _, eachLayer := range eachLambda.Options.Layers {
+			layer, layerOk := eachLayer.(*LambdaLayer)
+			if !layerOk || nil == layer {
+				continue
+			}
+			existingLayer, exists := layerNames[layer.Name]
+			if exists {
+				if existingLayer != layer {
+					return nil, errors.Errorf("LambdaLayer name (%s) is used by more than one layer",
+						layer.Name)
+				}
+				continue
+			}
+			validateErr := layer.validate()
+			if nil != validateErr {
+				return nil, validateErr
+			}
+			layerNames[layer.Name] = layer
+			layers = append(layers, layer)
+		}
+	}
+	return layers, nil
+}
+
+// createLambdaLayerArchive creates the ZIP archive of the layer's
+// SourcePath and records the archive's content hash
+func createLambdaLayerArchive(layer *LambdaLayer, ctx *workflowContext) error {
+	defer recordDuration(time.Now(), fmt.Sprintf("Creating %s layer archive", layer.Name), ctx)
+
+	absSourcePath, absSourcePathErr := filepath.Abs(layer.SourcePath)
+	if nil != absSourcePathErr {
+		return errors.Wrapf(absSourcePathErr, "Failed to get absolute filepath")
+	}
+	sourceInfo, sourceInfoErr := os.Stat(absSourcePath)
+	if nil != sourceInfoErr {
+		return errors.Wrapf(sourceInfoErr, "Failed to read LambdaLayer (%s) SourcePath", layer.Name)
+	}
+	if !sourceInfo.IsDir() {
+		return errors.Errorf("LambdaLayer (%s) SourcePath must be a directory: %s",
+			layer.Name,
+			layer.SourcePath)
+	}
+	tempName := fmt.Sprintf("%s-%s-layer.zip", sanitizedName(ctx.userdata.serviceName), layer.Name)
+	tmpFile, tmpFileErr := temporaryFile(tempName)
+	if nil != tmpFileErr {
+		return errors.Wrapf(tmpFileErr, "Failed to create temporary layer archive file")
+	}
+	ctx.logger.WithFields(logrus.Fields{
+		"Layer":      layer.Name,
+		"TempName":   relativePath(tmpFile.Name()),
+		"SourcePath": absSourcePath,
+	}).Info("Creating layer ZIP archive for upload")
+
+	layerArchive := zip.NewWriter(tmpFile)
+	// The layer version is identified by the archive hash, so the
+	// entry timestamps must not depend on the source file times
+	fileHeaderAnnotator := func(header *zip.FileHeader) (*zip.FileHeader, error) {
+		header.Modified = codeArchiveModTime
+		return header, nil
+	}
+	addErr := spartaZip.AnnotateAddToZip(layerArchive,
+		absSourcePath,
+		absSourcePath,
+		fileHeaderAnnotator,
+		ctx.logger)
+	if nil != addErr {
+		return addErr
+	}
+	archiveCloseErr := layerArchive.Close()
+	if nil != archiveCloseErr {
+		return archiveCloseErr
+	}
+	tempfileCloseErr := tmpFile.Close()
+	if nil != tempfileCloseErr {
+		return tempfileCloseErr
+	}
+	contentHash, contentHashErr := fileContentHash(tmpFile.Name())
+	if nil != contentHashErr {
+		return contentHashErr
+	}
+	layer.archivePath = tmpFile.Name()
+	layer.contentHash = contentHash
+	return nil
+}
+
+// exportLambdaLayers adds the AWS::Lambda::LayerVersion resources for the
+// uploaded layer archives
+func exportLambdaLayers(ctx *workflowContext) error {
+	for eachLayer, eachUploadURL := range ctx.context.lambdaLayerURLs {
+		runtimes := eachLayer.CompatibleRuntimes
+		if len(runtimes) == 0 {
+			runtimes = []string{GoLambdaVersion}
+		}
+		runtimeList := make([]gocf.Stringable, len(runtimes))
+		for eachIndex, eachRuntime := range runtimes {
+			runtimeList[eachIndex] = gocf.String(eachRuntime)
+		}
+		layerVersion := lambdaLayerVersion{
+			CompatibleRuntimes: gocf.StringList(runtimeList...),
+			Content: &lambdaLayerVersionContent{
+				S3Bucket: gocf.String(ctx.userdata.s3Bucket),
+				S3Key:    gocf.String(eachUploadURL.keyName()),
+			},
+			LayerName: gocf.String(fmt.Sprintf("%s-%s",
+				sanitizedName(ctx.userdata.serviceName),
+				eachLayer.Name)),
+		}
+		if "" != eachUploadURL.version {
+			layerVersion.Content.S3ObjectVersion = gocf.String(eachUploadURL.version)
+		}
+		if "" != eachLayer.Description {
+			layerVersion.Description = gocf.String(eachLayer.Description)
+		}
+		if "" != eachLayer.LicenseInfo {
+			layerVersion.LicenseInfo = gocf.String(eachLayer.LicenseInfo)
+		}
+		logicalName := eachLayer.LogicalResourceName()
+		if _, exists := ctx.context.cfTemplate.Resources[logicalName]; exists {
+			return errors.Errorf("LambdaLayer (%s) resource has already been defined", eachLayer.Name)
+		}
+		ctx.context.cfTemplate.AddResource(logicalName, layerVersion)
+		ctx.logger.WithFields(logrus.Fields{
+			"Layer":       eachLayer.Name,
+			"Resource":    logicalName,
+			"ContentHash": eachLayer.contentHash,
+		}).Debug("Exported layer version")
+	}
+	return nil
+}
+
+// lambdaLayerURLs returns the sorted S3 URLs of the uploaded layer archives
+func lambdaLayerURLs(ctx *workflowContext) []string {
+	layerURLs := make([]string, 0)
+	for _, eachUploadURL := range ctx.context.lambdaLayerURLs {
+		layerURLs = append(layerURLs, eachUploadURL.location)
+	}
+	sort.Strings(layerURLs)
+	return layerURLs
+}
@@ -0,0 +1,135 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/sirupsen/logrus"
+)
+
+func TestServiceLambdaLayers(t *testing.T) {
+	sharedLayer := NewLambdaLayer("Shared", "./layers/shared")
+	lambdaFn1 := HandleAWSLambda("Layer1", testExportHandler, LambdaExecuteARN)
+	lambdaFn1.Options.Layers = []gocf.Stringable{sharedLayer,
+		gocf.String("arn:aws:lambda:us-east-1:123456789012:layer:tools:3")}
+	lambdaFn2 := HandleAWSLambda("Layer2", testExportHandler, LambdaExecuteARN)
+	lambdaFn2.Options.Layers = []gocf.Stringable{sharedLayer}
+
+	layers, layersErr := serviceLambdaLayers([]*LambdaAWSInfo{lambdaFn1, lambdaFn2})
+	if nil != layersErr {
+		t.Fatal(layersErr)
+	}
+	if len(layers) != 1 || sharedLayer != layers[0] {
+		t.Errorf("Expected a single shared layer: %#v", layers)
+	}
+
+	lambdaFn2.Options.Layers = []gocf.Stringable{NewLambdaLayer("Shared", "./layers/other")}
+	_, layersErr = serviceLambdaLayers([]*LambdaAWSInfo{lambdaFn1, lambdaFn2})
+	if nil == layersErr {
+		t.Error("Expected error for duplicate layer names")
+	}
+	lambdaFn2.Options.Layers = []gocf.Stringable{NewLambdaLayer("Shared-Layer", "./layers/other")}
+	_, layersErr = serviceLambdaLayers([]*LambdaAWSInfo{lambdaFn2})
+	if nil == layersErr {
+		t.Error("Expected error for invalid layer name")
+	}
+}
+
+func TestLambdaLayerArchive(t *testing.T) {
+	sourcePath, sourcePathErr := ioutil.TempDir("", "layer")
+	if nil != sourcePathErr {
+		t.Fatal(sourcePathErr)
+	}
+	defer os.RemoveAll(sourcePath)
+	binPath := filepath.Join(sourcePath, "bin")
+	os.MkdirAll(binPath, os.ModePerm)
+	toolPath := filepath.Join(binPath, "tool")
+	writeErr := ioutil.WriteFile(toolPath, []byte("#!/bin/sh\necho layer\n"), 0755)
+	if nil != writeErr {
+		t.Fatal(writeErr)
+	}
+	ctx := &workflowContext{
+		logger: logrus.New(),
+	}
+	ctx.userdata.serviceName = "LayerService"
+
+	layer := NewLambdaLayer("Tools", sourcePath)
+	archiveErr := createLambdaLayerArchive(layer, ctx)
+	if nil != archiveErr {
+		t.Fatal(archiveErr)
+	}
+	defer os.Remove(layer.archivePath)
+	contentHash := layer.contentHash
+	logicalName := layer.LogicalResourceName()
+
+	// Touching the source files must not publish a new layer version
+	modTime := time.Now().Add(time.Hour)
+	os.Chtimes(toolPath, modTime, modTime)
+	archiveErr = createLambdaLayerArchive(layer, ctx)
+	if nil != archiveErr {
+		t.Fatal(archiveErr)
+	}
+	if contentHash != layer.contentHash || logicalName != layer.LogicalResourceName() {
+		t.Errorf("Expected unchanged layer hash: %s != %s", contentHash, layer.contentHash)
+	}
+	writeErr = ioutil.WriteFile(toolPath, []byte("#!/bin/sh\necho updated\n"), 0755)
+	if nil != writeErr {
+		t.Fatal(writeErr)
+	}
+	archiveErr = createLambdaLayerArchive(layer, ctx)
+	if nil != archiveErr {
+		t.Fatal(archiveErr)
+	}
+	if logicalName == layer.LogicalResourceName() {
+		t.Error("Expected a new layer version for updated contents")
+	}
+}
+
+func TestExportLambdaLayers(t *testing.T) {
+	layer := NewLambdaLayer("Tools", "./layers/tools")
+	layer.contentHash = "abc123"
+	lambdaFn, template, exportErr := testExportLambda(&LambdaFunctionOptions{
+		Layers: []gocf.Stringable{layer,
+			gocf.String("arn:aws:lambda:us-east-1:123456789012:layer:tools:3")},
+	})
+	if nil != exportErr {
+		t.Fatal(exportErr)
+	}
+
+	ctx := &workflowContext{
+		logger: logrus.New(),
+	}
+	ctx.userdata.serviceName = "LayerService"
+	ctx.userdata.s3Bucket = "artifacts"
+	ctx.context.cfTemplate = template
+	ctx.context.lambdaLayerURLs = map[*LambdaLayer]*s3UploadURL{
+		layer: newS3UploadURL("https://artifacts.s3.amazonaws.com/LayerService/LayerService-Tools-layer-abc123.zip"),
+	}
+	exportErr = exportLambdaLayers(ctx)
+	if nil != exportErr {
+		t.Fatal(exportErr)
+	}
+	templateJSON, _ := json.Marshal(ctx.context.cfTemplate)
+	for _, eachExpected := range []string{
+		`"Type":"AWS::Lambda::LayerVersion"`,
+		`"LayerName":"LayerService-Tools"`,
+		`"S3Key":"LayerService/LayerService-Tools-layer-abc123.zip"`,
+		`"Layers":[{"Ref":"` + layer.LogicalResourceName() + `"},"arn:aws:lambda:us-east-1:123456789012:layer:tools:3"]`,
+	} {
+		if !strings.Contains(string(templateJSON), eachExpected) {
+			t.Errorf("Expected template to include %s: %s", eachExpected, string(templateJSON))
+		}
+	}
+	lambdaResource := ctx.context.cfTemplate.Resources[lambdaFn.LogicalResourceName()]
+	if _, lambdaOk := lambdaFunctionProperties(lambdaResource.Properties); !lambdaOk {
+		t.Errorf("Expected Lambda function properties: %T", lambdaResource.Properties)
+	}
+}
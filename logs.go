@@ -0,0 +1,286 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Terminal color codes used to highlight log levels
+const (
+	logColorRed    = 31
+	logColorYellow = 33
+	logColorBlue   = 36
+	logColorGray   = 37
+)
+
+// How often the log groups are polled when following
+var logsPollingInterval = 5 * time.Second
+
+// deployedFunction is the deployed physical name of a
+// service function
+type deployedFunction struct {
+	functionName string
+	physicalName string
+	// qualifier is the alias that's invoked in place of $LATEST
+	qualifier string
+}
+
+func (target *deployedFunction) logGroupName() string {
+	return fmt.Sprintf("/aws/lambda/%s", target.physicalName)
+}
+
+// deployedFunctions returns the deployed functions for the stack. If
+// functionName is non-empty, only the matching function is returned.
+func deployedFunctions(stackName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	functionName string) ([]*deployedFunction, error) {
+
+	targets := make([]*deployedFunction, 0)
+	allNames := make([]string, 0)
+	appendTarget := func(internalName string, logicalName string, qualifier string) {
+		allNames = append(allNames, internalName)
+		if "" != functionName &&
+			functionName != internalName &&
+			functionName != awsLambdaInternalName(internalName) &&
+			functionName != logicalName {
+			return
+		}
+		targets = append(targets, &deployedFunction{
+			functionName: internalName,
+			physicalName: awsLambdaPhysicalName(stackName, internalName),
+			qualifier:    qualifier,
+		})
+	}
+	for _, eachLambdaInfo := range lambdaAWSInfos {
+		qualifier := ""
+		if nil != eachLambdaInfo.Options && nil != eachLambdaInfo.Options.Alias {
+			qualifier = eachLambdaInfo.Options.Alias.Name
+		}
+		appendTarget(eachLambdaInfo.lambdaFunctionName(), eachLambdaInfo.LogicalResourceName(), qualifier)
+		for _, eachCustomResource := range eachLambdaInfo.customResources {
+			appendTarget(eachCustomResource.userFunctionName, eachCustomResource.logicalName(), "")
+		}
+	}
+	if len(targets) <= 0 {
+		return nil, errors.Errorf("Unknown function: %s. Known: %s",
+			functionName,
+			strings.Join(allNames, ", "))
+	}
+	return targets, nil
+}
+
+func colorizeLogText(text string, color int, enableColors bool) string {
+	if !enableColors {
+		return text
+	}
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, text)
+}
+
+// formatLogMessage returns a readable version of a single CloudWatch Logs
+// message. Messages that were written by the logrus JSONFormatter, including
+// the reqID, arn, and build fields added by tappedHandler, are expanded
+// into a single line. All other messages are returned as-is.
+func formatLogMessage(functionName string, message string, enableColors bool) string {
+	message = strings.TrimRight(message, "\r\n")
+	trimmed := strings.TrimSpace(message)
+	prefix := colorizeLogText(fmt.Sprintf("[%s]", functionName), logColorGray, enableColors)
+	if !strings.HasPrefix(trimmed, "{") {
+		return fmt.Sprintf("%s %s", prefix, message)
+	}
+	fields := make(map[string]interface{})
+	if nil != json.Unmarshal([]byte(trimmed), &fields) {
+		return fmt.Sprintf("%s %s", prefix, message)
+	}
+	level, _ := fields["level"].(string)
+	msg, _ := fields["msg"].(string)
+	timestamp, _ := fields["time"].(string)
+	reqID, _ := fields["reqID"].(string)
+	build, _ := fields["build"].(string)
+	for _, eachKey := range []string{"level", "msg", "time", "reqID", "arn", "build"} {
+		delete(fields, eachKey)
+	}
+
+	levelColor := logColorBlue
+	switch level {
+	case "panic", "fatal", "error":
+		levelColor = logColorRed
+	case "warning", "warn":
+		levelColor = logColorYellow
+	case "debug":
+		levelColor = logColorGray
+	}
+	levelText := colorizeLogText(fmt.Sprintf("%-7s", strings.ToUpper(level)), levelColor, enableColors)
+
+	var output strings.Builder
+	if "" != timestamp {
+		fmt.Fprintf(&output, "%s ", timestamp)
+	}
+	fmt.Fprintf(&output, "%s %s", levelText, prefix)
+	if "" != reqID {
+		fmt.Fprintf(&output, " %s", colorizeLogText(reqID, logColorGray, enableColors))
+	}
+	if "" != build {
+		fmt.Fprintf(&output, " (build: %s)", build)
+	}
+	fmt.Fprintf(&output, " %s", msg)
+
+	remainingKeys := make([]string, 0)
+	for eachKey := range fields {
+		remainingKeys = append(remainingKeys, eachKey)
+	}
+	sort.Strings(remainingKeys)
+	for _, eachKey := range remainingKeys {
+		fmt.Fprintf(&output, " %s=%v",
+			colorizeLogText(eachKey, levelColor, enableColors),
+			fields[eachKey])
+	}
+	return output.String()
+}
+
+// isTerminal returns true iff the writer is a character device
+func isTerminal(writer io.Writer) bool {
+	file, fileOk := writer.(*os.File)
+	if !fileOk {
+		return false
+	}
+	stat, statErr := file.Stat()
+	return nil == statErr && (stat.Mode()&os.ModeCharDevice) != 0
+}
+
+// logEvent is a CloudWatch Logs event tagged with the function
+// that produced it
+type logEvent struct {
+	functionName string
+	event        *cloudwatchlogs.FilteredLogEvent
+}
+
+// fetchLogEvents returns the events in the target log groups
+// that occurred at or after startTime
+func fetchLogEvents(awsSession *session.Session,
+	targets []*deployedFunction,
+	startTime time.Time,
+	filterPattern string,
+	logger *logrus.Logger) ([]*logEvent, error) {
+
+	events := make([]*logEvent, 0)
+	logsSvc := cloudwatchlogs.New(awsSession)
+	for _, eachTarget := range targets {
+		filterInput := &cloudwatchlogs.FilterLogEventsInput{
+			LogGroupName: aws.String(eachTarget.logGroupName()),
+			StartTime:    aws.Int64(startTime.UnixNano() / int64(time.Millisecond)),
+			Interleaved:  aws.Bool(true),
+		}
+		if "" != filterPattern {
+			filterInput.FilterPattern = aws.String(filterPattern)
+		}
+		target := eachTarget
+		filterErr := logsSvc.FilterLogEventsPages(filterInput,
+			func(page *cloudwatchlogs.FilterLogEventsOutput, lastPage bool) bool {
+				for _, eachEvent := range page.Events {
+					events = append(events, &logEvent{
+						functionName: target.functionName,
+						event:        eachEvent,
+					})
+				}
+				return true
+			})
+		if nil != filterErr {
+			// The log group isn't created until the function is first invoked
+			awsErr, awsErrOk := filterErr.(awserr.Error)
+			if awsErrOk && awsErr.Code() == cloudwatchlogs.ErrCodeResourceNotFoundException {
+				logger.WithFields(logrus.Fields{
+					"LogGroup": eachTarget.logGroupName(),
+				}).Debug("Log group does not exist")
+				continue
+			}
+			return nil, errors.Wrapf(filterErr, "Failed to filter log events for %s", eachTarget.logGroupName())
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return aws.Int64Value(events[i].event.Timestamp) < aws.Int64Value(events[j].event.Timestamp)
+	})
+	return events, nil
+}
+
+// Logs outputs the CloudWatch Logs entries for the service functions. If
+// functionName is non-empty, only the logs for that function are included.
+// The since parameter determines how far back to start and filterPattern
+// is an optional CloudWatch Logs filter pattern. If follow is true, the
+// log groups are polled for new entries until the process is interrupted.
+func Logs(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	functionName string,
+	since time.Duration,
+	filterPattern string,
+	follow bool,
+	outputWriter io.Writer,
+	logger *logrus.Logger) error {
+
+	targets, targetsErr := deployedFunctions(serviceName, lambdaAWSInfos, functionName)
+	if nil != targetsErr {
+		return targetsErr
+	}
+	for _, eachTarget := range targets {
+		logger.WithFields(logrus.Fields{
+			"Function": eachTarget.functionName,
+			"LogGroup": eachTarget.logGroupName(),
+		}).Info("Fetching logs")
+	}
+	enableColors := isTerminal(outputWriter)
+	awsSession := spartaAWS.NewSession(logger)
+	startTime := time.Now().Add(-since)
+	// Events with the same timestamp may be returned by consecutive polls,
+	// so track the IDs that have been output
+	seenEvents := make(map[string]int64)
+	for {
+		events, eventsErr := fetchLogEvents(awsSession,
+			targets,
+			startTime,
+			filterPattern,
+			logger)
+		if nil != eventsErr {
+			return eventsErr
+		}
+		lastTimestamp := startTime.UnixNano() / int64(time.Millisecond)
+		for _, eachEvent := range events {
+			eventID := aws.StringValue(eachEvent.event.EventId)
+			if _, seen := seenEvents[eventID]; seen {
+				continue
+			}
+			eventTimestamp := aws.Int64Value(eachEvent.event.Timestamp)
+			seenEvents[eventID] = eventTimestamp
+			if eventTimestamp > lastTimestamp {
+				lastTimestamp = eventTimestamp
+			}
+			fmt.Fprintln(outputWriter, formatLogMessage(eachEvent.functionName,
+				aws.StringValue(eachEvent.event.Message),
+				enableColors))
+		}
+		if !follow {
+			return nil
+		}
+		startTime = time.Unix(0, lastTimestamp*int64(time.Millisecond))
+		for eachID, eachTimestamp := range seenEvents {
+			if eachTimestamp < lastTimestamp {
+				delete(seenEvents, eachID)
+			}
+		}
+		time.Sleep(logsPollingInterval)
+	}
+}
@@ -0,0 +1,53 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeployedFunctions(t *testing.T) {
+	lambdaFunctions := testLambdaData()
+	allTargets, allTargetsErr := deployedFunctions("SampleLogs", lambdaFunctions, "")
+	if nil != allTargetsErr {
+		t.Fatalf("Failed to resolve log targets: %s", allTargetsErr)
+	}
+	if len(allTargets) != len(lambdaFunctions) {
+		t.Fatalf("Expected %d targets, got %d", len(lambdaFunctions), len(allTargets))
+	}
+	functionName := lambdaFunctions[0].lambdaFunctionName()
+	singleTarget, singleTargetErr := deployedFunctions("SampleLogs", lambdaFunctions, functionName)
+	if nil != singleTargetErr {
+		t.Fatalf("Failed to resolve log target: %s", singleTargetErr)
+	}
+	if len(singleTarget) != 1 {
+		t.Fatalf("Expected single target, got %d", len(singleTarget))
+	}
+	expectedGroup := "/aws/lambda/SampleLogs_" + awsLambdaInternalName(functionName)
+	if singleTarget[0].logGroupName() != expectedGroup {
+		t.Errorf("Unexpected log group: %s", singleTarget[0].logGroupName())
+	}
+	_, missingErr := deployedFunctions("SampleLogs", lambdaFunctions, "missingFunction")
+	if nil == missingErr {
+		t.Errorf("Expected error for unknown function")
+	}
+}
+
+func TestFormatLogMessage(t *testing.T) {
+	jsonMessage := `{"arn":"arn:aws:lambda:us-west-2:000000000000:function:Sample","build":"testBuildID","level":"warning","msg":"Hello World","reqID":"abc-123","time":"2018-01-01T00:00:00Z","user":"Sparta"}`
+	formatted := formatLogMessage("main.hello", jsonMessage, false)
+	for _, eachExpected := range []string{"WARNING", "[main.hello]", "abc-123", "testBuildID", "Hello World", "user=Sparta"} {
+		if !strings.Contains(formatted, eachExpected) {
+			t.Errorf("Expected formatted message to include %s: %s", eachExpected, formatted)
+		}
+	}
+	if strings.Contains(formatted, "arn:aws:lambda") {
+		t.Errorf("Expected arn field to be omitted: %s", formatted)
+	}
+	rawMessage := "START RequestId: abc-123 Version: $LATEST\n"
+	formatted = formatLogMessage("main.hello", rawMessage, false)
+	if formatted != "[main.hello] START RequestId: abc-123 Version: $LATEST" {
+		t.Errorf("Unexpected raw message format: %s", formatted)
+	}
+}
@@ -0,0 +1,830 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	humanize "github.com/dustin/go-humanize"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// CloudFormation template limits. See
+// https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/cloudformation-limits.html
+const (
+	// maxTemplateResources is the maximum number of resources in a template
+	maxTemplateResources = 500
+	// maxTemplateBytes is the maximum size of a template uploaded to S3
+	maxTemplateBytes = 1024 * 1024
+	// maxTemplateParameters is the maximum number of template parameters
+	maxTemplateParameters = 200
+	// maxTemplateOutputs is the maximum number of template outputs
+	maxTemplateOutputs = 200
+	// nestedPermissionsStackCount is the number of permissions nested
+	// stacks. The permissions only reference the functions and event
+	// sources, so each one is assigned to a stack by the hash of its
+	// logical name. Adding or removing a permission doesn't move the others.
+	nestedPermissionsStackCount = 5
+)
+
+// nestedStackGroupAPIGateway is the nested stack group for API Gateway resources
+const nestedStackGroupAPIGateway = "APIGateway"
+
+// nestedStackGroupPermissions is the nested stack group for Lambda permissions
+const nestedStackGroupPermissions = "Permissions"
+
+// nestedStackGroupS3Site is the nested stack group for the S3Site resources
+const nestedStackGroupS3Site = "S3Site"
+
+// reNestedStackName replaces the characters that aren't valid in
+// parameter and output names
+var reNestedStackName = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// reSubVariable matches the ${Name} and ${Name.Attribute} variables
+// in a Fn::Sub template string. Literal ${!Name} values are skipped.
+var reSubVariable = regexp.MustCompile(`\$\{([^!}][^}]*)\}`)
+
+// nestedTemplate is a child template that's provisioned as an
+// AWS::CloudFormation::Stack resource in the service stack
+type nestedTemplate struct {
+	logicalName     string
+	resourceNames   []string
+	parameters      map[string]interface{}
+	resources       map[string]interface{}
+	outputs         map[string]interface{}
+	parameterValues map[string]interface{}
+	dependsOn       map[string]bool
+	// Names of the parameters and outputs, keyed by the
+	// referenced resource and attribute
+	parameterNames map[string]string
+	outputNames    map[string]string
+}
+
+func newNestedTemplate(logicalName string, resourceNames []string) *nestedTemplate {
+	return &nestedTemplate{
+		logicalName:     logicalName,
+		resourceNames:   resourceNames,
+		parameters:      make(map[string]interface{}),
+		resources:       make(map[string]interface{}),
+		outputs:         make(map[string]interface{}),
+		parameterValues: make(map[string]interface{}),
+		dependsOn:       make(map[string]bool),
+		parameterNames:  make(map[string]string),
+		outputNames:     make(map[string]string),
+	}
+}
+
+// uniqueName returns an alphanumeric name for the resource attribute
+// that isn't already a key in existing
+func uniqueName(resourceName string, attribute string, existing map[string]interface{}) string {
+	baseName := reNestedStackName.ReplaceAllString(resourceName+attribute, "")
+	name := baseName
+	for i := 2; ; i++ {
+		if _, exists := existing[name]; !exists {
+			return name
+		}
+		name = fmt.Sprintf("%s%d", baseName, i)
+	}
+}
+
+// templateRef returns the Ref or Fn::GetAtt expression for the
+// resource attribute
+func templateRef(resourceName string, attribute string) interface{} {
+	if "" == attribute {
+		return map[string]interface{}{"Ref": resourceName}
+	}
+	return map[string]interface{}{
+		"Fn::GetAtt": []interface{}{resourceName, attribute},
+	}
+}
+
+// output returns the name of the output that exports the resource
+// attribute from the child template
+func (nested *nestedTemplate) output(resourceName string, attribute string) string {
+	key := resourceName + "." + attribute
+	if outputName, exists := nested.outputNames[key]; exists {
+		return outputName
+	}
+	outputName := uniqueName(resourceName, attribute, nested.outputs)
+	nested.outputs[outputName] = map[string]interface{}{
+		"Value": templateRef(resourceName, attribute),
+	}
+	nested.outputNames[key] = outputName
+	return outputName
+}
+
+// parameter returns the name of the child template parameter whose
+// value is the parentValue expression
+func (nested *nestedTemplate) parameter(resourceName string,
+	attribute string,
+	parameterType string,
+	parentValue interface{}) string {
+	key := resourceName + "." + attribute
+	if parameterName, exists := nested.parameterNames[key]; exists {
+		return parameterName
+	}
+	parameterName := uniqueName(resourceName, attribute, nested.parameters)
+	nested.parameters[parameterName] = map[string]interface{}{
+		"Type": parameterType,
+	}
+	nested.parameterValues[parameterName] = parentValue
+	nested.parameterNames[key] = parameterName
+	return parameterName
+}
+
+// templateBody returns the child template
+func (nested *nestedTemplate) templateBody(description string,
+	mappings interface{}) map[string]interface{} {
+	body := map[string]interface{}{
+		"AWSTemplateFormatVersion": "2010-09-09",
+		"Description":              description,
+		"Resources":                nested.resources,
+	}
+	if nil != mappings {
+		body["Mappings"] = mappings
+	}
+	if len(nested.parameters) != 0 {
+		body["Parameters"] = nested.parameters
+	}
+	if len(nested.outputs) != 0 {
+		body["Outputs"] = nested.outputs
+	}
+	return body
+}
+
+// templateSplitter partitions a template into a parent template
+// and a set of nested child templates
+type templateSplitter struct {
+	resources  map[string]interface{}
+	parameters map[string]interface{}
+	// Index of the child that owns each moved resource
+	locations map[string]int
+	children  []*nestedTemplate
+}
+
+// location returns the index of the child template that owns the
+// resource, or -1 if the resource is in the parent template
+func (splitter *templateSplitter) location(resourceName string) int {
+	if index, exists := splitter.locations[resourceName]; exists {
+		return index
+	}
+	return -1
+}
+
+// rewriteRef returns the expression that references the resource attribute
+// from the template at location from. If the reference doesn't cross a
+// template boundary, nil is returned.
+func (splitter *templateSplitter) rewriteRef(resourceName string,
+	attribute string,
+	from int,
+	original interface{}) interface{} {
+
+	_, isResource := splitter.resources[resourceName]
+	_, isParameter := splitter.parameters[resourceName]
+	// The stack name and ID differ in a nested stack, so the
+	// parent values are passed to the child
+	isStackPseudoParameter := "AWS::StackName" == resourceName ||
+		"AWS::StackId" == resourceName
+	if !isResource && !isParameter && !isStackPseudoParameter {
+		return nil
+	}
+	target := -1
+	if isResource {
+		target = splitter.location(resourceName)
+	}
+	if target == from {
+		return nil
+	}
+	// The expression that resolves the value in the parent template
+	parentValue := original
+	if target >= 0 {
+		child := splitter.children[target]
+		parentValue = map[string]interface{}{
+			"Fn::GetAtt": []interface{}{child.logicalName,
+				"Outputs." + child.output(resourceName, attribute)},
+		}
+	}
+	if from < 0 {
+		return parentValue
+	}
+	parameterType := "String"
+	if isParameter {
+		if parameterDef, isMap := splitter.parameters[resourceName].(map[string]interface{}); isMap {
+			declaredType, _ := parameterDef["Type"].(string)
+			if strings.Contains(declaredType, "List") {
+				parameterType = "CommaDelimitedList"
+				parentValue = map[string]interface{}{
+					"Fn::Join": []interface{}{",", parentValue},
+				}
+			}
+		}
+	}
+	parameterName := splitter.children[from].parameter(resourceName,
+		attribute,
+		parameterType,
+		parentValue)
+	return map[string]interface{}{"Ref": parameterName}
+}
+
+// rewriteSub rewrites the variables of a Fn::Sub template string that
+// reference resources in another template
+func (splitter *templateSplitter) rewriteSub(templateString string,
+	variables map[string]interface{},
+	from int) string {
+	return reSubVariable.ReplaceAllStringFunc(templateString, func(match string) string {
+		variableName := match[2 : len(match)-1]
+		if _, isVariable := variables[variableName]; isVariable {
+			return match
+		}
+		resourceName := variableName
+		attribute := ""
+		if !strings.HasPrefix(variableName, "AWS::") {
+			parts := strings.SplitN(variableName, ".", 2)
+			resourceName = parts[0]
+			if len(parts) == 2 {
+				attribute = parts[1]
+			}
+		}
+		rewritten, isMap := splitter.rewriteRef(resourceName,
+			attribute,
+			from,
+			templateRef(resourceName, attribute)).(map[string]interface{})
+		if !isMap {
+			return match
+		}
+		if refName, isRef := rewritten["Ref"].(string); isRef {
+			return fmt.Sprintf("${%s}", refName)
+		}
+		if getAtt, isGetAtt := rewritten["Fn::GetAtt"].([]interface{}); isGetAtt {
+			return fmt.Sprintf("${%s.%s}", getAtt[0], getAtt[1])
+		}
+		return match
+	})
+}
+
+// rewriteValue returns a copy of the template value whose cross template
+// references are rewritten for the template at location from
+func (splitter *templateSplitter) rewriteValue(value interface{}, from int) interface{} {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		if len(typedValue) == 1 {
+			if refName, isRef := typedValue["Ref"].(string); isRef {
+				if rewritten := splitter.rewriteRef(refName, "", from, typedValue); nil != rewritten {
+					return rewritten
+				}
+				return typedValue
+			}
+			if getAtt, isGetAtt := typedValue["Fn::GetAtt"]; isGetAtt {
+				resourceName := ""
+				attribute := ""
+				switch typedGetAtt := getAtt.(type) {
+				case []interface{}:
+					if len(typedGetAtt) == 2 {
+						resourceName, _ = typedGetAtt[0].(string)
+						attribute, _ = typedGetAtt[1].(string)
+					}
+				case string:
+					parts := strings.SplitN(typedGetAtt, ".", 2)
+					if len(parts) == 2 {
+						resourceName = parts[0]
+						attribute = parts[1]
+					}
+				}
+				if "" != resourceName && "" != attribute {
+					if rewritten := splitter.rewriteRef(resourceName, attribute, from, typedValue); nil != rewritten {
+						return rewritten
+					}
+				}
+				return typedValue
+			}
+			if sub, isSub := typedValue["Fn::Sub"]; isSub {
+				switch typedSub := sub.(type) {
+				case string:
+					return map[string]interface{}{
+						"Fn::Sub": splitter.rewriteSub(typedSub, nil, from),
+					}
+				case []interface{}:
+					if len(typedSub) == 2 {
+						templateString, _ := typedSub[0].(string)
+						variables, _ := typedSub[1].(map[string]interface{})
+						return map[string]interface{}{
+							"Fn::Sub": []interface{}{
+								splitter.rewriteSub(templateString, variables, from),
+								splitter.rewriteValue(variables, from),
+							},
+						}
+					}
+				}
+			}
+		}
+		rewritten := make(map[string]interface{}, len(typedValue))
+		for eachKey, eachValue := range typedValue {
+			rewritten[eachKey] = splitter.rewriteValue(eachValue, from)
+		}
+		return rewritten
+	case []interface{}:
+		rewritten := make([]interface{}, len(typedValue))
+		for eachIndex, eachValue := range typedValue {
+			rewritten[eachIndex] = splitter.rewriteValue(eachValue, from)
+		}
+		return rewritten
+	}
+	return value
+}
+
+// rewriteResource returns a copy of the resource whose references and
+// DependsOn entries are rewritten for the template at location from
+func (splitter *templateSplitter) rewriteResource(resourceName string, from int) map[string]interface{} {
+	resource, _ := splitter.resources[resourceName].(map[string]interface{})
+	rewritten := make(map[string]interface{}, len(resource))
+	for eachKey, eachValue := range resource {
+		switch eachKey {
+		case "Properties":
+			rewritten[eachKey] = splitter.rewriteValue(eachValue, from)
+		case "DependsOn":
+			// Handled below
+		default:
+			rewritten[eachKey] = eachValue
+		}
+	}
+	dependsOn := make([]interface{}, 0)
+	for _, eachDependency := range stringValues(resource["DependsOn"]) {
+		dependencyLocation := splitter.location(eachDependency)
+		if _, isResource := splitter.resources[eachDependency]; !isResource ||
+			dependencyLocation == from {
+			dependsOn = append(dependsOn, eachDependency)
+			continue
+		}
+		// Cross template dependencies are satisfied by the nested stack
+		dependencyName := eachDependency
+		if dependencyLocation >= 0 {
+			dependencyName = splitter.children[dependencyLocation].logicalName
+		}
+		if from >= 0 {
+			splitter.children[from].dependsOn[dependencyName] = true
+		} else {
+			dependsOn = append(dependsOn, dependencyName)
+		}
+	}
+	if len(dependsOn) != 0 {
+		rewritten["DependsOn"] = uniqueStringValues(dependsOn)
+	}
+	return rewritten
+}
+
+// stringValues returns the string or list of strings value
+func stringValues(value interface{}) []string {
+	switch typedValue := value.(type) {
+	case string:
+		return []string{typedValue}
+	case []interface{}:
+		values := make([]string, 0)
+		for _, eachValue := range typedValue {
+			if stringValue, isString := eachValue.(string); isString {
+				values = append(values, stringValue)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// uniqueStringValues returns the sorted, unique list of values
+func uniqueStringValues(values []interface{}) []interface{} {
+	seen := make(map[string]bool)
+	unique := make([]string, 0)
+	for _, eachValue := range stringValues(values) {
+		if !seen[eachValue] {
+			seen[eachValue] = true
+			unique = append(unique, eachValue)
+		}
+	}
+	sort.Strings(unique)
+	result := make([]interface{}, len(unique))
+	for eachIndex, eachValue := range unique {
+		result[eachIndex] = eachValue
+	}
+	return result
+}
+
+// containsConditions returns true if the value uses template conditions,
+// which aren't available to a nested template
+func containsConditions(value interface{}) bool {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		for eachKey, eachValue := range typedValue {
+			if "Fn::If" == eachKey || "Condition" == eachKey || containsConditions(eachValue) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, eachValue := range typedValue {
+			if containsConditions(eachValue) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nestedStackGroup returns the name of the nested stack group the
+// resource belongs to, or the empty string if the resource remains
+// in the service template. IAM resources always remain in the service
+// template so that its capabilities are unchanged.
+func nestedStackGroup(resourceName string, resource map[string]interface{}) string {
+	resourceType, _ := resource["Type"].(string)
+	if strings.HasPrefix(resourceType, "AWS::IAM::") || containsConditions(resource) {
+		return ""
+	}
+	switch {
+	case strings.HasPrefix(resourceType, "AWS::ApiGateway::"):
+		return nestedStackGroupAPIGateway
+	case "AWS::Lambda::Permission" == resourceType:
+		return nestedPermissionsGroup(resourceName)
+	case strings.HasPrefix(resourceName, "S3Site"):
+		return nestedStackGroupS3Site
+	}
+	return ""
+}
+
+// nestedPermissionsGroup returns the name of the permissions nested
+// stack group for the Lambda permission
+func nestedPermissionsGroup(resourceName string) string {
+	hash := fnv.New32a()
+	// Writes to the hash never fail
+	_, _ = hash.Write([]byte(resourceName))
+	return fmt.Sprintf("%s%d",
+		nestedStackGroupPermissions,
+		hash.Sum32()%nestedPermissionsStackCount+1)
+}
+
+// nestedStackLogicalName returns the logical resource name of the
+// nested stack for the group
+func nestedStackLogicalName(groupName string) string {
+	return fmt.Sprintf("%sNestedStack", groupName)
+}
+
+// splitTemplate moves the API Gateway, Lambda permission and S3Site
+// resources of the template into nested templates. References that cross
+// a template boundary are rewritten into nested stack parameters and
+// outputs. The template's Resources and Outputs are updated in place and
+// include an AWS::CloudFormation::Stack resource for each child, without
+// a TemplateURL.
+func splitTemplate(template map[string]interface{}) ([]*nestedTemplate, error) {
+	resources, _ := template["Resources"].(map[string]interface{})
+	parameters, _ := template["Parameters"].(map[string]interface{})
+	splitter := &templateSplitter{
+		resources:  resources,
+		parameters: parameters,
+		locations:  make(map[string]int),
+	}
+	resourceNames := make([]string, 0)
+	for eachName := range resources {
+		resourceNames = append(resourceNames, eachName)
+	}
+	sort.Strings(resourceNames)
+
+	groupResources := make(map[string][]string)
+	for _, eachName := range resourceNames {
+		resource, _ := resources[eachName].(map[string]interface{})
+		groupName := nestedStackGroup(eachName, resource)
+		if "" != groupName {
+			groupResources[groupName] = append(groupResources[groupName], eachName)
+		}
+	}
+	groupNames := []string{nestedStackGroupAPIGateway}
+	for i := 1; i <= nestedPermissionsStackCount; i++ {
+		groupNames = append(groupNames, fmt.Sprintf("%s%d", nestedStackGroupPermissions, i))
+	}
+	groupNames = append(groupNames, nestedStackGroupS3Site)
+	for _, eachGroup := range groupNames {
+		names := groupResources[eachGroup]
+		if len(names) != 0 {
+			splitter.children = append(splitter.children,
+				newNestedTemplate(nestedStackLogicalName(eachGroup), names))
+		}
+	}
+	if len(splitter.children) == 0 {
+		return nil, nil
+	}
+	for eachIndex, eachChild := range splitter.children {
+		for _, eachName := range eachChild.resourceNames {
+			splitter.locations[eachName] = eachIndex
+		}
+	}
+
+	// Rewrite everything before the resources are moved, since the
+	// references are resolved against the original template
+	parentResources := make(map[string]interface{})
+	for _, eachName := range resourceNames {
+		location := splitter.location(eachName)
+		rewritten := splitter.rewriteResource(eachName, location)
+		if location >= 0 {
+			splitter.children[location].resources[eachName] = rewritten
+		} else {
+			parentResources[eachName] = rewritten
+		}
+	}
+	if outputs, isMap := template["Outputs"].(map[string]interface{}); isMap {
+		for eachName, eachOutput := range outputs {
+			outputs[eachName] = splitter.rewriteValue(eachOutput, -1)
+		}
+	}
+	for _, eachChild := range splitter.children {
+		if _, exists := resources[eachChild.logicalName]; exists {
+			return nil, errors.Errorf("Nested stack name %s conflicts with an existing resource",
+				eachChild.logicalName)
+		}
+		stackResource := map[string]interface{}{
+			"Type": "AWS::CloudFormation::Stack",
+			"Properties": map[string]interface{}{
+				"Parameters": eachChild.parameterValues,
+			},
+		}
+		dependsOn := make([]interface{}, 0)
+		for eachDependency := range eachChild.dependsOn {
+			dependsOn = append(dependsOn, eachDependency)
+		}
+		if len(dependsOn) != 0 {
+			stackResource["DependsOn"] = uniqueStringValues(dependsOn)
+		}
+		parentResources[eachChild.logicalName] = stackResource
+	}
+	template["Resources"] = parentResources
+
+	cycleErr := templateDependencyCycle(parentResources)
+	if nil != cycleErr {
+		return nil, cycleErr
+	}
+	return splitter.children, nil
+}
+
+// templateDependencyCycle returns an error if the resources have a
+// circular dependency
+func templateDependencyCycle(resources map[string]interface{}) error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := make(map[string]int)
+	var visit func(resourceName string, path []string) error
+	visit = func(resourceName string, path []string) error {
+		switch states[resourceName] {
+		case visiting:
+			return errors.Errorf("Nested stacks have a circular dependency: %s",
+				strings.Join(append(path, resourceName), " -> "))
+		case visited:
+			return nil
+		}
+		states[resourceName] = visiting
+		refs := make(map[string]bool)
+		templateResourceRefs(resources[resourceName], refs)
+		refNames := make([]string, 0)
+		for eachRef := range refs {
+			if _, isResource := resources[eachRef]; isResource {
+				refNames = append(refNames, eachRef)
+			}
+		}
+		sort.Strings(refNames)
+		for _, eachRef := range refNames {
+			visitErr := visit(eachRef, append(path, resourceName))
+			if nil != visitErr {
+				return visitErr
+			}
+		}
+		states[resourceName] = visited
+		return nil
+	}
+	resourceNames := make([]string, 0)
+	for eachName := range resources {
+		resourceNames = append(resourceNames, eachName)
+	}
+	sort.Strings(resourceNames)
+	for _, eachName := range resourceNames {
+		visitErr := visit(eachName, nil)
+		if nil != visitErr {
+			return visitErr
+		}
+	}
+	return nil
+}
+
+// templateLimitsError returns an error describing the CloudFormation
+// limits that the template exceeds, or nil
+func templateLimitsError(templateName string, template map[string]interface{}) error {
+	templateJSON, templateJSONErr := json.Marshal(template)
+	if nil != templateJSONErr {
+		return errors.Wrapf(templateJSONErr, "Failed to marshal %s template", templateName)
+	}
+	counts := func(key string) int {
+		values, _ := template[key].(map[string]interface{})
+		return len(values)
+	}
+	limitErrors := make([]string, 0)
+	if len(templateJSON) > maxTemplateBytes {
+		limitErrors = append(limitErrors, fmt.Sprintf("size %d bytes > %d",
+			len(templateJSON),
+			maxTemplateBytes))
+	}
+	if counts("Resources") > maxTemplateResources {
+		limitErrors = append(limitErrors, fmt.Sprintf("%d resources > %d",
+			counts("Resources"),
+			maxTemplateResources))
+	}
+	if counts("Parameters") > maxTemplateParameters {
+		limitErrors = append(limitErrors, fmt.Sprintf("%d parameters > %d",
+			counts("Parameters"),
+			maxTemplateParameters))
+	}
+	if counts("Outputs") > maxTemplateOutputs {
+		limitErrors = append(limitErrors, fmt.Sprintf("%d outputs > %d",
+			counts("Outputs"),
+			maxTemplateOutputs))
+	}
+	if len(limitErrors) != 0 {
+		return errors.Errorf("%s template exceeds CloudFormation limits: %s",
+			templateName,
+			strings.Join(limitErrors, ", "))
+	}
+	return nil
+}
+
+// existingStackMovedResources returns the sorted names of the resources in
+// the existing service stack that the split moves into nested stacks.
+// CloudFormation deletes and recreates a resource that moves to another stack.
+func existingStackMovedResources(ctx *workflowContext, children []*nestedTemplate) ([]string, error) {
+	exists, existsErr := spartaCF.StackExists(ctx.userdata.serviceName,
+		ctx.context.awsSession,
+		ctx.logger)
+	if nil != existsErr {
+		return nil, existsErr
+	}
+	if !exists {
+		return nil, nil
+	}
+	childResources := make(map[string]bool)
+	for _, eachChild := range children {
+		for _, eachName := range eachChild.resourceNames {
+			childResources[eachName] = true
+		}
+	}
+	movedNames := make([]string, 0)
+	awsCloudFormation := cloudformation.New(ctx.context.awsSession)
+	listResourcesInput := &cloudformation.ListStackResourcesInput{
+		StackName: aws.String(ctx.userdata.serviceName),
+	}
+	listErr := awsCloudFormation.ListStackResourcesPages(listResourcesInput,
+		func(page *cloudformation.ListStackResourcesOutput, lastPage bool) bool {
+			for _, eachSummary := range page.StackResourceSummaries {
+				if childResources[aws.StringValue(eachSummary.LogicalResourceId)] {
+					movedNames = append(movedNames, aws.StringValue(eachSummary.LogicalResourceId))
+				}
+			}
+			return true
+		})
+	if nil != listErr {
+		return nil, errors.Wrapf(listErr, "Failed to list resources for stack %s", ctx.userdata.serviceName)
+	}
+	sort.Strings(movedNames)
+	return movedNames, nil
+}
+
+// ensureNestedStacks splits the service template into nested stacks if it
+// exceeds the CloudFormation template limits. Each child template is
+// uploaded to S3 and the service template is updated in place. An existing
+// stack is only split if none of its resources move into a nested stack,
+// since the moved resources would be replaced.
+func ensureNestedStacks(ctx *workflowContext) error {
+	templateJSON, templateJSONErr := json.Marshal(ctx.context.cfTemplate)
+	if nil != templateJSONErr {
+		return errors.Wrapf(templateJSONErr, "Failed to marshal CloudFormation template")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(templateJSON))
+	decoder.UseNumber()
+	var template map[string]interface{}
+	decodeErr := decoder.Decode(&template)
+	if nil != decodeErr {
+		return errors.Wrapf(decodeErr, "Failed to parse CloudFormation template")
+	}
+	if nil == templateLimitsError(ctx.userdata.serviceName, template) {
+		return nil
+	}
+	defer recordDuration(time.Now(), "Creating nested stacks", ctx)
+
+	resources, _ := template["Resources"].(map[string]interface{})
+	ctx.logger.WithFields(logrus.Fields{
+		"Size":          humanize.Bytes(uint64(len(templateJSON))),
+		"ResourceCount": len(resources),
+	}).Info("Template exceeds CloudFormation limits. Creating nested stacks")
+
+	children, childrenErr := splitTemplate(template)
+	if nil != childrenErr {
+		return childrenErr
+	}
+	movedNames, movedNamesErr := existingStackMovedResources(ctx, children)
+	if nil != movedNamesErr {
+		return movedNamesErr
+	}
+	if len(movedNames) != 0 {
+		return errors.Errorf("%s template exceeds CloudFormation limits, but the existing stack isn't split into nested stacks. "+
+			"Moving its resources into nested stacks would replace %d resources (%s). "+
+			"Reduce the number of resources or provision a new stack",
+			ctx.userdata.serviceName,
+			len(movedNames),
+			strings.Join(movedNames, ", "))
+	}
+	sanitizedServiceName := sanitizedName(ctx.userdata.serviceName)
+	parentResources, _ := template["Resources"].(map[string]interface{})
+	for _, eachChild := range children {
+		childTemplate := eachChild.templateBody(fmt.Sprintf("%s nested stack: %s",
+			ctx.userdata.serviceName,
+			eachChild.logicalName),
+			template["Mappings"])
+		limitsErr := templateLimitsError(eachChild.logicalName, childTemplate)
+		if nil != limitsErr {
+			return limitsErr
+		}
+		childJSON, childJSONErr := json.Marshal(childTemplate)
+		if nil != childJSONErr {
+			return errors.Wrapf(childJSONErr, "Failed to marshal nested template")
+		}
+		childFile, childFileErr := temporaryFile(fmt.Sprintf("%s-%s-cftemplate.json",
+			sanitizedServiceName,
+			eachChild.logicalName))
+		if nil != childFileErr {
+			return childFileErr
+		}
+		_, writeErr := childFile.Write(childJSON)
+		closeErr := childFile.Close()
+		if nil != writeErr {
+			return writeErr
+		}
+		if nil != closeErr {
+			return closeErr
+		}
+		childURL, childURLErr := uploadLocalFileToS3(childFile.Name(), "", ctx)
+		if nil != childURLErr {
+			return childURLErr
+		}
+		ctx.context.nestedTemplateURLs = append(ctx.context.nestedTemplateURLs, childURL)
+		stackResource, _ := parentResources[eachChild.logicalName].(map[string]interface{})
+		stackProperties, _ := stackResource["Properties"].(map[string]interface{})
+		stackProperties["TemplateURL"] = childURL
+
+		ctx.logger.WithFields(logrus.Fields{
+			"Name":           eachChild.logicalName,
+			"ResourceCount":  len(eachChild.resources),
+			"ParameterCount": len(eachChild.parameters),
+			"OutputCount":    len(eachChild.outputs),
+		}).Info("Nested stack")
+	}
+	limitsErr := templateLimitsError(ctx.userdata.serviceName, template)
+	if nil != limitsErr {
+		return limitsErr
+	}
+
+	// Replace the service template resources with the rewritten ones
+	cfResources := make(map[string]*gocf.Resource, len(parentResources))
+	for eachName, eachResource := range parentResources {
+		resource, _ := eachResource.(map[string]interface{})
+		cfResource, exists := ctx.context.cfTemplate.Resources[eachName]
+		if !exists {
+			cfResource = &gocf.Resource{}
+		}
+		resourceType, _ := resource["Type"].(string)
+		properties, propertiesErr := json.Marshal(resource["Properties"])
+		if nil != propertiesErr {
+			return errors.Wrapf(propertiesErr, "Failed to marshal %s properties", eachName)
+		}
+		if nil == resource["Properties"] {
+			properties = nil
+		}
+		cfResource.Properties = &uploadedResourceProperties{
+			resourceType: resourceType,
+			properties:   properties,
+		}
+		cfResource.DependsOn = stringValues(resource["DependsOn"])
+		cfResources[eachName] = cfResource
+	}
+	ctx.context.cfTemplate.Resources = cfResources
+	outputs, _ := template["Outputs"].(map[string]interface{})
+	for eachName, eachOutput := range ctx.context.cfTemplate.Outputs {
+		if output, isMap := outputs[eachName].(map[string]interface{}); isMap {
+			eachOutput.Value = output["Value"]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const nestedStacksTemplate = `{
+	"Resources": {
+		"LambdaRole": {
+			"Type": "AWS::IAM::Role",
+			"Properties": {"Path": "/"}
+		},
+		"HelloFunction": {
+			"Type": "AWS::Lambda::Function",
+			"Properties": {"Role": {"Fn::GetAtt": ["LambdaRole", "Arn"]}}
+		},
+		"RestAPI": {
+			"Type": "AWS::ApiGateway::RestApi",
+			"Properties": {"Name": {"Ref": "AWS::StackName"}}
+		},
+		"HelloMethod": {
+			"Type": "AWS::ApiGateway::Method",
+			"DependsOn": ["HelloPermission"],
+			"Properties": {
+				"RestApiId": {"Ref": "RestAPI"},
+				"Uri": {"Fn::Join": ["", [{"Fn::GetAtt": ["HelloFunction", "Arn"]}, "/invocations"]]}
+			}
+		},
+		"HelloPermission": {
+			"Type": "AWS::Lambda::Permission",
+			"Properties": {
+				"FunctionName": {"Fn::GetAtt": ["HelloFunction", "Arn"]},
+				"Region": {"Ref": "AWS::Region"}
+			}
+		}
+	},
+	"Outputs": {
+		"APIGatewayURL": {
+			"Value": {"Fn::Sub": "https://${RestAPI}.execute-api.${AWS::Region}.amazonaws.com"}
+		},
+		"RestAPIID": {
+			"Value": {"Ref": "RestAPI"}
+		}
+	}
+}`
+
+func TestSplitTemplate(t *testing.T) {
+	var template map[string]interface{}
+	unmarshalErr := json.Unmarshal([]byte(nestedStacksTemplate), &template)
+	if nil != unmarshalErr {
+		t.Fatal(unmarshalErr)
+	}
+	if nil != templateLimitsError("Test", template) {
+		t.Fatal("Expected template to be within limits")
+	}
+	children, childrenErr := splitTemplate(template)
+	if nil != childrenErr {
+		t.Fatal(childrenErr)
+	}
+	if len(children) != 2 {
+		t.Fatalf("Expected 2 nested templates, found %d", len(children))
+	}
+	permissionsStackName := nestedStackLogicalName(nestedPermissionsGroup("HelloPermission"))
+	apiChild := children[0]
+	if "APIGatewayNestedStack" != apiChild.logicalName {
+		t.Fatalf("Unexpected nested stack name: %s", apiChild.logicalName)
+	}
+	parentResources := template["Resources"].(map[string]interface{})
+	for _, eachName := range []string{"LambdaRole",
+		"HelloFunction",
+		"APIGatewayNestedStack",
+		permissionsStackName} {
+		if _, exists := parentResources[eachName]; !exists {
+			t.Errorf("Expected parent resource: %s", eachName)
+		}
+	}
+	if len(parentResources) != 4 {
+		t.Errorf("Unexpected parent resources: %v", parentResources)
+	}
+
+	// The method references the function via a parameter and depends
+	// on the permissions stack
+	method := apiChild.resources["HelloMethod"].(map[string]interface{})
+	if _, exists := method["DependsOn"]; exists {
+		t.Errorf("Expected cross stack DependsOn to be removed: %v", method["DependsOn"])
+	}
+	methodJSON, _ := json.Marshal(method)
+	if !strings.Contains(string(methodJSON), `{"Ref":"HelloFunctionArn"}`) ||
+		!strings.Contains(string(methodJSON), `"RestApiId":{"Ref":"RestAPI"}`) {
+		t.Errorf("Unexpected method: %s", string(methodJSON))
+	}
+	apiStack := parentResources["APIGatewayNestedStack"].(map[string]interface{})
+	if !reflect.DeepEqual(apiStack["DependsOn"], []interface{}{permissionsStackName}) {
+		t.Errorf("Unexpected nested stack dependencies: %v", apiStack["DependsOn"])
+	}
+	stackJSON, _ := json.Marshal(apiStack["Properties"])
+	expectedParameters := `"Parameters":{"AWSStackName":{"Ref":"AWS::StackName"},"HelloFunctionArn":{"Fn::GetAtt":["HelloFunction","Arn"]}}`
+	if !strings.Contains(string(stackJSON), expectedParameters) {
+		t.Errorf("Unexpected nested stack properties: %s", string(stackJSON))
+	}
+
+	// Pseudo parameters other than the stack name are unchanged
+	permissionJSON, _ := json.Marshal(children[1].resources["HelloPermission"])
+	if !strings.Contains(string(permissionJSON), `"Region":{"Ref":"AWS::Region"}`) {
+		t.Errorf("Unexpected permission: %s", string(permissionJSON))
+	}
+
+	// Outputs reference the nested stack outputs
+	outputsJSON, _ := json.Marshal(template["Outputs"])
+	for _, eachExpected := range []string{
+		`${APIGatewayNestedStack.Outputs.RestAPI}.execute-api.${AWS::Region}`,
+		`{"Fn::GetAtt":["APIGatewayNestedStack","Outputs.RestAPI"]}`,
+	} {
+		if !strings.Contains(string(outputsJSON), eachExpected) {
+			t.Errorf("Expected %s in outputs: %s", eachExpected, string(outputsJSON))
+		}
+	}
+	if _, exists := apiChild.outputs["RestAPI"]; !exists {
+		t.Errorf("Expected nested stack output: %v", apiChild.outputs)
+	}
+}
+
+func TestTemplateDependencyCycle(t *testing.T) {
+	resources := map[string]interface{}{
+		"First": map[string]interface{}{
+			"Properties": map[string]interface{}{
+				"Value": map[string]interface{}{"Ref": "Second"},
+			},
+		},
+		"Second": map[string]interface{}{
+			"DependsOn": []interface{}{"First"},
+		},
+	}
+	if nil == templateDependencyCycle(resources) {
+		t.Error("Expected circular dependency error")
+	}
+	delete(resources, "Second")
+	if nil != templateDependencyCycle(resources) {
+		t.Error("Unexpected circular dependency error")
+	}
+}
+
+func TestNestedPermissionsGroup(t *testing.T) {
+	groups := make(map[string]bool)
+	for i := 0; i != 100; i++ {
+		permissionName := fmt.Sprintf("Permission%d", i)
+		groupName := nestedPermissionsGroup(permissionName)
+		if groupName != nestedPermissionsGroup(permissionName) {
+			t.Fatalf("Expected a stable group for %s", permissionName)
+		}
+		groups[groupName] = true
+	}
+	if len(groups) != nestedPermissionsStackCount {
+		t.Errorf("Expected permissions in every group: %v", groups)
+	}
+}
+
+const nestedStacksDescribeStacksResponse = `<DescribeStacksResponse xmlns="http://cloudformation.amazonaws.com/doc/2010-05-15/">
+  <DescribeStacksResult>
+    <Stacks>
+      <member>
+        <StackName>NestedService</StackName>
+        <StackId>arn:aws:cloudformation:us-west-2:000000000000:stack/NestedService/1</StackId>
+        <StackStatus>UPDATE_COMPLETE</StackStatus>
+        <CreationTime>2018-11-28T22:27:06.932Z</CreationTime>
+      </member>
+    </Stacks>
+  </DescribeStacksResult>
+</DescribeStacksResponse>`
+
+const nestedStacksListStackResourcesResponse = `<ListStackResourcesResponse xmlns="http://cloudformation.amazonaws.com/doc/2010-05-15/">
+  <ListStackResourcesResult>
+    <StackResourceSummaries>
+      <member>
+        <LogicalResourceId>HelloFunction</LogicalResourceId>
+        <ResourceType>AWS::Lambda::Function</ResourceType>
+        <ResourceStatus>UPDATE_COMPLETE</ResourceStatus>
+        <LastUpdatedTimestamp>2018-11-28T22:27:06.932Z</LastUpdatedTimestamp>
+      </member>
+      <member>
+        <LogicalResourceId>RestAPI</LogicalResourceId>
+        <ResourceType>AWS::ApiGateway::RestApi</ResourceType>
+        <ResourceStatus>UPDATE_COMPLETE</ResourceStatus>
+        <LastUpdatedTimestamp>2018-11-28T22:27:06.932Z</LastUpdatedTimestamp>
+      </member>
+    </StackResourceSummaries>
+  </ListStackResourcesResult>
+</ListStackResourcesResponse>`
+
+func TestExistingStackMovedResources(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.FormValue("Action") {
+		case "DescribeStacks":
+			fmt.Fprint(w, nestedStacksDescribeStacksResponse)
+		case "ListStackResources":
+			fmt.Fprint(w, nestedStacksListStackResourcesResponse)
+		default:
+			t.Errorf("Unexpected CloudFormation request: %s", r.FormValue("Action"))
+		}
+	}))
+	defer server.Close()
+
+	logger, _ := NewLogger("info")
+	ctx := &workflowContext{logger: logger}
+	ctx.userdata.serviceName = "NestedService"
+	ctx.context.awsSession = session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	}))
+	children := []*nestedTemplate{
+		newNestedTemplate("APIGatewayNestedStack", []string{"HelloMethod", "RestAPI"}),
+	}
+	movedNames, movedNamesErr := existingStackMovedResources(ctx, children)
+	if nil != movedNamesErr {
+		t.Fatal(movedNamesErr)
+	}
+	if !reflect.DeepEqual(movedNames, []string{"RestAPI"}) {
+		t.Errorf("Unexpected moved resources: %v", movedNames)
+	}
+}
@@ -0,0 +1,278 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// changeSetResourceSummary is the flattened representation of a single
+// CloudFormation ResourceChange
+type changeSetResourceSummary struct {
+	action            string
+	logicalResourceID string
+	resourceType      string
+	replacement       string
+	properties        []string
+}
+
+// changeSetSummaries returns the sorted slice of resource changes
+func changeSetSummaries(changes []*cloudformation.Change) []*changeSetResourceSummary {
+	summaries := make([]*changeSetResourceSummary, 0)
+	for _, eachChange := range changes {
+		resourceChange := eachChange.ResourceChange
+		if nil == resourceChange {
+			continue
+		}
+		summary := &changeSetResourceSummary{
+			action:            aws.StringValue(resourceChange.Action),
+			logicalResourceID: aws.StringValue(resourceChange.LogicalResourceId),
+			resourceType:      aws.StringValue(resourceChange.ResourceType),
+			replacement:       aws.StringValue(resourceChange.Replacement),
+			properties:        make([]string, 0),
+		}
+		changedProperties := make(map[string]bool)
+		for _, eachDetail := range resourceChange.Details {
+			if nil == eachDetail.Target {
+				continue
+			}
+			propName := aws.StringValue(eachDetail.Target.Name)
+			if "" == propName {
+				propName = aws.StringValue(eachDetail.Target.Attribute)
+			}
+			if "" != propName {
+				changedProperties[propName] = true
+			}
+		}
+		for eachProperty := range changedProperties {
+			summary.properties = append(summary.properties, eachProperty)
+		}
+		sort.Strings(summary.properties)
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].action != summaries[j].action {
+			return summaries[i].action < summaries[j].action
+		}
+		return summaries[i].logicalResourceID < summaries[j].logicalResourceID
+	})
+	return summaries
+}
+
+// logChangeSetSummary outputs the per-resource changes in the change set
+// and returns the number of resources that will be replaced
+func logChangeSetSummary(summaries []*changeSetResourceSummary,
+	logger *logrus.Logger) int {
+
+	replacementCount := 0
+	actionCounts := make(map[string]int)
+	logger.Info(subheaderDivider)
+	logger.Info("Pending changes")
+	logger.Info(subheaderDivider)
+	for _, eachSummary := range summaries {
+		actionCounts[eachSummary.action]++
+		fields := logrus.Fields{
+			"Action": eachSummary.action,
+			"Type":   eachSummary.resourceType,
+		}
+		if "" != eachSummary.replacement {
+			fields["Replacement"] = eachSummary.replacement
+		}
+		if len(eachSummary.properties) != 0 {
+			fields["Properties"] = strings.Join(eachSummary.properties, ", ")
+		}
+		entry := logger.WithFields(fields)
+		switch eachSummary.replacement {
+		case "True", "Conditional":
+			replacementCount++
+			entry.Warn(eachSummary.logicalResourceID)
+		default:
+			entry.Info(eachSummary.logicalResourceID)
+		}
+	}
+	logger.Info(subheaderDivider)
+	logger.WithFields(logrus.Fields{
+		"Add":         actionCounts["Add"],
+		"Modify":      actionCounts["Modify"],
+		"Remove":      actionCounts["Remove"],
+		"Replacement": replacementCount,
+	}).Info("Change summary")
+	return replacementCount
+}
+
+// stackChangeApprover returns the approver that logs the pending changes and
+// then either automatically approves them or prompts for confirmation
+// using the supplied reader. Every confirmation is read from the same
+// buffered reader, so that piped responses are available to each
+// approval. If the reader is a file other than a terminal, such as stdin in
+// CI, the approval fails without prompting.
+func stackChangeApprover(autoApprove bool,
+	confirmReader io.Reader,
+	logger *logrus.Logger) spartaCF.StackChangeApprover {
+
+	bufferedReader := bufio.NewReader(confirmReader)
+	return func(stackName string, changes []*cloudformation.Change) (bool, error) {
+		replacementCount := logChangeSetSummary(changeSetSummaries(changes), logger)
+		if replacementCount != 0 {
+			logger.WithFields(logrus.Fields{
+				"StackName":        stackName,
+				"ReplacementCount": replacementCount,
+			}).Warn("Some resources will be replaced. Stateful resources may lose data")
+		}
+		if autoApprove {
+			logger.WithFields(logrus.Fields{
+				"StackName": stackName,
+			}).Info("Changes automatically approved")
+			return true, nil
+		}
+		if confirmFile, confirmFileOk := confirmReader.(*os.File); confirmFileOk && !isTerminal(confirmFile) {
+			return false, errors.Errorf("Cannot confirm changes to %s without a terminal. Use --yes to approve changes non-interactively",
+				stackName)
+		}
+		fmt.Printf("Apply these changes to %s? Only 'yes' will be accepted: ", stackName)
+		response, responseErr := bufferedReader.ReadString('\n')
+		if nil != responseErr && io.EOF != responseErr {
+			return false, errors.Wrapf(responseErr, "Failed to read confirmation")
+		}
+		approved := "yes" == strings.ToLower(strings.TrimSpace(response))
+		if !approved {
+			logger.WithFields(logrus.Fields{
+				"StackName": stackName,
+			}).Warn("Changes were not approved. Use --yes to approve changes non-interactively")
+		}
+		return approved, nil
+	}
+}
+
+// planCloudFormationOperation creates a change set for the uploaded template,
+// reports the per-resource changes, and then deletes the change set
+// together with the uploaded artifacts
+func planCloudFormationOperation(ctx *workflowContext, templateURL string) error {
+	// The plan doesn't leave anything behind, so the uploaded artifacts
+	// are deleted no matter what the result is
+	defer func() {
+		for _, eachRollback := range ctx.transaction.rollbackFunctions {
+			rollbackErr := eachRollback(ctx.logger)
+			if nil != rollbackErr {
+				ctx.logger.WithFields(logrus.Fields{
+					"Error": rollbackErr,
+				}).Warn("Failed to delete plan artifact")
+			}
+		}
+		ctx.transaction.rollbackFunctions = nil
+	}()
+
+	exists, existsErr := spartaCF.StackExists(ctx.userdata.serviceName,
+		ctx.context.awsSession,
+		ctx.logger)
+	if nil != existsErr {
+		return existsErr
+	}
+	// If the stack doesn't exist, everything is an addition
+	if !exists {
+		ctx.logger.WithFields(logrus.Fields{
+			"StackName": ctx.userdata.serviceName,
+		}).Info("Stack does not exist. All resources will be created")
+
+		creationChanges := spartaCF.StackCreationChanges(ctx.context.cfTemplate)
+		logChangeSetSummary(changeSetSummaries(creationChanges), ctx.logger)
+		return nil
+	}
+
+	awsCloudFormation := cloudformation.New(ctx.context.awsSession)
+	changeSetRequestName := CloudFormationResourceName(fmt.Sprintf("%sPlanChangeSet", ctx.userdata.serviceName))
+	awsParameters, awsParametersErr := spartaCF.StackParameters(ctx.userdata.serviceName,
+		ctx.context.cfTemplate,
+		ctx.userdata.templateParameterValues,
+		awsCloudFormation)
+	if nil != awsParametersErr {
+		return awsParametersErr
+	}
+	changes, changesErr := spartaCF.CreateStackChangeSetWithParameters(changeSetRequestName,
+		ctx.userdata.serviceName,
+		ctx.context.cfTemplate,
+		templateURL,
+		awsParameters,
+		nil,
+		awsCloudFormation,
+		ctx.logger)
+	if nil != changesErr {
+		return errors.Wrapf(changesErr, "Failed to create plan change set")
+	}
+	// CreateStackChangeSet already deleted the empty change set
+	if nil == changes {
+		return nil
+	}
+	logChangeSetSummary(changeSetSummaries(changes.Changes), ctx.logger)
+
+	_, deleteErr := spartaCF.DeleteChangeSet(ctx.userdata.serviceName,
+		changeSetRequestName,
+		awsCloudFormation)
+	if nil != deleteErr {
+		return errors.Wrapf(deleteErr, "Failed to delete plan change set")
+	}
+	return nil
+}
+
+// Plan compiles, packages, and uploads the service artifacts, then reports
+// the set of CloudFormation changes that a subsequent `provision`
+// would apply. The change set and the artifacts uploaded by the plan are
+// deleted once the summary is logged. Content addressed artifacts that
+// already exist in the bucket weren't uploaded by the plan, so they're
+// left in place for the stacks that may use them. The
+// templateParameterValues are the template parameter values to preview.
+func Plan(noop bool,
+	serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api *API,
+	site *S3Site,
+	s3Bucket string,
+	useCGO bool,
+	buildID string,
+	templateParameterValues map[string]string,
+	buildTags string,
+	linkerFlags string,
+	workflowHooks *WorkflowHooks,
+	logger *logrus.Logger) error {
+
+	ctx, ctxErr := newWorkflowContext(noop,
+		serviceName,
+		serviceDescription,
+		lambdaAWSInfos,
+		api,
+		site,
+		s3Bucket,
+		useCGO,
+		false,
+		buildID,
+		"",
+		buildTags,
+		linkerFlags,
+		nil,
+		workflowHooks,
+		logger)
+	if nil != ctxErr {
+		return ctxErr
+	}
+	ctx.userdata.plan = true
+	ctx.userdata.templateParameterValues = templateParameterValues
+
+	ctx.logger.WithFields(logrus.Fields{
+		"BuildID": ctx.userdata.buildID,
+		"NOOP":    noop,
+		"Tags":    ctx.userdata.buildTags,
+	}).Info("Planning service changes")
+	return runWorkflow(ctx)
+}
@@ -0,0 +1,161 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+func TestPlan(t *testing.T) {
+	logger, _ := NewLogger("info")
+	err := Plan(true,
+		"SamplePlan",
+		"",
+		testLambdaData(),
+		nil,
+		nil,
+		os.Getenv("S3_BUCKET"),
+		false,
+		"testBuildID",
+		nil,
+		"",
+		"",
+		nil,
+		logger)
+	if nil != err {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestPlanChangeSetSummary(t *testing.T) {
+	logger, _ := NewLogger("info")
+	changeSet := &cloudformation.DescribeChangeSetOutput{
+		Changes: []*cloudformation.Change{
+			{
+				ResourceChange: &cloudformation.ResourceChange{
+					Action:            aws.String("Modify"),
+					LogicalResourceId: aws.String("MyTable"),
+					ResourceType:      aws.String("AWS::DynamoDB::Table"),
+					Replacement:       aws.String("True"),
+					Details: []*cloudformation.ResourceChangeDetail{
+						{
+							Target: &cloudformation.ResourceTargetDefinition{
+								Attribute: aws.String("Properties"),
+								Name:      aws.String("KeySchema"),
+							},
+						},
+						{
+							Target: &cloudformation.ResourceTargetDefinition{
+								Attribute: aws.String("Properties"),
+								Name:      aws.String("KeySchema"),
+							},
+						},
+					},
+				},
+			},
+			{
+				ResourceChange: &cloudformation.ResourceChange{
+					Action:            aws.String("Add"),
+					LogicalResourceId: aws.String("MyFunction"),
+					ResourceType:      aws.String("AWS::Lambda::Function"),
+				},
+			},
+		},
+	}
+	summaries := changeSetSummaries(changeSet.Changes)
+	if len(summaries) != 2 {
+		t.Fatalf("Expected 2 summaries, got %d", len(summaries))
+	}
+	if summaries[0].action != "Add" {
+		t.Errorf("Expected summaries sorted by action, got %s", summaries[0].action)
+	}
+	if len(summaries[1].properties) != 1 || summaries[1].properties[0] != "KeySchema" {
+		t.Errorf("Unexpected changed properties: %#v", summaries[1].properties)
+	}
+	replacements := logChangeSetSummary(summaries, logger)
+	if replacements != 1 {
+		t.Errorf("Expected 1 replacement, got %d", replacements)
+	}
+}
+
+func TestStackChangeApprover(t *testing.T) {
+	logger, _ := NewLogger("info")
+	changes := []*cloudformation.Change{
+		{
+			ResourceChange: &cloudformation.ResourceChange{
+				Action:            aws.String("Modify"),
+				LogicalResourceId: aws.String("MyTable"),
+				ResourceType:      aws.String("AWS::DynamoDB::Table"),
+				Replacement:       aws.String("True"),
+			},
+		},
+	}
+	testCases := []struct {
+		autoApprove bool
+		input       string
+		expected    bool
+	}{
+		{true, "", true},
+		{false, "yes\n", true},
+		{false, "YES", true},
+		{false, "y\n", false},
+		{false, "", false},
+	}
+	for _, eachTestCase := range testCases {
+		approver := stackChangeApprover(eachTestCase.autoApprove,
+			strings.NewReader(eachTestCase.input),
+			logger)
+		approved, approvedErr := approver("SampleApprover", changes)
+		if nil != approvedErr {
+			t.Fatalf("Failed to evaluate approval: %s", approvedErr)
+		}
+		if approved != eachTestCase.expected {
+			t.Errorf("Expected approval %t for input %#v", eachTestCase.expected, eachTestCase.input)
+		}
+	}
+}
+
+func TestStackChangeApproverSharedInput(t *testing.T) {
+	logger, _ := NewLogger("info")
+	// Every approval reads the next line of the same piped input
+	approver := stackChangeApprover(false,
+		strings.NewReader("yes\nno\nyes\n"),
+		logger)
+	for eachIndex, eachExpected := range []bool{true, false, true, false} {
+		approved, approvedErr := approver(fmt.Sprintf("SampleApprover%d", eachIndex), nil)
+		if nil != approvedErr {
+			t.Fatalf("Failed to evaluate approval: %s", approvedErr)
+		}
+		if approved != eachExpected {
+			t.Errorf("Expected approval %t for approval %d", eachExpected, eachIndex)
+		}
+	}
+}
+
+func TestStackChangeApproverNonInteractive(t *testing.T) {
+	logger, _ := NewLogger("info")
+	pipeReader, pipeWriter, pipeErr := os.Pipe()
+	if nil != pipeErr {
+		t.Fatal(pipeErr)
+	}
+	defer pipeReader.Close()
+	defer pipeWriter.Close()
+
+	// A non-terminal file fails without reading the confirmation
+	approver := stackChangeApprover(false, pipeReader, logger)
+	approved, approvedErr := approver("SampleApprover", nil)
+	if approved || nil == approvedErr || !strings.Contains(approvedErr.Error(), "--yes") {
+		t.Errorf("Expected non-interactive approval to fail: %v", approvedErr)
+	}
+	approver = stackChangeApprover(true, pipeReader, logger)
+	approved, approvedErr = approver("SampleApprover", nil)
+	if !approved || nil != approvedErr {
+		t.Errorf("Expected automatic approval: %v", approvedErr)
+	}
+}
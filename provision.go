@@ -9,6 +9,7 @@ import (
 	"strings"
 	"text/template"
 
+	spartaAWS "github.com/mweagle/Sparta/aws"
 	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
 	cloudformationresources "github.com/mweagle/Sparta/aws/cloudformation/resources"
 	spartaIAM "github.com/mweagle/Sparta/aws/iam"
@@ -99,6 +100,11 @@ func lambdaFunctionEnvironment(userEnvMap map[string]*gocf.StringExpr,
 	if discoveryInfoErr != nil {
 		return nil, errors.Wrapf(discoveryInfoErr, "Failed to calculate dependency info")
 	}
+	// Custom resource handlers use the same endpoints as the provisioning
+	// session
+	for eachKey, eachValue := range spartaAWS.EndpointEnvironment() {
+		envMap[eachKey] = eachValue
+	}
 	envMap[envVarLogLevel] = logger.Level.String()
 	envMap[envVarDiscoveryInformation] = discoveryInfo
 	return &gocf.LambdaFunctionEnvironment{
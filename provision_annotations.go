@@ -67,6 +67,12 @@ func resolveResourceRef(expr interface{}) (*resourceRef, error) {
 	return nil, nil
 }
 
+// eventSourceMappingPoliciesFunc returns the privileges needed to use the
+// resource in an EventSourceMapping
+type eventSourceMappingPoliciesFunc func(resource *resourceRef,
+	template *gocf.Template,
+	logger *logrus.Logger) ([]spartaIAM.PolicyStatement, error)
+
 func eventSourceMappingPoliciesForResource(resource *resourceRef,
 	template *gocf.Template,
 	logger *logrus.Logger) ([]spartaIAM.PolicyStatement, error) {
@@ -77,6 +83,8 @@ func eventSourceMappingPoliciesForResource(resource *resourceRef,
 			policyStatements = append(policyStatements, CommonIAMStatements.DynamoDB...)
 		} else if strings.Contains(resource.ResourceName, ":kinesis:") {
 			policyStatements = append(policyStatements, CommonIAMStatements.Kinesis...)
+		} else if strings.Contains(resource.ResourceName, ":sqs:") {
+			policyStatements = append(policyStatements, CommonIAMStatements.SQS...)
 		} else {
 			logger.WithFields(logrus.Fields{
 				"ARN": resource.ResourceName,
@@ -95,6 +103,14 @@ func eventSourceMappingPoliciesForResource(resource *resourceRef,
 			policyStatements = append(policyStatements, CommonIAMStatements.DynamoDB...)
 		case gocf.KinesisStream:
 			policyStatements = append(policyStatements, CommonIAMStatements.Kinesis...)
+		case gocf.SQSQueue,
+			*gocf.SQSQueue:
+			// A queue Ref is the queue URL rather than the ARN
+			if resource.RefType == resourceRefFunc {
+				return policyStatements, errors.Errorf("SQS event source must use the queue Arn attribute rather than a Ref: %s",
+					resource.ResourceName)
+			}
+			policyStatements = append(policyStatements, CommonIAMStatements.SQS...)
 		default:
 			logger.WithFields(logrus.Fields{
 				"ResourceType": existingResource.Properties.CfnResourceType(),
@@ -104,6 +120,76 @@ func eventSourceMappingPoliciesForResource(resource *resourceRef,
 	return policyStatements, nil
 }
 
+// eventSourceMappingPoliciesForType returns an eventSourceMappingPoliciesFunc
+// that provides the privileges for the declared EventSourceMapping.EventSourceType
+// rather than the resource
+func eventSourceMappingPoliciesForType(eventSourceType string) eventSourceMappingPoliciesFunc {
+	return func(resource *resourceRef,
+		template *gocf.Template,
+		logger *logrus.Logger) ([]spartaIAM.PolicyStatement, error) {
+		switch eventSourceType {
+		case EventSourceTypeDynamoDB:
+			return CommonIAMStatements.DynamoDB, nil
+		case EventSourceTypeKinesis:
+			return CommonIAMStatements.Kinesis, nil
+		case EventSourceTypeSQS:
+			return CommonIAMStatements.SQS, nil
+		default:
+			return nil, errors.Errorf("Unsupported EventSourceType: %s", eventSourceType)
+		}
+	}
+}
+
+// eventSourceMappingDestinationPoliciesForResource returns the privileges
+// needed to send the records that failed to an SQS queue or SNS topic
+// on-failure destination
+func eventSourceMappingDestinationPoliciesForResource(resource *resourceRef,
+	template *gocf.Template,
+	logger *logrus.Logger) ([]spartaIAM.PolicyStatement, error) {
+	sqsStatement := spartaIAM.PolicyStatement{
+		Effect: "Allow",
+		Action: []string{"sqs:SendMessage"},
+	}
+	snsStatement := spartaIAM.PolicyStatement{
+		Effect: "Allow",
+		Action: []string{"sns:Publish"},
+	}
+	policyStatements := []spartaIAM.PolicyStatement{}
+	if resource.RefType == resourceLiteral {
+		if strings.Contains(resource.ResourceName, ":sqs:") {
+			policyStatements = append(policyStatements, sqsStatement)
+		} else if strings.Contains(resource.ResourceName, ":sns:") {
+			policyStatements = append(policyStatements, snsStatement)
+		} else {
+			return policyStatements, errors.Errorf("EventSourceMapping on-failure destination must be an SQS queue or SNS topic: %s",
+				resource.ResourceName)
+		}
+		return policyStatements, nil
+	}
+	existingResource, existingResourceExists := template.Resources[resource.ResourceName]
+	if !existingResourceExists {
+		return policyStatements, errors.Errorf("Failed to find resource %s in template",
+			resource.ResourceName)
+	}
+	switch existingResource.Properties.(type) {
+	case gocf.SQSQueue,
+		*gocf.SQSQueue:
+		// A queue Ref is the queue URL rather than the ARN
+		if resource.RefType == resourceRefFunc {
+			return policyStatements, errors.Errorf("SQS destination must use the queue Arn attribute rather than a Ref: %s",
+				resource.ResourceName)
+		}
+		policyStatements = append(policyStatements, sqsStatement)
+	case gocf.SNSTopic,
+		*gocf.SNSTopic:
+		policyStatements = append(policyStatements, snsStatement)
+	default:
+		return policyStatements, errors.Errorf("EventSourceMapping on-failure destination must be an SQS queue or SNS topic: %s",
+			existingResource.Properties.CfnResourceType())
+	}
+	return policyStatements, nil
+}
+
 // annotationFunc represents an internal annotation function
 // called to stich the template together
 type annotationFunc func(lambdaAWSInfos []*LambdaAWSInfo,
@@ -181,6 +267,43 @@ func annotateCodePipelineEnvironments(lambdaAWSInfo *LambdaAWSInfo, logger *logr
 	}
 }
 
+// annotateStage applies any stage specific function options and publishes
+// the stage into the function environment
+func annotateStage(lambdaAWSInfo *LambdaAWSInfo, stage string, logger *logrus.Logger) {
+	if "" == stage {
+		return
+	}
+	if nil == lambdaAWSInfo.Options {
+		lambdaAWSInfo.Options = defaultLambdaFunctionOptions()
+	}
+	if nil == lambdaAWSInfo.Options.Environment {
+		lambdaAWSInfo.Options.Environment = make(map[string]*gocf.StringExpr)
+	}
+	lambdaAWSInfo.Options.Environment[envVarStage] = gocf.String(stage)
+
+	stageOptions, exists := lambdaAWSInfo.Options.StageOptions[stage]
+	if !exists || nil == stageOptions {
+		return
+	}
+	logger.WithFields(logrus.Fields{
+		"Stage":          stage,
+		"LambdaFunction": lambdaAWSInfo.lambdaFunctionName(),
+	}).Debug("Applying stage options")
+
+	if 0 != stageOptions.MemorySize {
+		lambdaAWSInfo.Options.MemorySize = stageOptions.MemorySize
+	}
+	if 0 != stageOptions.Timeout {
+		lambdaAWSInfo.Options.Timeout = stageOptions.Timeout
+	}
+	if 0 != stageOptions.ReservedConcurrentExecutions {
+		lambdaAWSInfo.Options.ReservedConcurrentExecutions = stageOptions.ReservedConcurrentExecutions
+	}
+	for eachKey, eachValue := range stageOptions.Environment {
+		lambdaAWSInfo.Options.Environment[eachKey] = eachValue
+	}
+}
+
 func annotateEventSourceMappings(lambdaAWSInfos []*LambdaAWSInfo,
 	template *gocf.Template,
 	logger *logrus.Logger) error {
@@ -188,12 +311,14 @@ func annotateEventSourceMappings(lambdaAWSInfos []*LambdaAWSInfo,
 	//
 	// BEGIN
 	// Inline closure to handle the update of a lambda function that includes
-	// an eventSourceMapping entry.
+	// an eventSourceMapping entry. The policiesForResource function returns
+	// the privileges the function needs for the resourceArn resource.
 	annotatePermissions := func(lambdaAWSInfo *LambdaAWSInfo,
-		eventSourceMapping *EventSourceMapping,
-		resource *resourceRef) error {
+		resourceArn interface{},
+		resource *resourceRef,
+		policiesForResource eventSourceMappingPoliciesFunc) error {
 
-		annotateStatements, annotateStatementsErr := eventSourceMappingPoliciesForResource(resource,
+		annotateStatements, annotateStatementsErr := policiesForResource(resource,
 			template,
 			logger)
 
@@ -211,7 +336,7 @@ func annotateEventSourceMappings(lambdaAWSInfos []*LambdaAWSInfo,
 				spartaIAM.PolicyStatement{
 					Action:   eachStatement.Action,
 					Effect:   "Allow",
-					Resource: spartaCF.DynamicValueToStringExpr(eventSourceMapping.EventSourceArn).String(),
+					Resource: spartaCF.DynamicValueToStringExpr(resourceArn).String(),
 				})
 		}
 
@@ -223,7 +348,7 @@ func annotateEventSourceMappings(lambdaAWSInfos []*LambdaAWSInfo,
 		if !cfResourceOk {
 			return errors.Errorf("Unable to locate lambda function for annotation")
 		}
-		lambdaResource, lambdaResourceOk := cfResource.Properties.(gocf.LambdaFunction)
+		lambdaResource, lambdaResourceOk := lambdaFunctionProperties(cfResource.Properties)
 		if !lambdaResourceOk {
 			return errors.Errorf("CloudFormation resource exists, but is incorrect type: %s (%v)",
 				cfResource.Properties.CfnResourceType(),
@@ -284,17 +409,48 @@ func annotateEventSourceMappings(lambdaAWSInfos []*LambdaAWSInfo,
 			// and see if the Arn is supplied by either a Ref or a GetAttr
 			// function. In those cases, we need to look around in the template
 			// to go from: EventMapping -> Type -> Lambda -> LambdaIAMRole
-			// so that we can add the permissions
-			if resourceRef != nil {
+			// so that we can add the permissions. A declared EventSourceType
+			// takes precedence over the resource.
+			policiesFunc := eventSourceMappingPoliciesForResource
+			if "" != eachEventSource.EventSourceType {
+				policiesFunc = eventSourceMappingPoliciesForType(eachEventSource.EventSourceType)
+			} else if resourceRef == nil {
+				logger.WithFields(logrus.Fields{
+					"Function":       eachLambda.lambdaFunctionName(),
+					"EventSourceArn": eachEventSource.EventSourceArn,
+				}).Warn("Unable to infer EventSourceMapping privileges. Set the EventSourceType or add an IAMRolePrivilege for the event source")
+			}
+			if "" != eachEventSource.EventSourceType || resourceRef != nil {
 				annotationErr := annotatePermissions(eachLambda,
-					eachEventSource,
-					resourceRef)
+					eachEventSource.EventSourceArn,
+					resourceRef,
+					policiesFunc)
 				// Anything go wrong?
 				if annotationErr != nil {
 					return errors.Wrapf(annotationErr,
 						"Failed to annotate template for EventSourceMapping: %#v", eachEventSource)
 				}
 			}
+			// The function sends the records that failed to the on-failure
+			// destination
+			if nil == eachEventSource.OnFailureDestinationArn {
+				continue
+			}
+			destinationRef, destinationRefErr := resolveResourceRef(eachEventSource.OnFailureDestinationArn)
+			if destinationRefErr != nil {
+				return errors.Wrapf(destinationRefErr, "Failed to resolve OnFailureDestinationArn: %#v",
+					eachEventSource)
+			}
+			if destinationRef != nil {
+				annotationErr := annotatePermissions(eachLambda,
+					eachEventSource.OnFailureDestinationArn,
+					destinationRef,
+					eventSourceMappingDestinationPoliciesForResource)
+				if annotationErr != nil {
+					return errors.Wrapf(annotationErr,
+						"Failed to annotate template for EventSourceMapping destination: %#v", eachEventSource)
+				}
+			}
 		}
 	}
 	return nil
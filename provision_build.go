@@ -13,7 +13,7 @@ import (
 	"go/parser"
 	"go/token"
 	"io"
-	"net/url"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
@@ -56,6 +56,10 @@ var (
 	// SpartaTagBuildTagsKey is the keyname used in the CloudFormation Output
 	// that stores the optional user-supplied golang build tags
 	SpartaTagBuildTagsKey = spartaTagName("buildTags")
+
+	// SpartaTagVersionKey is the keyname used in the CloudFormation stack
+	// tags that stores the Sparta version used to provision the service
+	SpartaTagVersionKey = spartaTagName("version")
 )
 
 // finalizerFunction is the type of function pushed onto the cleanup stack
@@ -75,21 +79,13 @@ func (s3URL *s3UploadURL) keyName() string {
 }
 
 func newS3UploadURL(s3URL string) *s3UploadURL {
-	urlParts, urlPartsErr := url.Parse(s3URL)
+	// The URL is path style if there's a custom S3 endpoint
+	_, keyName, version, urlPartsErr := spartaS3.ObjectURLParts(s3URL)
 	if nil != urlPartsErr {
 		return nil
 	}
-	queryParams, queryParamsErr := url.ParseQuery(urlParts.RawQuery)
-	if nil != queryParamsErr {
-		return nil
-	}
-	versionIDValues := queryParams["versionId"]
-	version := ""
-	if len(versionIDValues) == 1 {
-		version = versionIDValues[0]
-	}
 	return &s3UploadURL{location: s3URL,
-		path:    strings.TrimPrefix(urlParts.Path, "/"),
+		path:    keyName,
 		version: version}
 }
 
@@ -122,6 +118,22 @@ type userdata struct {
 	useCGO bool
 	// Are in-place updates enabled?
 	inPlace bool
+	// Is this a plan operation that only reports the pending changes?
+	plan bool
+	// Optional approver that must accept the pending stack changes
+	// before they're applied
+	changeApprover spartaCF.StackChangeApprover
+	// Number of previous builds whose S3 artifacts are retained
+	// after provisioning. Zero disables pruning.
+	gcKeepCount int
+	// Optional stack policy applied before the stack is updated
+	stackPolicy *spartaCF.StackPolicyDocument
+	// Should stack termination protection be enabled?
+	terminationProtection bool
+	// Template parameters declared by the service
+	templateParameters map[string]*gocf.Parameter
+	// Values for the template parameters, keyed by parameter name
+	templateParameterValues map[string]string
 	// The user-supplied or automatically generated BuildID
 	buildID string
 	// Optional user-supplied build tags
@@ -131,6 +143,9 @@ type userdata struct {
 	// Canonical basename of the service.  Also used as the CloudFormation
 	// stack name
 	serviceName string
+	// Optional deployment stage that selects the stage specific
+	// function options and API Gateway stage
+	stage string
 	// Service description
 	serviceDescription string
 	// The slice of Lambda functions that constitute the service
@@ -168,11 +183,26 @@ type provisionContext struct {
 	binaryName string
 	// Context to pass between workflow operations
 	workflowHooksContext map[string]interface{}
+	// Hash of the source files and build options. Empty if the
+	// build ID was generated
+	buildInputsHash string
+	// Optional cache of the code archive
+	buildCache *buildCache
+	// S3 URLs of the nested stack templates, if the service template
+	// was split
+	nestedTemplateURLs []string
+	// State shared with the other regions of a multi-region provision
+	regional *regionalProvision
+	// S3 URLs of the uploaded LambdaLayer archives
+	lambdaLayerURLs map[*LambdaLayer]*s3UploadURL
 }
 
 // similar to context, transaction scopes values that span the entire
 // provisioning step
 type transaction struct {
+	// Guards the slices below, since concurrent workflow tasks
+	// may append to them
+	mutex     sync.Mutex
 	startTime time.Time
 	// Optional rollback functions that workflow steps may append to if they
 	// have made mutations during provisioning.
@@ -203,6 +233,8 @@ type workflowContext struct {
 // recordDuration is a utility function to record how long
 func recordDuration(start time.Time, name string, ctx *workflowContext) {
 	elapsed := time.Since(start)
+	ctx.transaction.mutex.Lock()
+	defer ctx.transaction.mutex.Unlock()
 	ctx.transaction.stepDurations = append(ctx.transaction.stepDurations,
 		&workflowStepDuration{
 			name:     name,
@@ -213,6 +245,8 @@ func recordDuration(start time.Time, name string, ctx *workflowContext) {
 // Register a rollback function in the event that the provisioning
 // function failed.
 func (ctx *workflowContext) registerRollback(userFunction spartaS3.RollbackFunction) {
+	ctx.transaction.mutex.Lock()
+	defer ctx.transaction.mutex.Unlock()
 	if nil == ctx.transaction.rollbackFunctions || len(ctx.transaction.rollbackFunctions) <= 0 {
 		ctx.transaction.rollbackFunctions = make([]spartaS3.RollbackFunction, 0)
 	}
@@ -222,6 +256,8 @@ func (ctx *workflowContext) registerRollback(userFunction spartaS3.RollbackFunct
 // Register a rollback function in the event that the provisioning
 // function failed.
 func (ctx *workflowContext) registerFinalizer(userFunction finalizerFunction) {
+	ctx.transaction.mutex.Lock()
+	defer ctx.transaction.mutex.Unlock()
 	if nil == ctx.transaction.finalizerFunctions || len(ctx.transaction.finalizerFunctions) <= 0 {
 		ctx.transaction.finalizerFunctions = make([]finalizerFunction, 0)
 	}
@@ -441,10 +477,26 @@ func callWorkflowHook(hookPhase string,
 
 // versionAwareS3KeyName returns a keyname that provides the correct cache
 // invalidation semantics based on whether the target bucket
-// has versioning enabled
-func versionAwareS3KeyName(s3DefaultKey string, s3VersioningEnabled bool, logger *logrus.Logger) (string, error) {
+// has versioning enabled. If the contentHash is provided, the keyname
+// is derived from it so that identical content shares the same key.
+func versionAwareS3KeyName(s3DefaultKey string,
+	s3VersioningEnabled bool,
+	contentHash string,
+	logger *logrus.Logger) (string, error) {
 	versionKeyName := s3DefaultKey
-	if !s3VersioningEnabled {
+	if "" != contentHash {
+		var extension = path.Ext(s3DefaultKey)
+		versionKeyName = fmt.Sprintf("%s-%s%s",
+			strings.TrimSuffix(s3DefaultKey, extension),
+			contentHash,
+			extension)
+
+		logger.WithFields(logrus.Fields{
+			"Default":     s3DefaultKey,
+			"ContentHash": contentHash,
+			"Unique":      versionKeyName,
+		}).Debug("Created content addressed S3 keyname")
+	} else if !s3VersioningEnabled {
 		var extension = path.Ext(s3DefaultKey)
 		var prefixString = strings.TrimSuffix(s3DefaultKey, extension)
 
@@ -470,17 +522,33 @@ func versionAwareS3KeyName(s3DefaultKey string, s3VersioningEnabled bool, logger
 }
 
 // Upload a local file to S3.  Returns the full S3 URL to the file that was
-// uploaded. If the target bucket does not have versioning enabled,
-// this function will automatically make a new key to ensure uniqueness
+// uploaded. If s3ObjectKey is empty, the key is derived from a hash of the
+// file contents and the upload is skipped if the object already exists.
 func uploadLocalFileToS3(localPath string, s3ObjectKey string, ctx *workflowContext) (string, error) {
+	return uploadFileToS3(localPath, s3ObjectKey, true, ctx)
+}
 
-	// If versioning is enabled, use a stable name, otherwise use a name
-	// that's dynamically created. By default assume that the bucket is
-	// enabled for versioning
-	if "" == s3ObjectKey {
+// uploadFileToS3 uploads the local file to S3. An object with an explicit
+// key is deleted if the workflow fails. Transient files are deleted once the
+// workflow completes. Cached artifacts are not transient so that they can
+// be reused by a subsequent run.
+func uploadFileToS3(localPath string,
+	s3ObjectKey string,
+	transient bool,
+	ctx *workflowContext) (string, error) {
+
+	// Use a content addressed name s.t. identical artifacts
+	// are only uploaded once
+	contentAddressed := "" == s3ObjectKey
+	if contentAddressed {
+		contentHash, contentHashErr := fileContentHash(localPath)
+		if nil != contentHashErr {
+			return "", contentHashErr
+		}
 		defaultS3KeyName := fmt.Sprintf("%s/%s", ctx.userdata.serviceName, filepath.Base(localPath))
 		s3KeyName, s3KeyNameErr := versionAwareS3KeyName(defaultS3KeyName,
 			ctx.context.s3BucketVersioningEnabled,
+			contentHash,
 			ctx.logger)
 		if nil != s3KeyNameErr {
 			return "", errors.Wrapf(s3KeyNameErr, "Failed to create version aware S3 keyname")
@@ -489,7 +557,28 @@ func uploadLocalFileToS3(localPath string, s3ObjectKey string, ctx *workflowCont
 	}
 
 	s3URL := ""
-	if ctx.userdata.noop {
+	existingURL := ""
+	if contentAddressed && !ctx.userdata.noop {
+		objectURL, objectURLErr := spartaS3.ObjectURL(ctx.context.awsSession,
+			ctx.userdata.s3Bucket,
+			s3ObjectKey,
+			ctx.logger)
+		if nil != objectURLErr {
+			return "", objectURLErr
+		}
+		existingURL = objectURL
+	}
+	if "" != existingURL {
+		// Don't register a rollback, since the object may be in use
+		ctx.logger.WithFields(logrus.Fields{
+			"Bucket": ctx.userdata.s3Bucket,
+			"Key":    s3ObjectKey,
+		}).Info("Skipping upload of existing S3 object")
+		if transient {
+			ctx.registerFileCleanupFinalizer(localPath)
+		}
+		s3URL = existingURL
+	} else if ctx.userdata.noop {
 
 		// Binary size
 		filesize := int64(0)
@@ -503,12 +592,14 @@ func uploadLocalFileToS3(localPath string, s3ObjectKey string, ctx *workflowCont
 			"File":   filepath.Base(localPath),
 			"Size":   humanize.Bytes(uint64(filesize)),
 		}).Info(noopMessage("S3 upload"))
-		s3URL = fmt.Sprintf("https://%s-s3.amazonaws.com/%s",
+		s3URL = fmt.Sprintf("https://%s.s3.amazonaws.com/%s",
 			ctx.userdata.s3Bucket,
 			s3ObjectKey)
 	} else {
 		// Make sure we mark things for cleanup in case there's a problem
-		ctx.registerFileCleanupFinalizer(localPath)
+		if transient {
+			ctx.registerFileCleanupFinalizer(localPath)
+		}
 		// Then upload it
 		uploadLocation, uploadURLErr := spartaS3.UploadLocalFileToS3(localPath,
 			ctx.context.awsSession,
@@ -519,7 +610,12 @@ func uploadLocalFileToS3(localPath string, s3ObjectKey string, ctx *workflowCont
 			return "", errors.Wrapf(uploadURLErr, "Failed to upload local file to S3")
 		}
 		s3URL = uploadLocation
-		ctx.registerRollback(spartaS3.CreateS3RollbackFunc(ctx.context.awsSession, uploadLocation))
+		// Content addressed artifacts are kept if the provision fails, so that
+		// a re-run doesn't upload them again. The gc command deletes the
+		// orphaned objects. A plan deletes everything that it uploaded.
+		if !contentAddressed || ctx.userdata.plan {
+			ctx.registerRollback(spartaS3.CreateS3RollbackFunc(ctx.context.awsSession, uploadLocation))
+		}
 	}
 	return s3URL, nil
 }
@@ -532,9 +628,16 @@ func uploadLocalFileToS3(localPath string, s3ObjectKey string, ctx *workflowCont
 ////////////////////////////////////////////////////////////////////////////////
 
 // Verify & cache the IAM rolename to ARN mapping
-func verifyIAMRoles(ctx *workflowContext) (workflowStep, error) {
+func verifyIAMRoles(ctx *workflowContext) error {
 	defer recordDuration(time.Now(), "Verifying IAM roles", ctx)
 
+	// Regional workflows share the service functions that the
+	// profile decorator updates
+	if nil != ctx.context.regional {
+		ctx.context.regional.templateMutex.Lock()
+		defer ctx.context.regional.templateMutex.Unlock()
+	}
+
 	// The map is either a literal Arn from a pre-existing role name
 	// or a gocf.RefFunc() value.
 	// Don't verify them, just create them...
@@ -561,7 +664,7 @@ func verifyIAMRoles(ctx *workflowContext) (workflowStep, error) {
 				ctx.userdata.s3Bucket,
 				ctx.logger)
 			if profileErr != nil {
-				return nil, errors.Wrapf(profileErr, "Failed to call lambda profile decorator")
+				return errors.Wrapf(profileErr, "Failed to call lambda profile decorator")
 			}
 		}
 
@@ -611,7 +714,7 @@ func verifyIAMRoles(ctx *workflowContext) (workflowStep, error) {
 			resp, err := svc.GetRole(params)
 			if err != nil {
 				ctx.logger.Error(err.Error())
-				return nil, err
+				return err
 			}
 			// Cache it - we'll need it later when we create the
 			// CloudFormation template which needs the execution Arn (not role)
@@ -622,11 +725,11 @@ func verifyIAMRoles(ctx *workflowContext) (workflowStep, error) {
 		"Count": len(ctx.context.lambdaIAMRoleNameMap),
 	}).Info("IAM roles verified")
 
-	return verifyAWSPreconditions, nil
+	return nil
 }
 
 // Verify that everything is setup in AWS before we start building things
-func verifyAWSPreconditions(ctx *workflowContext) (workflowStep, error) {
+func verifyAWSPreconditions(ctx *workflowContext) error {
 	defer recordDuration(time.Now(), "Verifying AWS preconditions", ctx)
 
 	// If this a NOOP, assume that versioning is not enabled
@@ -641,7 +744,7 @@ func verifyAWSPreconditions(ctx *workflowContext) (workflowStep, error) {
 		// Get the S3 bucket and see if it has versioning enabled
 		isEnabled, versioningPolicyErr := spartaS3.BucketVersioningEnabled(ctx.context.awsSession, ctx.userdata.s3Bucket, ctx.logger)
 		if nil != versioningPolicyErr {
-			return nil, versioningPolicyErr
+			return versioningPolicyErr
 		}
 		ctx.logger.WithFields(logrus.Fields{
 			"VersioningEnabled": isEnabled,
@@ -649,7 +752,7 @@ func verifyAWSPreconditions(ctx *workflowContext) (workflowStep, error) {
 		}).Info("Checking S3 versioning")
 		ctx.context.s3BucketVersioningEnabled = isEnabled
 		if "" != ctx.userdata.codePipelineTrigger && !isEnabled {
-			return nil, fmt.Errorf("Bucket (%s) for CodePipeline trigger doesn't have a versioning policy enabled", ctx.userdata.s3Bucket)
+			return fmt.Errorf("Bucket (%s) for CodePipeline trigger doesn't have a versioning policy enabled", ctx.userdata.s3Bucket)
 		}
 		// Bucket region should match region
 		/*
@@ -661,7 +764,7 @@ func verifyAWSPreconditions(ctx *workflowContext) (workflowStep, error) {
 			ctx.logger)
 
 		if bucketRegionErr != nil {
-			return nil, fmt.Errorf("Failed to determine region for %s. Error: %s",
+			return fmt.Errorf("Failed to determine region for %s. Error: %s",
 				ctx.userdata.s3Bucket,
 				bucketRegionErr)
 		}
@@ -670,7 +773,7 @@ func verifyAWSPreconditions(ctx *workflowContext) (workflowStep, error) {
 			"Region": bucketRegion,
 		}).Info("Checking S3 region")
 		if bucketRegion != *ctx.context.awsSession.Config.Region {
-			return nil, fmt.Errorf("Target region (%s) does not match bucket region (%s)",
+			return fmt.Errorf("Target region (%s) does not match bucket region (%s)",
 				*ctx.context.awsSession.Config.Region,
 				bucketRegion)
 		}
@@ -722,7 +825,7 @@ func verifyAWSPreconditions(ctx *workflowContext) (workflowStep, error) {
 		}
 	}
 
-	return createPackageStep(), nil
+	return nil
 }
 
 func ensureMainEntrypoint(logger *logrus.Logger) error {
@@ -933,103 +1036,246 @@ func buildGoBinary(serviceName string,
 	return cmdError
 }
 
-// Build and package the application
-func createPackageStep() workflowStep {
-	return func(ctx *workflowContext) (workflowStep, error) {
-		defer recordDuration(time.Now(), "Creating code bundle", ctx)
+// codeArchiveModTime is the modification time of every entry in the code
+// archive. It's the earliest time the ZIP format supports.
+var codeArchiveModTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
 
-		// PreBuild Hook
-		if ctx.userdata.workflowHooks != nil {
-			preBuildErr := callWorkflowHook("PreBuild",
-				ctx.userdata.workflowHooks.PreBuild,
-				ctx.userdata.workflowHooks.PreBuilds,
-				ctx)
-			if nil != preBuildErr {
-				return nil, preBuildErr
-			}
-		}
-		sanitizedServiceName := sanitizedName(ctx.userdata.serviceName)
-		buildErr := buildGoBinary(ctx.userdata.serviceName,
-			ctx.context.binaryName,
-			ctx.userdata.useCGO,
-			ctx.userdata.buildID,
-			ctx.userdata.buildTags,
-			ctx.userdata.linkFlags,
-			ctx.userdata.noop,
-			ctx.logger)
-		if nil != buildErr {
-			return nil, buildErr
-		}
-		// Cleanup the temporary binary
-		defer func() {
-			errRemove := os.Remove(ctx.context.binaryName)
-			if nil != errRemove {
-				ctx.logger.WithFields(logrus.Fields{
-					"File":  ctx.context.binaryName,
-					"Error": errRemove,
-				}).Warn("Failed to delete binary")
-			}
-		}()
+// Build and package the application. Returns the path to the
+// code ZIP archive.
+func createPackage(ctx *workflowContext) (string, error) {
+	defer recordDuration(time.Now(), "Creating code bundle", ctx)
 
-		// PostBuild Hook
-		if ctx.userdata.workflowHooks != nil {
-			postBuildErr := callWorkflowHook("PostBuild",
-				ctx.userdata.workflowHooks.PostBuild,
-				ctx.userdata.workflowHooks.PostBuilds,
-				ctx)
-			if nil != postBuildErr {
-				return nil, postBuildErr
-			}
+	// PreBuild Hook
+	if ctx.userdata.workflowHooks != nil {
+		preBuildErr := callWorkflowHook("PreBuild",
+			ctx.userdata.workflowHooks.PreBuild,
+			ctx.userdata.workflowHooks.PreBuilds,
+			ctx)
+		if nil != preBuildErr {
+			return "", preBuildErr
 		}
-		tmpFile, err := temporaryFile(fmt.Sprintf("%s-code.zip", sanitizedServiceName))
-		if err != nil {
-			return nil, err
+	}
+	sanitizedServiceName := sanitizedName(ctx.userdata.serviceName)
+	buildErr := buildGoBinary(ctx.userdata.serviceName,
+		ctx.context.binaryName,
+		ctx.userdata.useCGO,
+		ctx.userdata.buildID,
+		ctx.userdata.buildTags,
+		ctx.userdata.linkFlags,
+		ctx.userdata.noop,
+		ctx.logger)
+	if nil != buildErr {
+		return "", buildErr
+	}
+	// Cleanup the temporary binary
+	defer func() {
+		errRemove := os.Remove(ctx.context.binaryName)
+		if nil != errRemove {
+			ctx.logger.WithFields(logrus.Fields{
+				"File":  ctx.context.binaryName,
+				"Error": errRemove,
+			}).Warn("Failed to delete binary")
 		}
-		// Strip the local directory in case it's in there...
-		ctx.logger.WithFields(logrus.Fields{
-			"TempName": relativePath(tmpFile.Name()),
-		}).Info("Creating code ZIP archive for upload")
-		lambdaArchive := zip.NewWriter(tmpFile)
+	}()
 
-		// Archive Hook
-		archiveErr := callArchiveHook(lambdaArchive, ctx)
-		if nil != archiveErr {
-			return nil, archiveErr
+	// PostBuild Hook
+	if ctx.userdata.workflowHooks != nil {
+		postBuildErr := callWorkflowHook("PostBuild",
+			ctx.userdata.workflowHooks.PostBuild,
+			ctx.userdata.workflowHooks.PostBuilds,
+			ctx)
+		if nil != postBuildErr {
+			return "", postBuildErr
 		}
+	}
+	tmpFile, err := temporaryFile(fmt.Sprintf("%s-code.zip", sanitizedServiceName))
+	if err != nil {
+		return "", err
+	}
+	// Strip the local directory in case it's in there...
+	ctx.logger.WithFields(logrus.Fields{
+		"TempName": relativePath(tmpFile.Name()),
+	}).Info("Creating code ZIP archive for upload")
+	lambdaArchive := zip.NewWriter(tmpFile)
+
+	// Archive Hook
+	archiveErr := callArchiveHook(lambdaArchive, ctx)
+	if nil != archiveErr {
+		return "", archiveErr
+	}
+	fileHeaderAnnotator := func(header *zip.FileHeader) (*zip.FileHeader, error) {
+		// Use a fixed timestamp so that the same binary always
+		// produces the same archive
+		header.Modified = codeArchiveModTime
 		// Issue: https://github.com/mweagle/Sparta/issues/103. If the executable
 		// bit isn't set, then AWS Lambda won't be able to fork the binary
-		var fileHeaderAnnotator spartaZip.FileHeaderAnnotator
 		if runtime.GOOS == "windows" {
-			fileHeaderAnnotator = func(header *zip.FileHeader) (*zip.FileHeader, error) {
-				// Make the binary executable
-				header.ExternalAttrs = 0777 << 16
-				return header, nil
-			}
+			// Make the binary executable
+			header.ExternalAttrs = 0777 << 16
 		}
-		// File info for the binary executable
-		readerErr := spartaZip.AnnotateAddToZip(lambdaArchive,
-			ctx.context.binaryName,
-			"",
-			fileHeaderAnnotator,
-			ctx.logger)
-		if nil != readerErr {
-			return nil, readerErr
+		return header, nil
+	}
+	// File info for the binary executable
+	readerErr := spartaZip.AnnotateAddToZip(lambdaArchive,
+		ctx.context.binaryName,
+		"",
+		fileHeaderAnnotator,
+		ctx.logger)
+	if nil != readerErr {
+		return "", readerErr
+	}
+	archiveCloseErr := lambdaArchive.Close()
+	if nil != archiveCloseErr {
+		return "", archiveCloseErr
+	}
+	tempfileCloseErr := tmpFile.Close()
+	if nil != tempfileCloseErr {
+		return "", tempfileCloseErr
+	}
+	return tmpFile.Name(), nil
+}
+
+// createCachedPackage returns the code ZIP archive from the build cache,
+// if it's available. Otherwise the archive is built and stored in the
+// cache for subsequent runs.
+func createCachedPackage(ctx *workflowContext) (string, error) {
+	cache := ctx.context.buildCache
+	cacheDir := ""
+	if nil != cache {
+		cacheDir = filepath.Dir(cache.archivePath)
+	}
+	if nil != cache && cache.hit() {
+		defer recordDuration(time.Now(), "Creating code bundle (cached)", ctx)
+		ctx.logger.WithFields(logrus.Fields{
+			"Path": relativePath(cache.archivePath),
+		}).Info("Using cached code archive")
+		// Mark it as recently used so that it isn't pruned
+		now := time.Now()
+		touchErr := os.Chtimes(cacheDir, now, now)
+		if nil != touchErr {
+			ctx.logger.WithFields(logrus.Fields{
+				"Error": touchErr,
+			}).Debug("Failed to update build cache entry time")
 		}
-		archiveCloseErr := lambdaArchive.Close()
-		if nil != archiveCloseErr {
-			return nil, archiveCloseErr
+		return cache.archivePath, nil
+	}
+	packagePath, packageErr := createPackage(ctx)
+	if nil != packageErr || nil == cache {
+		return packagePath, packageErr
+	}
+	storeErr := cache.store(packagePath)
+	if nil != storeErr {
+		return "", storeErr
+	}
+	pruneBuildCache(filepath.Dir(cacheDir), buildCacheRetentionCount, ctx.logger)
+	return cache.archivePath, nil
+}
+
+// createS3SiteArchive creates the ZIP archive of the S3Site resources.
+// Returns the path to the archive.
+func createS3SiteArchive(ctx *workflowContext) (string, error) {
+	defer recordDuration(time.Now(), "Creating S3 site archive", ctx)
+
+	tempName := fmt.Sprintf("%s-S3Site.zip", ctx.userdata.serviceName)
+	tmpFile, err := temporaryFile(tempName)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to create temporary S3 site archive file")
+	}
+
+	// Add the contents to the Zip file
+	zipArchive := zip.NewWriter(tmpFile)
+	absResourcePath, err := filepath.Abs(ctx.userdata.s3SiteContext.s3Site.resources)
+	if nil != err {
+		return "", errors.Wrapf(err, "Failed to get absolute filepath")
+	}
+
+	ctx.logger.WithFields(logrus.Fields{
+		"S3Key":      path.Base(tmpFile.Name()),
+		"SourcePath": absResourcePath,
+	}).Info("Creating S3Site archive")
+
+	err = spartaZip.AddToZip(zipArchive, absResourcePath, absResourcePath, ctx.logger)
+	if nil != err {
+		return "", err
+	}
+	errClose := zipArchive.Close()
+	if errClose != nil {
+		return "", errClose
+	}
+	tempfileCloseErr := tmpFile.Close()
+	if nil != tempfileCloseErr {
+		return "", tempfileCloseErr
+	}
+	return tmpFile.Name(), nil
+}
+
+// verifyAndBuildStep verifies the IAM roles and then concurrently verifies
+// the AWS preconditions while the code and optional S3 site archives are
+// created. The IAM role verification adds the role resources to the
+// template and applies the profile decorator to the service functions, so
+// it completes before the concurrent tasks read them.
+func verifyAndBuildStep() workflowStep {
+	return func(ctx *workflowContext) (workflowStep, error) {
+		defer recordDuration(time.Now(), "Verifying & building (elapsed)", ctx)
+
+		verifyErr := verifyIAMRoles(ctx)
+		if nil != verifyErr {
+			return nil, verifyErr
+		}
+		packagePath := ""
+		siteArchivePath := ""
+		tasks := []*workTask{
+			newWorkTask(func() workResult {
+				return newTaskResult(nil, verifyAWSPreconditions(ctx))
+			}),
+		}
+		// A multi-region provision has already built the archives
+		if nil != ctx.context.regional {
+			packagePath = ctx.context.regional.packagePath
+			siteArchivePath = ctx.context.regional.siteArchivePath
+		} else {
+			buildCache, buildCacheErr := newBuildCache(ctx)
+			if nil != buildCacheErr {
+				return nil, buildCacheErr
+			}
+			ctx.context.buildCache = buildCache
+			tasks = append(tasks, newWorkTask(func() workResult {
+				var packageErr error
+				packagePath, packageErr = createCachedPackage(ctx)
+				return newTaskResult(packagePath, packageErr)
+			}))
+		}
+		if nil == ctx.context.regional && nil != ctx.userdata.s3SiteContext.s3Site {
+			tasks = append(tasks, newWorkTask(func() workResult {
+				var siteErr error
+				siteArchivePath, siteErr = createS3SiteArchive(ctx)
+				return newTaskResult(siteArchivePath, siteErr)
+			}))
+		}
+		if nil == ctx.context.regional {
+			layers, layersErr := serviceLambdaLayers(ctx.userdata.lambdaAWSInfos)
+			if nil != layersErr {
+				return nil, layersErr
+			}
+			for _, eachLayer := range layers {
+				layer := eachLayer
+				tasks = append(tasks, newWorkTask(func() workResult {
+					return newTaskResult(layer, createLambdaLayerArchive(layer, ctx))
+				}))
+			}
 		}
-		tempfileCloseErr := tmpFile.Close()
-		if nil != tempfileCloseErr {
-			return nil, tempfileCloseErr
+		p := newWorkerPool(tasks, len(tasks))
+		_, taskErrors := p.Run()
+		if len(taskErrors) != 0 {
+			return nil, errors.Errorf("Failed to verify and build service: %v", taskErrors)
 		}
-		return createUploadStep(tmpFile.Name()), nil
+		return createUploadStep(packagePath, siteArchivePath), nil
 	}
 }
 
 // Given the zipped binary in packagePath, upload the primary code bundle
-// and optional S3 site resources iff they're defined.
-func createUploadStep(packagePath string) workflowStep {
+// and optional S3 site archive iff it's defined.
+func createUploadStep(packagePath string, siteArchivePath string) workflowStep {
 	return func(ctx *workflowContext) (workflowStep, error) {
 		defer recordDuration(time.Now(), "Uploading code", ctx)
 
@@ -1039,7 +1285,10 @@ func createUploadStep(packagePath string) workflowStep {
 			logFilesize("Lambda code archive size", packagePath, ctx.logger)
 
 			// Create the S3 key...
-			zipS3URL, zipS3URLErr := uploadLocalFileToS3(packagePath, "", ctx)
+			zipS3URL, zipS3URLErr := uploadFileToS3(packagePath,
+				"",
+				nil == ctx.context.buildCache && nil == ctx.context.regional,
+				ctx)
 			if nil != zipS3URLErr {
 				return newTaskResult(nil, zipS3URLErr)
 			}
@@ -1049,38 +1298,13 @@ func createUploadStep(packagePath string) workflowStep {
 		uploadTasks = append(uploadTasks, newWorkTask(uploadBinaryTask))
 
 		// We might need to upload some other things...
-		if nil != ctx.userdata.s3SiteContext.s3Site {
+		if "" != siteArchivePath {
 			uploadSiteTask := func() workResult {
-				tempName := fmt.Sprintf("%s-S3Site.zip", ctx.userdata.serviceName)
-				tmpFile, err := temporaryFile(tempName)
-				if err != nil {
-					return newTaskResult(nil,
-						errors.Wrapf(err, "Failed to create temporary S3 site archive file"))
-				}
-
-				// Add the contents to the Zip file
-				zipArchive := zip.NewWriter(tmpFile)
-				absResourcePath, err := filepath.Abs(ctx.userdata.s3SiteContext.s3Site.resources)
-				if nil != err {
-					return newTaskResult(nil, errors.Wrapf(err, "Failed to get absolute filepath"))
-				}
-
-				ctx.logger.WithFields(logrus.Fields{
-					"S3Key":      path.Base(tmpFile.Name()),
-					"SourcePath": absResourcePath,
-				}).Info("Creating S3Site archive")
-
-				err = spartaZip.AddToZip(zipArchive, absResourcePath, absResourcePath, ctx.logger)
-				if nil != err {
-					return newTaskResult(nil, err)
-				}
-				errClose := zipArchive.Close()
-				if errClose != nil {
-					return newTaskResult(nil, errClose)
-				}
-
 				// Upload it & save the key
-				s3SiteLambdaZipURL, s3SiteLambdaZipURLErr := uploadLocalFileToS3(tmpFile.Name(), "", ctx)
+				s3SiteLambdaZipURL, s3SiteLambdaZipURLErr := uploadFileToS3(siteArchivePath,
+					"",
+					nil == ctx.context.regional,
+					ctx)
 				if s3SiteLambdaZipURLErr != nil {
 					return newTaskResult(nil,
 						errors.Wrapf(s3SiteLambdaZipURLErr, "Failed to upload local file to S3"))
@@ -1089,7 +1313,31 @@ func createUploadStep(packagePath string) workflowStep {
 				return newTaskResult(ctx.userdata.s3SiteContext.s3UploadURL, nil)
 			}
 			uploadTasks = append(uploadTasks, newWorkTask(uploadSiteTask))
-
+		}
+		// Layer archives are content addressed, so unchanged layers
+		// aren't uploaded again
+		layers, layersErr := serviceLambdaLayers(ctx.userdata.lambdaAWSInfos)
+		if nil != layersErr {
+			return nil, layersErr
+		}
+		layerUploadURLs := make([]*s3UploadURL, len(layers))
+		for eachIndex, eachLayer := range layers {
+			layerIndex := eachIndex
+			layer := eachLayer
+			uploadTasks = append(uploadTasks, newWorkTask(func() workResult {
+				logFilesize(fmt.Sprintf("%s layer archive size", layer.Name),
+					layer.archivePath,
+					ctx.logger)
+				layerS3URL, layerS3URLErr := uploadFileToS3(layer.archivePath,
+					"",
+					nil == ctx.context.regional,
+					ctx)
+				if nil != layerS3URLErr {
+					return newTaskResult(nil, layerS3URLErr)
+				}
+				layerUploadURLs[layerIndex] = newS3UploadURL(layerS3URL)
+				return newTaskResult(layerUploadURLs[layerIndex], nil)
+			}))
 		}
 
 		// Run it and figure out what happened
@@ -1099,6 +1347,10 @@ func createUploadStep(packagePath string) workflowStep {
 		if len(uploadErrors) > 0 {
 			return nil, errors.Errorf("Encountered multiple errors during upload: %#v", uploadErrors)
 		}
+		ctx.context.lambdaLayerURLs = make(map[*LambdaLayer]*s3UploadURL)
+		for eachIndex, eachLayer := range layers {
+			ctx.context.lambdaLayerURLs[eachLayer] = layerUploadURLs[eachIndex]
+		}
 		return validateSpartaPostconditions(), nil
 	}
 }
@@ -1181,22 +1433,75 @@ func createCodePipelineTriggerPackage(cfTemplateJSON []byte, ctx *workflowContex
 // If the only detected changes to a stack are Lambda code updates,
 // then update use the LAmbda API to update the code directly
 // rather than waiting for CloudFormation
+// validateInPlaceUpdates returns an error if a function can't be updated
+// in place. In-place updates only replace the $LATEST code, so functions
+// with an alias would keep invoking the previously published version.
+func validateInPlaceUpdates(lambdaAWSInfos []*LambdaAWSInfo) error {
+	for _, eachLambdaInfo := range lambdaAWSInfos {
+		if nil != eachLambdaInfo.Options && nil != eachLambdaInfo.Options.Alias {
+			return errors.Errorf("Function %s defines the %s alias and can't be updated with --inplace. Provision without --inplace to publish a new version",
+				eachLambdaInfo.lambdaFunctionName(),
+				eachLambdaInfo.Options.Alias.Name)
+		}
+	}
+	return nil
+}
+
 func applyInPlaceFunctionUpdates(ctx *workflowContext, templateURL string) (*cloudformation.Stack, error) {
 	// Get the updates...
 	awsCloudFormation := cloudformation.New(ctx.context.awsSession)
 	changeSetRequestName := CloudFormationResourceName(fmt.Sprintf("%sInPlaceChangeSet", ctx.userdata.serviceName))
-	changes, changesErr := spartaCF.CreateStackChangeSet(changeSetRequestName,
+	awsParameters, awsParametersErr := spartaCF.StackParameters(ctx.userdata.serviceName,
+		ctx.context.cfTemplate,
+		ctx.userdata.templateParameterValues,
+		awsCloudFormation)
+	if nil != awsParametersErr {
+		return nil, awsParametersErr
+	}
+	changes, changesErr := spartaCF.CreateStackChangeSetWithParameters(changeSetRequestName,
 		ctx.userdata.serviceName,
 		ctx.context.cfTemplate,
 		templateURL,
+		awsParameters,
 		nil,
 		awsCloudFormation,
 		ctx.logger)
 	if nil != changesErr {
 		return nil, changesErr
 	}
+	// Describe the stack so that we can satisfy the contract with the
+	// normal path using CloudFormation
+	describeStack := func() (*cloudformation.Stack, error) {
+		describeStacksInput := &cloudformation.DescribeStacksInput{
+			StackName: aws.String(ctx.userdata.serviceName),
+		}
+		describeStackOutput, describeStackOutputErr := awsCloudFormation.DescribeStacks(describeStacksInput)
+		if nil != describeStackOutputErr {
+			return nil, describeStackOutputErr
+		}
+		return describeStackOutput.Stacks[0], nil
+	}
+	// Identical content addressed code archives don't produce changes
 	if nil == changes || len(changes.Changes) <= 0 {
-		return nil, fmt.Errorf("No changes detected")
+		ctx.logger.Info("No Lambda function code changes detected")
+		return describeStack()
+	}
+	if nil != ctx.userdata.changeApprover {
+		approved, approvedErr := ctx.userdata.changeApprover(ctx.userdata.serviceName, changes.Changes)
+		if nil == approvedErr && !approved {
+			approvedErr = errors.Errorf("Changes to stack %s were not approved", ctx.userdata.serviceName)
+		}
+		if nil != approvedErr {
+			_, deleteChangeSetResultErr := spartaCF.DeleteChangeSet(ctx.userdata.serviceName,
+				changeSetRequestName,
+				awsCloudFormation)
+			if nil != deleteChangeSetResultErr {
+				ctx.logger.WithFields(logrus.Fields{
+					"Error": deleteChangeSetResultErr,
+				}).Warn("Failed to delete unapproved ChangeSet")
+			}
+			return nil, approvedErr
+		}
 	}
 	updateCodeRequests := []*lambda.UpdateFunctionCodeInput{}
 	invalidInPlaceRequests := []string{}
@@ -1259,16 +1564,53 @@ func applyInPlaceFunctionUpdates(ctx *workflowContext, templateURL string) (*clo
 	if len(asyncErrors) != 0 {
 		return nil, fmt.Errorf("Failed to update function code: %v", asyncErrors)
 	}
-	// Describe the stack so that we can satisfy the contract with the
-	// normal path using CloudFormation
-	describeStacksInput := &cloudformation.DescribeStacksInput{
-		StackName: aws.String(ctx.userdata.serviceName),
+	return describeStack()
+}
+
+// readStackPolicy returns the stack policy document in the JSON file
+func readStackPolicy(policyPath string) (*spartaCF.StackPolicyDocument, error) {
+	/* #nosec */
+	policyJSON, policyJSONErr := ioutil.ReadFile(policyPath)
+	if nil != policyJSONErr {
+		return nil, errors.Wrapf(policyJSONErr, "Failed to read stack policy")
+	}
+	var stackPolicy spartaCF.StackPolicyDocument
+	unmarshalErr := json.Unmarshal(policyJSON, &stackPolicy)
+	if nil != unmarshalErr {
+		return nil, errors.Wrapf(unmarshalErr, "Failed to parse stack policy %s", policyPath)
 	}
-	describeStackOutput, describeStackOutputErr := awsCloudFormation.DescribeStacks(describeStacksInput)
-	if nil != describeStackOutputErr {
-		return nil, describeStackOutputErr
+	if len(stackPolicy.Statement) == 0 {
+		return nil, errors.Errorf("Stack policy %s does not include any statements", policyPath)
 	}
-	return describeStackOutput.Stacks[0], nil
+	return &stackPolicy, nil
+}
+
+// applyStackProtection applies the optional stack policy and enables
+// termination protection for the service stack
+func applyStackProtection(ctx *workflowContext) error {
+	if nil != ctx.userdata.stackPolicy {
+		policyErr := spartaCF.SetStackPolicy(ctx.userdata.serviceName,
+			ctx.userdata.stackPolicy,
+			ctx.context.awsSession,
+			ctx.logger)
+		if nil != policyErr {
+			return policyErr
+		}
+	}
+	if ctx.userdata.terminationProtection {
+		enabled, enabledErr := spartaCF.StackTerminationProtection(ctx.userdata.serviceName,
+			ctx.context.awsSession)
+		if nil != enabledErr {
+			return enabledErr
+		}
+		if !enabled {
+			return spartaCF.UpdateTerminationProtection(ctx.userdata.serviceName,
+				true,
+				ctx.context.awsSession,
+				ctx.logger)
+		}
+	}
+	return nil
 }
 
 // applyCloudFormationOperation is responsible for taking the current template
@@ -1278,10 +1620,16 @@ func applyInPlaceFunctionUpdates(ctx *workflowContext, templateURL string) (*clo
 func applyCloudFormationOperation(ctx *workflowContext) (workflowStep, error) {
 	stackTags := map[string]string{
 		SpartaTagBuildIDKey: ctx.userdata.buildID,
+		SpartaTagVersionKey: SpartaVersion,
 	}
 	if len(ctx.userdata.buildTags) != 0 {
 		stackTags[SpartaTagBuildTagsKey] = ctx.userdata.buildTags
 	}
+	// Large services are provisioned as a set of nested stacks
+	nestedErr := ensureNestedStacks(ctx)
+	if nil != nestedErr {
+		return nil, nestedErr
+	}
 	// Generate the CF template...
 	cfTemplate, err := json.Marshal(ctx.context.cfTemplate)
 	if err != nil {
@@ -1337,6 +1685,24 @@ func applyCloudFormationOperation(ctx *workflowContext) (workflowStep, error) {
 				return nil, uploadURLErr
 			}
 
+			// If this is a plan, report the changes and stop
+			if ctx.userdata.plan {
+				return nil, planCloudFormationOperation(ctx, uploadURL)
+			}
+			// The stack policy must be in place before an update is applied.
+			// A new stack is protected once it exists.
+			stackExists, stackExistsErr := spartaCF.StackExists(ctx.userdata.serviceName,
+				ctx.context.awsSession,
+				ctx.logger)
+			if nil != stackExistsErr {
+				return nil, stackExistsErr
+			}
+			if stackExists {
+				protectErr := applyStackProtection(ctx)
+				if nil != protectErr {
+					return nil, protectErr
+				}
+			}
 			// If we're supposed to be inplace, then go ahead and try that
 			var stack *cloudformation.Stack
 			var stackErr error
@@ -1344,13 +1710,15 @@ func applyCloudFormationOperation(ctx *workflowContext) (workflowStep, error) {
 				stack, stackErr = applyInPlaceFunctionUpdates(ctx, uploadURL)
 			} else {
 				// Regular update, go ahead with the CloudFormation changes
-				stack, stackErr = spartaCF.ConvergeStackState(ctx.userdata.serviceName,
+				stack, stackErr = spartaCF.ConvergeStackStateWithApproval(ctx.userdata.serviceName,
 					ctx.context.cfTemplate,
 					uploadURL,
+					ctx.userdata.templateParameterValues,
 					stackTags,
 					ctx.transaction.startTime,
 					ctx.context.awsSession,
 					subheaderDivider,
+					ctx.userdata.changeApprover,
 					ctx.logger)
 			}
 			if nil != stackErr {
@@ -1361,6 +1729,31 @@ func applyCloudFormationOperation(ctx *workflowContext) (workflowStep, error) {
 				"StackId":      *stack.StackId,
 				"CreationTime": *stack.CreationTime,
 			}).Info("Stack provisioned")
+			if !stackExists {
+				protectErr := applyStackProtection(ctx)
+				if nil != protectErr {
+					return nil, protectErr
+				}
+			}
+
+			// Record the build s.t. its artifacts are retained by gc
+			manifestErr := uploadBuildManifest(ctx, uploadURL)
+			if nil != manifestErr {
+				return nil, manifestErr
+			}
+			if ctx.userdata.gcKeepCount > 0 {
+				pruneErr := pruneServiceObjects(ctx.userdata.serviceName,
+					ctx.userdata.s3Bucket,
+					ctx.userdata.gcKeepCount,
+					false,
+					ctx.context.awsSession,
+					ctx.logger)
+				if nil != pruneErr {
+					ctx.logger.WithFields(logrus.Fields{
+						"Error": pruneErr,
+					}).Warn("Failed to prune S3 artifacts")
+				}
+			}
 		}
 	} else {
 		ctx.logger.Info("Creating pipeline package")
@@ -1435,6 +1828,13 @@ func ensureCloudFormationStack() workflowStep {
 		}
 		defer recordDuration(time.Now(), msg, ctx)
 
+		// Regional workflows share the service definition that's
+		// annotated below
+		if nil != ctx.context.regional {
+			ctx.context.regional.templateMutex.Lock()
+			defer ctx.context.regional.templateMutex.Unlock()
+		}
+
 		// PreMarshall Hook
 		if ctx.userdata.workflowHooks != nil {
 			preMarshallErr := callWorkflowHook("PreMarshall",
@@ -1447,10 +1847,19 @@ func ensureCloudFormationStack() workflowStep {
 		}
 
 		// Add the "Parameters" to the template...
-		if nil != codePipelineEnvironments {
+		if nil == ctx.context.cfTemplate.Parameters {
 			ctx.context.cfTemplate.Parameters = make(map[string]*gocf.Parameter)
+		}
+		for eachKey, eachParameter := range ctx.userdata.templateParameters {
+			ctx.context.cfTemplate.Parameters[eachKey] = eachParameter
+		}
+		if nil != codePipelineEnvironments {
 			for _, eachEnvironment := range codePipelineEnvironments {
 				for eachKey := range eachEnvironment {
+					if _, exists := ctx.userdata.templateParameters[eachKey]; exists {
+						return nil, errors.Errorf("CodePipeline environment variable %s conflicts with the template parameter of the same name",
+							eachKey)
+					}
 					ctx.context.cfTemplate.Parameters[eachKey] = &gocf.Parameter{
 						Type:    "String",
 						Default: "",
@@ -1458,12 +1867,18 @@ func ensureCloudFormationStack() workflowStep {
 				}
 			}
 		}
+		// Layers are shared by the functions that include them
+		layersErr := exportLambdaLayers(ctx)
+		if nil != layersErr {
+			return nil, layersErr
+		}
 		for _, eachEntry := range ctx.userdata.lambdaAWSInfos {
 			verifyErr := verifyLambdaPreconditions(eachEntry, ctx.logger)
 			if verifyErr != nil {
 				return nil, verifyErr
 			}
 			annotateCodePipelineEnvironments(eachEntry, ctx.logger)
+			annotateStage(eachEntry, ctx.userdata.stage, ctx.logger)
 
 			err := eachEntry.export(ctx.userdata.serviceName,
 				ctx.context.binaryName,
@@ -1485,7 +1900,7 @@ func ensureCloudFormationStack() workflowStep {
 		apiGatewayTemplate := gocf.NewTemplate()
 
 		if nil != ctx.userdata.api {
-			err := ctx.userdata.api.export(
+			err := ctx.userdata.api.stageAPI(ctx.userdata.stage).export(
 				ctx.userdata.serviceName,
 				ctx.context.awsSession,
 				ctx.userdata.s3Bucket,
@@ -1577,10 +1992,15 @@ func ensureCloudFormationStack() workflowStep {
 			return nil, errors.Wrapf(annotateErr,
 				"Failed to perform final template annotations")
 		}
+		// The published versions depend on the final function properties
+		aliasErr := annotateLambdaAliases(ctx)
+		if nil != aliasErr {
+			return nil, aliasErr
+		}
 		// Finally, anything we need to do here to patch up any template references
 		// across resources?
 
-		return applyCloudFormationOperation(ctx)
+		return applyCloudFormationOperation, nil
 	}
 }
 
@@ -1615,11 +2035,74 @@ func Provision(noop bool,
 	workflowHooks *WorkflowHooks,
 	logger *logrus.Logger) error {
 
+	ctx, ctxErr := newWorkflowContext(noop,
+		serviceName,
+		serviceDescription,
+		lambdaAWSInfos,
+		api,
+		site,
+		s3Bucket,
+		useCGO,
+		inPlaceUpdates,
+		buildID,
+		codePipelineTrigger,
+		buildTags,
+		linkerFlags,
+		templateWriter,
+		workflowHooks,
+		logger)
+	if nil != ctxErr {
+		return ctxErr
+	}
+	return provisionService(ctx)
+}
+
+// provisionService runs the provisioning workflow for the
+// configured context
+func provisionService(ctx *workflowContext) error {
+	ctx.logger.WithFields(logrus.Fields{
+		"BuildID":             ctx.userdata.buildID,
+		"NOOP":                ctx.userdata.noop,
+		"Tags":                ctx.userdata.buildTags,
+		"CodePipelineTrigger": ctx.userdata.codePipelineTrigger,
+		"InPlaceUpdates":      ctx.userdata.inPlace,
+		"ApprovalRequired":    nil != ctx.userdata.changeApprover,
+	}).Info("Provisioning service")
+	return runWorkflow(ctx)
+}
+
+// newWorkflowContext validates the user inputs and returns the
+// workflowContext shared by the workflow steps
+func newWorkflowContext(noop bool,
+	serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api *API,
+	site *S3Site,
+	s3Bucket string,
+	useCGO bool,
+	inPlaceUpdates bool,
+	buildID string,
+	codePipelineTrigger string,
+	buildTags string,
+	linkerFlags string,
+	templateWriter io.Writer,
+	workflowHooks *WorkflowHooks,
+	logger *logrus.Logger) (*workflowContext, error) {
+
 	err := validateSpartaPreconditions(lambdaAWSInfos, logger)
 	if nil != err {
-		return errors.Wrapf(err, "Failed to validate preconditions")
+		return nil, errors.Wrapf(err, "Failed to validate preconditions")
+	}
+	if len(lambdaAWSInfos) <= 0 {
+		return nil, errors.New("No lambda functions provided to Sparta.Provision()")
+	}
+	if inPlaceUpdates {
+		inPlaceErr := validateInPlaceUpdates(lambdaAWSInfos)
+		if nil != inPlaceErr {
+			return nil, inPlaceErr
+		}
 	}
-	startTime := time.Now()
 
 	ctx := &workflowContext{
 		logger: logger,
@@ -1631,6 +2114,7 @@ func Provision(noop bool,
 			buildTags:          buildTags,
 			linkFlags:          linkerFlags,
 			serviceName:        serviceName,
+			stage:              OptionsGlobal.Stage,
 			serviceDescription: serviceDescription,
 			lambdaAWSInfos:     lambdaAWSInfos,
 			api:                api,
@@ -1655,32 +2139,74 @@ func Provision(noop bool,
 	}
 	ctx.context.cfTemplate.Description = serviceDescription
 
+	// The build ID is stamped into the binary, so the build cache can
+	// only be used for a supplied build ID
+	if "" == ctx.userdata.buildID {
+		buildID, buildIDErr := provisionBuildID(ctx.userdata.buildID)
+		if nil != buildIDErr {
+			return nil, buildIDErr
+		}
+		ctx.userdata.buildID = buildID
+	} else {
+		workingDir, workingDirErr := os.Getwd()
+		if nil != workingDirErr {
+			return nil, workingDirErr
+		}
+		inputsHash, inputsHashErr := buildInputsHash(workingDir, ctx)
+		if nil != inputsHashErr {
+			return nil, inputsHashErr
+		}
+		ctx.context.buildInputsHash = inputsHash
+	}
+
 	// Update the context iff it exists
 	if nil != workflowHooks && nil != workflowHooks.Context {
 		for eachKey, eachValue := range workflowHooks.Context {
 			ctx.context.workflowHooksContext[eachKey] = eachValue
 		}
 	}
+	if nil != workflowHooks {
+		ctx.userdata.stackPolicy = workflowHooks.StackPolicy
+		ctx.userdata.terminationProtection = workflowHooks.TerminationProtection
+		templateParameters, templateParametersErr := templateParameterDefinitions(workflowHooks.TemplateParameters)
+		if nil != templateParametersErr {
+			return nil, templateParametersErr
+		}
+		ctx.userdata.templateParameters = templateParameters
+	}
+	return ctx, nil
+}
 
-	ctx.logger.WithFields(logrus.Fields{
-		"BuildID":             buildID,
-		"NOOP":                noop,
-		"Tags":                ctx.userdata.buildTags,
-		"CodePipelineTrigger": ctx.userdata.codePipelineTrigger,
-		"InPlaceUpdates":      ctx.userdata.inPlace,
-	}).Info("Provisioning service")
-
-	if len(lambdaAWSInfos) <= 0 {
-		return errors.New("No lambda functions provided to Sparta.Provision()")
+// workflowStepName returns the name of the function that created the
+// workflow step (eg, verifyAndBuildStep)
+func workflowStepName(step workflowStep) string {
+	stepName := path.Base(runtime.FuncForPC(reflect.ValueOf(step).Pointer()).Name())
+	nameParts := strings.Split(stepName, ".")
+	if len(nameParts) > 1 {
+		return nameParts[1]
 	}
+	return stepName
+}
+
+// runWorkflow executes the workflow steps, followed by any registered
+// finalizers
+func runWorkflow(ctx *workflowContext) error {
+	startTime := ctx.transaction.startTime
 
 	// Start the workflow
-	for step := verifyIAMRoles; step != nil; {
-		next, err := step(ctx)
+	for step := verifyAndBuildStep(); step != nil; {
+		var next workflowStep
+		var err error
+		// Don't start another step if a multi-region provision has failed
+		if nil != ctx.context.regional {
+			err = ctx.context.regional.stoppedError()
+		}
+		if nil == err {
+			next, err = step(ctx)
+		}
 		if err != nil {
 			ctx.rollback()
-			// Workflow step?
-			return errors.Wrapf(err, "Failed to verify IAM roles")
+			return errors.Wrapf(err, "Failed to execute %s", workflowStepName(step))
 		}
 
 		if next == nil {
@@ -0,0 +1,190 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// buildCacheDirectory is the ScratchDirectory relative path that
+// stores the cached build results
+const buildCacheDirectory = "cache"
+
+// buildCacheRetentionCount is the number of cached code archives
+// that are retained
+const buildCacheRetentionCount = 5
+
+// buildCache is the ScratchDirectory cache of the code archive, keyed
+// by the hash of the build inputs and the supplied build ID. It allows a
+// provision that failed after the upload, for instance due to a transient
+// CloudFormation error, to be re-run with the same build ID without
+// rebuilding the code.
+type buildCache struct {
+	key         string
+	archivePath string
+}
+
+// hit returns true if there is a cached code archive for the build inputs
+func (cache *buildCache) hit() bool {
+	_, statErr := os.Stat(cache.archivePath)
+	return nil == statErr
+}
+
+// store moves the code archive into the cache
+func (cache *buildCache) store(archivePath string) error {
+	mkdirErr := os.MkdirAll(filepath.Dir(cache.archivePath), os.ModePerm)
+	if nil != mkdirErr {
+		return errors.Wrapf(mkdirErr, "Failed to create build cache directory")
+	}
+	renameErr := os.Rename(archivePath, cache.archivePath)
+	if nil != renameErr {
+		return errors.Wrapf(renameErr, "Failed to cache code archive")
+	}
+	return nil
+}
+
+// fileContentHash returns the hex encoded SHA256 hash of the file contents
+func fileContentHash(localPath string) (string, error) {
+	/* #nosec */
+	reader, readerErr := os.Open(localPath)
+	if nil != readerErr {
+		return "", readerErr
+	}
+	defer reader.Close()
+	hash := sha256.New()
+	_, copyErr := io.Copy(hash, reader)
+	if nil != copyErr {
+		return "", errors.Wrapf(copyErr, "Failed to hash %s", localPath)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// buildInputsHash returns the hash of the inputs that determine the
+// contents of the binary: the files in the working directory, including
+// the dependency manifests, cgo sources and assets, and the build options.
+// Dependencies outside the working directory that aren't pinned by a
+// manifest aren't included.
+func buildInputsHash(workingDir string, ctx *workflowContext) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n%s\n%s\n%s\n%t\n",
+		SpartaVersion,
+		runtime.Version(),
+		ctx.userdata.serviceName,
+		ctx.userdata.buildTags,
+		ctx.userdata.linkFlags,
+		ctx.userdata.useCGO)
+
+	inputFiles := make([]string, 0)
+	walkErr := filepath.Walk(workingDir, func(path string, info os.FileInfo, err error) error {
+		if nil != err {
+			return err
+		}
+		if info.IsDir() {
+			if path != workingDir &&
+				(strings.HasPrefix(info.Name(), ".") || "node_modules" == info.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			inputFiles = append(inputFiles, path)
+		}
+		return nil
+	})
+	if nil != walkErr {
+		return "", errors.Wrapf(walkErr, "Failed to enumerate build inputs")
+	}
+	sort.Strings(inputFiles)
+	for _, eachFile := range inputFiles {
+		relPath, _ := filepath.Rel(workingDir, eachFile)
+		fileHash, fileHashErr := fileContentHash(eachFile)
+		if nil != fileHashErr {
+			return "", fileHashErr
+		}
+		fmt.Fprintf(hash, "%s %s\n", filepath.ToSlash(relPath), fileHash)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// newBuildCache returns the build cache for the workflow. The cache is
+// disabled, and nil is returned, if the build ID was generated or if there
+// are build or archive hooks since their output can't be included in the
+// cache key.
+func newBuildCache(ctx *workflowContext) (*buildCache, error) {
+	if "" == ctx.context.buildInputsHash {
+		ctx.logger.Debug("Build cache disabled for generated build ID")
+		return nil, nil
+	}
+	hooks := ctx.userdata.workflowHooks
+	if nil != hooks &&
+		(nil != hooks.PreBuild ||
+			nil != hooks.PostBuild ||
+			nil != hooks.Archive ||
+			len(hooks.PreBuilds) != 0 ||
+			len(hooks.PostBuilds) != 0 ||
+			len(hooks.Archives) != 0) {
+		ctx.logger.Debug("Build cache disabled due to build WorkflowHooks")
+		return nil, nil
+	}
+	workingDir, workingDirErr := os.Getwd()
+	if nil != workingDirErr {
+		return nil, workingDirErr
+	}
+	// The build ID is stamped into the binary, so it's part of the key
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n", ctx.context.buildInputsHash, ctx.userdata.buildID)
+	cacheKey := hex.EncodeToString(hash.Sum(nil))
+
+	cache := &buildCache{
+		key: cacheKey,
+		archivePath: filepath.Join(workingDir,
+			ScratchDirectory,
+			buildCacheDirectory,
+			cacheKey,
+			fmt.Sprintf("%s-code.zip", sanitizedName(ctx.userdata.serviceName))),
+	}
+	ctx.logger.WithFields(logrus.Fields{
+		"Key": cacheKey,
+		"Hit": cache.hit(),
+	}).Debug("Build cache")
+	return cache, nil
+}
+
+// pruneBuildCache deletes all but the keepCount most recently
+// created cache entries
+func pruneBuildCache(cacheDir string, keepCount int, logger *logrus.Logger) {
+	entries, entriesErr := filepath.Glob(filepath.Join(cacheDir, "*"))
+	if nil != entriesErr || len(entries) <= keepCount {
+		return
+	}
+	modTime := func(filePath string) int64 {
+		stat, statErr := os.Stat(filePath)
+		if nil != statErr {
+			return 0
+		}
+		return stat.ModTime().UnixNano()
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return modTime(entries[i]) > modTime(entries[j])
+	})
+	for _, eachEntry := range entries[keepCount:] {
+		removeErr := os.RemoveAll(eachEntry)
+		if nil != removeErr {
+			logger.WithFields(logrus.Fields{
+				"Path":  relativePath(eachEntry),
+				"Error": removeErr,
+			}).Warn("Failed to prune build cache")
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildCacheStore(t *testing.T) {
+	cacheDir, cacheDirErr := ioutil.TempDir("", "sparta-cache")
+	if nil != cacheDirErr {
+		t.Fatal(cacheDirErr)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	cache := &buildCache{
+		key:         "testKey",
+		archivePath: filepath.Join(cacheDir, "testKey", "service-code.zip"),
+	}
+	if cache.hit() {
+		t.Fatalf("Expected empty build cache")
+	}
+	packagePath := filepath.Join(cacheDir, "service-code.zip")
+	writeErr := ioutil.WriteFile(packagePath, []byte("archive"), os.ModePerm)
+	if nil != writeErr {
+		t.Fatal(writeErr)
+	}
+	storeErr := cache.store(packagePath)
+	if nil != storeErr {
+		t.Fatal(storeErr)
+	}
+	if !cache.hit() {
+		t.Fatalf("Expected build cache hit")
+	}
+}
+
+func TestPruneBuildCache(t *testing.T) {
+	logger, _ := NewLogger("info")
+	cacheDir, cacheDirErr := ioutil.TempDir("", "sparta-cache")
+	if nil != cacheDirErr {
+		t.Fatal(cacheDirErr)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	now := time.Now()
+	for i := 0; i != 4; i++ {
+		entryDir := filepath.Join(cacheDir, fmt.Sprintf("entry%d", i))
+		mkdirErr := os.MkdirAll(entryDir, os.ModePerm)
+		if nil != mkdirErr {
+			t.Fatal(mkdirErr)
+		}
+		modTime := now.Add(time.Duration(-i) * time.Hour)
+		os.Chtimes(entryDir, modTime, modTime)
+	}
+	pruneBuildCache(cacheDir, 2, logger)
+	for i := 0; i != 4; i++ {
+		_, statErr := os.Stat(filepath.Join(cacheDir, fmt.Sprintf("entry%d", i)))
+		if i < 2 && nil != statErr {
+			t.Errorf("Expected entry%d to be retained", i)
+		} else if i >= 2 && nil == statErr {
+			t.Errorf("Expected entry%d to be pruned", i)
+		}
+	}
+}
+
+func TestContentAddressedS3KeyName(t *testing.T) {
+	logger, _ := NewLogger("info")
+	tempDir, tempDirErr := ioutil.TempDir("", "sparta-content")
+	if nil != tempDirErr {
+		t.Fatal(tempDirErr)
+	}
+	defer os.RemoveAll(tempDir)
+
+	keyNameForContent := func(fileName string, contents string) string {
+		localPath := filepath.Join(tempDir, fileName)
+		writeErr := ioutil.WriteFile(localPath, []byte(contents), os.ModePerm)
+		if nil != writeErr {
+			t.Fatal(writeErr)
+		}
+		contentHash, contentHashErr := fileContentHash(localPath)
+		if nil != contentHashErr {
+			t.Fatal(contentHashErr)
+		}
+		keyName, keyNameErr := versionAwareS3KeyName("MyService/MyService-code.zip",
+			false,
+			contentHash,
+			logger)
+		if nil != keyNameErr {
+			t.Fatal(keyNameErr)
+		}
+		return keyName
+	}
+	keyName := keyNameForContent("first.zip", "archive")
+	if !strings.HasPrefix(keyName, "MyService/MyService-code-") ||
+		!strings.HasSuffix(keyName, ".zip") {
+		t.Errorf("Unexpected content addressed keyname: %s", keyName)
+	}
+	if keyName != keyNameForContent("second.zip", "archive") {
+		t.Errorf("Expected identical content to produce identical keynames")
+	}
+	if keyName == keyNameForContent("third.zip", "modified archive") {
+		t.Errorf("Expected modified content to produce a new keyname")
+	}
+}
+
+func TestBuildCacheBuildID(t *testing.T) {
+	logger, _ := NewLogger("info")
+	ctx := &workflowContext{logger: logger}
+	ctx.userdata.serviceName = "TestBuildCache"
+	ctx.userdata.buildID = "buildID1"
+
+	// A generated build ID disables the cache
+	cache, cacheErr := newBuildCache(ctx)
+	if nil != cacheErr || nil != cache {
+		t.Fatalf("Expected the build cache to be disabled without build inputs hash")
+	}
+	ctx.context.buildInputsHash = "inputsHash"
+	cache, cacheErr = newBuildCache(ctx)
+	if nil != cacheErr {
+		t.Fatal(cacheErr)
+	}
+	ctx.userdata.buildID = "buildID2"
+	otherCache, otherCacheErr := newBuildCache(ctx)
+	if nil != otherCacheErr {
+		t.Fatal(otherCacheErr)
+	}
+	if cache.archivePath == otherCache.archivePath {
+		t.Fatalf("Expected the build ID to be part of the cache key")
+	}
+
+	// A cache hit uses the supplied build ID
+	mkdirErr := os.MkdirAll(filepath.Dir(cache.archivePath), os.ModePerm)
+	if nil != mkdirErr {
+		t.Fatal(mkdirErr)
+	}
+	defer os.RemoveAll(filepath.Dir(cache.archivePath))
+	writeErr := ioutil.WriteFile(cache.archivePath, []byte("archive"), os.ModePerm)
+	if nil != writeErr {
+		t.Fatal(writeErr)
+	}
+	ctx.userdata.buildID = "buildID3"
+	ctx.context.buildCache = cache
+	packagePath, packageErr := createCachedPackage(ctx)
+	if nil != packageErr {
+		t.Fatal(packageErr)
+	}
+	if cache.archivePath != packagePath || "buildID3" != ctx.userdata.buildID {
+		t.Errorf("Unexpected cached package %s for build ID %s", packagePath, ctx.userdata.buildID)
+	}
+}
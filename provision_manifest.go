@@ -0,0 +1,141 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// buildManifest records the S3 artifacts of a successfully
+// provisioned build
+type buildManifest struct {
+	BuildID            string    `json:"buildID"`
+	Created            time.Time `json:"created"`
+	SpartaVersion      string    `json:"spartaVersion"`
+	BuildTags          string    `json:"buildTags,omitempty"`
+	TemplateURL        string    `json:"templateURL"`
+	CodeURL            string    `json:"codeURL"`
+	SiteURL            string    `json:"siteURL,omitempty"`
+	NestedTemplateURLs []string  `json:"nestedTemplateURLs,omitempty"`
+	LayerURLs          []string  `json:"layerURLs,omitempty"`
+}
+
+// artifactURLs returns the URLs of the S3 artifacts the build depends on
+func (manifest *buildManifest) artifactURLs() []string {
+	artifactURLs := []string{manifest.TemplateURL, manifest.CodeURL}
+	if "" != manifest.SiteURL {
+		artifactURLs = append(artifactURLs, manifest.SiteURL)
+	}
+	artifactURLs = append(artifactURLs, manifest.NestedTemplateURLs...)
+	return append(artifactURLs, manifest.LayerURLs...)
+}
+
+// buildManifestKeyPrefix is the S3 key prefix of the service's build manifests
+func buildManifestKeyPrefix(serviceName string) string {
+	return fmt.Sprintf("%s/builds/", serviceName)
+}
+
+// buildManifestKey is the S3 key of the manifest for the given build
+func buildManifestKey(serviceName string, buildID string) string {
+	return fmt.Sprintf("%s%s.json", buildManifestKeyPrefix(serviceName), buildID)
+}
+
+// uploadBuildManifest records the artifacts of the build that was just
+// provisioned using the template at templateURL
+func uploadBuildManifest(ctx *workflowContext, templateURL string) error {
+	manifest := &buildManifest{
+		BuildID:            ctx.userdata.buildID,
+		Created:            time.Now().UTC(),
+		SpartaVersion:      SpartaVersion,
+		BuildTags:          ctx.userdata.buildTags,
+		TemplateURL:        templateURL,
+		CodeURL:            ctx.context.s3CodeZipURL.location,
+		NestedTemplateURLs: ctx.context.nestedTemplateURLs,
+		LayerURLs:          lambdaLayerURLs(ctx),
+	}
+	if nil != ctx.userdata.s3SiteContext.s3UploadURL {
+		manifest.SiteURL = ctx.userdata.s3SiteContext.s3UploadURL.location
+	}
+	manifestJSON, manifestJSONErr := json.Marshal(manifest)
+	if nil != manifestJSONErr {
+		return errors.Wrapf(manifestJSONErr, "Failed to marshal build manifest")
+	}
+	manifestKey := buildManifestKey(ctx.userdata.serviceName, ctx.userdata.buildID)
+	s3Svc := s3.New(ctx.context.awsSession)
+	_, putErr := s3Svc.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(ctx.userdata.s3Bucket),
+		Key:         aws.String(manifestKey),
+		ContentType: aws.String("application/json"),
+		Body:        bytes.NewReader(manifestJSON),
+	})
+	if nil != putErr {
+		return errors.Wrapf(putErr, "Failed to upload build manifest")
+	}
+	ctx.logger.WithFields(logrus.Fields{
+		"Bucket": ctx.userdata.s3Bucket,
+		"Key":    manifestKey,
+	}).Debug("Uploaded build manifest")
+	return nil
+}
+
+// buildManifests returns the service's build manifests, ordered
+// from most to least recent
+func buildManifests(serviceName string,
+	s3Bucket string,
+	awsSession *session.Session,
+	logger *logrus.Logger) ([]*buildManifest, error) {
+
+	s3Svc := s3.New(awsSession)
+	manifestKeys := make([]string, 0)
+	listErr := s3Svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s3Bucket),
+		Prefix: aws.String(buildManifestKeyPrefix(serviceName)),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, eachObject := range page.Contents {
+			eachKey := aws.StringValue(eachObject.Key)
+			if strings.HasSuffix(eachKey, ".json") {
+				manifestKeys = append(manifestKeys, eachKey)
+			}
+		}
+		return true
+	})
+	if nil != listErr {
+		return nil, errors.Wrapf(listErr, "Failed to list build manifests")
+	}
+	manifests := make([]*buildManifest, 0)
+	for _, eachKey := range manifestKeys {
+		getResult, getErr := s3Svc.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String(s3Bucket),
+			Key:    aws.String(eachKey),
+		})
+		if nil != getErr {
+			return nil, errors.Wrapf(getErr, "Failed to get build manifest %s", eachKey)
+		}
+		manifest := &buildManifest{}
+		decodeErr := json.NewDecoder(getResult.Body).Decode(manifest)
+		getResult.Body.Close()
+		if nil != decodeErr {
+			logger.WithFields(logrus.Fields{
+				"Key":   eachKey,
+				"Error": decodeErr,
+			}).Warn("Ignoring invalid build manifest")
+			continue
+		}
+		manifests = append(manifests, manifest)
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].Created.After(manifests[j].Created)
+	})
+	return manifests, nil
+}
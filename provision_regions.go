@@ -0,0 +1,292 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// regionBucketPlaceholder is replaced by the region name in the
+// `provision --s3Bucket` value when several `--regions` are provisioned.
+// Lambda requires the code bucket to be in the same region as the
+// function, so each region needs its own bucket.
+const regionBucketPlaceholder = "{region}"
+
+// reRegionName is the set of valid AWS region names
+var reRegionName = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+
+// errRegionStopped is returned by a regional workflow that was stopped
+// because another region failed
+var errRegionStopped = errors.New("Provisioning stopped because another region failed")
+
+// regionalProvision is the state shared by the per-region workflows of
+// a multi-region provision
+type regionalProvision struct {
+	// The code and optional S3 site archives are built once and the same
+	// archives are uploaded to each regional bucket
+	packagePath     string
+	siteArchivePath string
+	// The regional workflows share the service definition, so the
+	// templates are generated one at a time
+	templateMutex sync.Mutex
+	// Pending changes are approved one region at a time
+	approvalMutex sync.Mutex
+	// Closed when the first region fails
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// stop signals the workflows that haven't started their stack operation
+// to stop
+func (regional *regionalProvision) stop() {
+	regional.stopOnce.Do(func() {
+		close(regional.stopped)
+	})
+}
+
+// stoppedError returns errRegionStopped iff a region has failed
+func (regional *regionalProvision) stoppedError() error {
+	select {
+	case <-regional.stopped:
+		return errRegionStopped
+	default:
+		return nil
+	}
+}
+
+// changeApprover serializes the approver and includes the region in the
+// stack name, since every region uses the same stack name
+func (regional *regionalProvision) changeApprover(region string,
+	approver spartaCF.StackChangeApprover) spartaCF.StackChangeApprover {
+	return func(stackName string, changes []*cloudformation.Change) (bool, error) {
+		regional.approvalMutex.Lock()
+		defer regional.approvalMutex.Unlock()
+		return approver(fmt.Sprintf("%s (%s)", stackName, region), changes)
+	}
+}
+
+// regionalResult is the outcome of provisioning a single region
+type regionalResult struct {
+	region   string
+	s3Bucket string
+	duration time.Duration
+	err      error
+}
+
+func (result *regionalResult) status() string {
+	switch {
+	case nil == result.err:
+		return "Provisioned"
+	case errRegionStopped == errors.Cause(result.err):
+		return "Stopped"
+	default:
+		return "Failed"
+	}
+}
+
+// parseRegions returns the validated set of `--regions` values
+func parseRegions(regionValues []string) ([]string, error) {
+	regions := make([]string, 0)
+	for _, eachValue := range regionValues {
+		region := strings.TrimSpace(eachValue)
+		if "" == region {
+			continue
+		}
+		if !reRegionName.MatchString(region) {
+			return nil, errors.Errorf("Invalid region name: %s", region)
+		}
+		for _, eachRegion := range regions {
+			if eachRegion == region {
+				return nil, errors.Errorf("Region (%s) supplied more than once", region)
+			}
+		}
+		regions = append(regions, region)
+	}
+	return regions, nil
+}
+
+// regionalBucketNames returns the S3 bucket to use for each region. A
+// single region may use a fixed bucket name, but several regions
+// require a bucket name that includes regionBucketPlaceholder.
+func regionalBucketNames(s3Bucket string, regions []string) ([]string, error) {
+	hasPlaceholder := strings.Contains(s3Bucket, regionBucketPlaceholder)
+	if len(regions) == 0 && hasPlaceholder {
+		return nil, errors.Errorf("S3 bucket (%s) includes the %s placeholder, but no regions were supplied",
+			s3Bucket,
+			regionBucketPlaceholder)
+	}
+	if len(regions) > 1 && !hasPlaceholder {
+		return nil, errors.Errorf("S3 bucket (%s) must include the %s placeholder to provision multiple regions",
+			s3Bucket,
+			regionBucketPlaceholder)
+	}
+	bucketNames := make([]string, len(regions))
+	for eachIndex, eachRegion := range regions {
+		bucketNames[eachIndex] = strings.Replace(s3Bucket,
+			regionBucketPlaceholder,
+			eachRegion,
+			-1)
+	}
+	return bucketNames, nil
+}
+
+// createRegionalArchives builds the code, optional S3 site and layer
+// archives that are shared by the regional workflows
+func createRegionalArchives(ctx *workflowContext, regional *regionalProvision) error {
+	buildCache, buildCacheErr := newBuildCache(ctx)
+	if nil != buildCacheErr {
+		return buildCacheErr
+	}
+	ctx.context.buildCache = buildCache
+
+	packagePath, packageErr := createCachedPackage(ctx)
+	if nil != packageErr {
+		return packageErr
+	}
+	regional.packagePath = packagePath
+	if nil != ctx.userdata.s3SiteContext.s3Site {
+		siteArchivePath, siteErr := createS3SiteArchive(ctx)
+		if nil != siteErr {
+			return siteErr
+		}
+		regional.siteArchivePath = siteArchivePath
+	}
+	layers, layersErr := serviceLambdaLayers(ctx.userdata.lambdaAWSInfos)
+	if nil != layersErr {
+		return layersErr
+	}
+	for _, eachLayer := range layers {
+		layerErr := createLambdaLayerArchive(eachLayer, ctx)
+		if nil != layerErr {
+			return layerErr
+		}
+	}
+	return nil
+}
+
+// logRegionalResults outputs the per-region summary
+func logRegionalResults(serviceName string,
+	results []*regionalResult,
+	logger *logrus.Logger) {
+	logger.Info(headerDivider)
+	logger.Info(fmt.Sprintf("%s Regional Summary", serviceName))
+	logger.Info(headerDivider)
+	for _, eachResult := range results {
+		entry := logger.WithFields(logrus.Fields{
+			"Region":       eachResult.region,
+			"Bucket":       eachResult.s3Bucket,
+			"Duration (s)": fmt.Sprintf("%.f", eachResult.duration.Seconds()),
+		})
+		switch eachResult.status() {
+		case "Provisioned":
+			entry.Info(eachResult.status())
+		case "Stopped":
+			entry.Warn(eachResult.status())
+		default:
+			entry.WithField("Error", eachResult.err).Error(eachResult.status())
+		}
+	}
+}
+
+// provisionServiceRegions provisions the same build into each region. The
+// contexts differ only by their AWS session region and S3 bucket. The
+// archives are built once, then the regional stacks are converged
+// concurrently. If a region fails, the regions that haven't started
+// their stack operation are stopped. Stack operations that are already
+// in progress run to completion.
+func provisionServiceRegions(regionContexts []*workflowContext) error {
+	if len(regionContexts) == 1 {
+		return provisionService(regionContexts[0])
+	}
+	primaryCtx := regionContexts[0]
+	logger := primaryCtx.logger
+
+	regions := make([]string, len(regionContexts))
+	for eachIndex, eachCtx := range regionContexts {
+		regions[eachIndex] = aws.StringValue(eachCtx.context.awsSession.Config.Region)
+	}
+	logger.WithFields(logrus.Fields{
+		"BuildID": primaryCtx.userdata.buildID,
+		"NOOP":    primaryCtx.userdata.noop,
+		"Regions": regions,
+	}).Info("Provisioning service regions")
+
+	regional := &regionalProvision{
+		stopped: make(chan struct{}),
+	}
+	archivesErr := createRegionalArchives(primaryCtx, regional)
+	// Cached archives are kept for subsequent runs
+	defer func() {
+		removePaths := []string{regional.siteArchivePath}
+		if nil == primaryCtx.context.buildCache {
+			removePaths = append(removePaths, regional.packagePath)
+		}
+		layers, _ := serviceLambdaLayers(primaryCtx.userdata.lambdaAWSInfos)
+		for _, eachLayer := range layers {
+			removePaths = append(removePaths, eachLayer.archivePath)
+		}
+		for _, eachPath := range removePaths {
+			if "" == eachPath {
+				continue
+			}
+			removeErr := os.Remove(eachPath)
+			if nil != removeErr {
+				logger.WithFields(logrus.Fields{
+					"Path":  eachPath,
+					"Error": removeErr,
+				}).Warn("Failed to cleanup intermediate artifact")
+			}
+		}
+	}()
+	if nil != archivesErr {
+		return errors.Wrapf(archivesErr, "Failed to build service")
+	}
+
+	results := make([]*regionalResult, len(regionContexts))
+	tasks := make([]*workTask, len(regionContexts))
+	for eachIndex, eachCtx := range regionContexts {
+		ctx := eachCtx
+		result := &regionalResult{
+			region:   regions[eachIndex],
+			s3Bucket: ctx.userdata.s3Bucket,
+		}
+		results[eachIndex] = result
+
+		ctx.context.regional = regional
+		if nil != ctx.userdata.changeApprover {
+			ctx.userdata.changeApprover = regional.changeApprover(result.region,
+				ctx.userdata.changeApprover)
+		}
+		tasks[eachIndex] = newWorkTask(func() workResult {
+			startTime := time.Now()
+			result.err = provisionService(ctx)
+			result.duration = time.Since(startTime)
+			if nil != result.err {
+				regional.stop()
+			}
+			return newTaskResult(result, result.err)
+		})
+	}
+	p := newWorkerPool(tasks, len(tasks))
+	_, regionErrors := p.Run()
+	logRegionalResults(primaryCtx.userdata.serviceName, results, logger)
+
+	if len(regionErrors) != 0 {
+		return errors.Errorf("Failed to provision %d of %d regions: %v",
+			len(regionErrors),
+			len(regionContexts),
+			regionErrors)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+)
+
+func TestParseRegions(t *testing.T) {
+	regions, regionsErr := parseRegions([]string{"us-east-1", " eu-west-1", "us-gov-west-1", ""})
+	if nil != regionsErr {
+		t.Fatal(regionsErr)
+	}
+	if len(regions) != 3 || "eu-west-1" != regions[1] {
+		t.Errorf("Unexpected regions: %#v", regions)
+	}
+	for _, eachInvalid := range [][]string{
+		{"us-east-1", "us-east-1"},
+		{"US-EAST-1"},
+		{"useast1"},
+	} {
+		_, invalidErr := parseRegions(eachInvalid)
+		if nil == invalidErr {
+			t.Errorf("Expected error for regions: %#v", eachInvalid)
+		}
+	}
+}
+
+func TestRegionalBucketNames(t *testing.T) {
+	bucketNames, bucketNamesErr := regionalBucketNames("artifacts-{region}",
+		[]string{"us-east-1", "eu-west-1"})
+	if nil != bucketNamesErr {
+		t.Fatal(bucketNamesErr)
+	}
+	if "artifacts-us-east-1" != bucketNames[0] || "artifacts-eu-west-1" != bucketNames[1] {
+		t.Errorf("Unexpected bucket names: %#v", bucketNames)
+	}
+	bucketNames, bucketNamesErr = regionalBucketNames("artifacts", []string{"us-east-1"})
+	if nil != bucketNamesErr || "artifacts" != bucketNames[0] {
+		t.Errorf("Expected a single region to use a fixed bucket: %#v (%v)", bucketNames, bucketNamesErr)
+	}
+	_, bucketNamesErr = regionalBucketNames("artifacts", []string{"us-east-1", "eu-west-1"})
+	if nil == bucketNamesErr {
+		t.Error("Expected error for multiple regions without a bucket placeholder")
+	}
+	_, bucketNamesErr = regionalBucketNames("artifacts-{region}", nil)
+	if nil == bucketNamesErr {
+		t.Error("Expected error for a bucket placeholder without regions")
+	}
+}
+
+func TestRegionalProvisionStop(t *testing.T) {
+	regional := &regionalProvision{
+		stopped: make(chan struct{}),
+	}
+	if nil != regional.stoppedError() {
+		t.Fatal("Expected regional provision to be running")
+	}
+	regional.stop()
+	regional.stop()
+	stoppedErr := errors.Wrapf(regional.stoppedError(), "Failed to execute verifyAndBuildStep")
+	result := &regionalResult{region: "us-east-1", err: stoppedErr}
+	if "Stopped" != result.status() {
+		t.Errorf("Unexpected stopped region status: %s", result.status())
+	}
+	result.err = errors.New("Stack failed")
+	if "Failed" != result.status() {
+		t.Errorf("Unexpected failed region status: %s", result.status())
+	}
+
+	approvedStackName := ""
+	approver := regional.changeApprover("eu-west-1",
+		func(stackName string, changes []*cloudformation.Change) (bool, error) {
+			approvedStackName = stackName
+			return true, nil
+		})
+	approved, approvedErr := approver("MyService", nil)
+	if !approved || nil != approvedErr || "MyService (eu-west-1)" != approvedStackName {
+		t.Errorf("Unexpected regional approval: %s", approvedStackName)
+	}
+}
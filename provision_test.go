@@ -1,10 +1,16 @@
+// +build !lambdabinary
+
 package sparta
 
 import (
 	"bytes"
+	"encoding/json"
+	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
 	gocf "github.com/mweagle/go-cloudformation"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -111,3 +117,69 @@ func TestDecorateProvision(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 }
+
+func TestReadStackPolicy(t *testing.T) {
+	policyFile, policyFileErr := ioutil.TempFile("", "stackPolicy")
+	if nil != policyFileErr {
+		t.Fatal(policyFileErr)
+	}
+	defer os.Remove(policyFile.Name())
+	policyJSON, _ := json.Marshal(spartaCF.ProtectedResourcesStackPolicy())
+	policyFile.Write(policyJSON)
+	policyFile.Close()
+
+	stackPolicy, stackPolicyErr := readStackPolicy(policyFile.Name())
+	if nil != stackPolicyErr {
+		t.Fatal(stackPolicyErr)
+	}
+	if len(stackPolicy.Statement) != 2 ||
+		"Deny" != stackPolicy.Statement[1].Effect {
+		t.Errorf("Unexpected stack policy: %#v", stackPolicy)
+	}
+	_, missingErr := readStackPolicy(policyFile.Name() + ".missing")
+	if nil == missingErr {
+		t.Errorf("Expected missing stack policy to fail")
+	}
+}
+
+func TestWorkflowStepName(t *testing.T) {
+	for expectedName, eachStep := range map[string]workflowStep{
+		"verifyAndBuildStep":        verifyAndBuildStep(),
+		"createUploadStep":          createUploadStep("", ""),
+		"ensureCloudFormationStack": ensureCloudFormationStack(),
+	} {
+		if stepName := workflowStepName(eachStep); expectedName != stepName {
+			t.Errorf("Expected workflow step name %s, got %s", expectedName, stepName)
+		}
+	}
+}
+
+func TestInPlaceAliasProvision(t *testing.T) {
+	lambdas := testLambdaData()
+	lambdas[0].Options = &LambdaFunctionOptions{
+		Alias: &LambdaAliasOptions{
+			Name: "live",
+		},
+	}
+	logger, _ := NewLogger("info")
+	var templateWriter bytes.Buffer
+	err := Provision(true,
+		"SampleProvision",
+		"",
+		lambdas,
+		nil,
+		nil,
+		os.Getenv("S3_BUCKET"),
+		false,
+		true,
+		"testBuildID",
+		"",
+		"",
+		"",
+		&templateWriter,
+		nil,
+		logger)
+	if nil == err || !strings.Contains(err.Error(), "--inplace") {
+		t.Fatalf("Expected in-place alias update to be rejected: %v", err)
+	}
+}
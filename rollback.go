@@ -0,0 +1,216 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// uploadedResourceProperties preserves a resource from an uploaded template.
+// The rollback template is only inspected for its resource types, since
+// CloudFormation reads the uploaded template from S3.
+type uploadedResourceProperties struct {
+	resourceType string
+	properties   json.RawMessage
+}
+
+func (resource *uploadedResourceProperties) CfnResourceType() string {
+	return resource.resourceType
+}
+
+func (resource *uploadedResourceProperties) MarshalJSON() ([]byte, error) {
+	if len(resource.properties) == 0 {
+		return []byte("{}"), nil
+	}
+	return resource.properties, nil
+}
+
+// uploadedTemplate returns the template for a previously uploaded template
+// body. Resource types that go-cloudformation doesn't know about, such
+// as user defined CustomResources, are supported. The template parameters
+// are preserved so that the stack keeps its current parameter values.
+func uploadedTemplate(templateBody io.Reader) (*gocf.Template, error) {
+	var rawTemplate struct {
+		Parameters map[string]*gocf.Parameter
+		Resources  map[string]struct {
+			Type       string
+			Properties json.RawMessage
+		}
+	}
+	decodeErr := json.NewDecoder(templateBody).Decode(&rawTemplate)
+	if nil != decodeErr {
+		return nil, errors.Wrapf(decodeErr, "Failed to parse uploaded template")
+	}
+	template := gocf.NewTemplate()
+	for eachName, eachParameter := range rawTemplate.Parameters {
+		template.Parameters[eachName] = eachParameter
+	}
+	for eachName, eachResource := range rawTemplate.Resources {
+		template.AddResource(eachName, &uploadedResourceProperties{
+			resourceType: eachResource.Type,
+			properties:   eachResource.Properties,
+		})
+	}
+	return template, nil
+}
+
+// uploadedObjectInput returns the S3 GetObject input for the artifact URL
+func uploadedObjectInput(s3Bucket string, artifactURL string) (*s3.GetObjectInput, error) {
+	uploadURL := newS3UploadURL(artifactURL)
+	if nil == uploadURL {
+		return nil, errors.Errorf("Invalid S3 artifact URL: %s", artifactURL)
+	}
+	getInput := &s3.GetObjectInput{
+		Bucket: aws.String(s3Bucket),
+		Key:    aws.String(uploadURL.keyName()),
+	}
+	if "" != uploadURL.version {
+		getInput.VersionId = aws.String(uploadURL.version)
+	}
+	return getInput, nil
+}
+
+// logBuildManifests outputs the builds that can be rolled back to
+func logBuildManifests(manifests []*buildManifest,
+	liveBuildID string,
+	logger *logrus.Logger) {
+	logger.Info(headerDivider)
+	if len(manifests) == 0 {
+		logger.Info("No builds found. Builds are recorded by a successful provision")
+	}
+	for _, eachManifest := range manifests {
+		logger.WithFields(logrus.Fields{
+			"Created":       eachManifest.Created.Local().Format(time.RFC3339),
+			"SpartaVersion": eachManifest.SpartaVersion,
+			"BuildTags":     eachManifest.BuildTags,
+			"Live":          eachManifest.BuildID == liveBuildID,
+		}).Info(eachManifest.BuildID)
+	}
+	logger.Info(headerDivider)
+}
+
+// Rollback redeploys a previously provisioned build. The template and code
+// archive for the build are read from S3, so nothing is compiled. If buildID
+// is empty, the builds that can be rolled back to are listed instead.
+func Rollback(serviceName string,
+	s3Bucket string,
+	buildID string,
+	autoApprove bool,
+	noop bool,
+	logger *logrus.Logger) error {
+
+	startTime := time.Now()
+	awsSession := spartaAWS.NewSession(logger)
+	manifests, manifestsErr := buildManifests(serviceName, s3Bucket, awsSession, logger)
+	if nil != manifestsErr {
+		return manifestsErr
+	}
+	liveBuildID, _, liveErr := liveStackReferences(serviceName, awsSession, logger)
+	if nil != liveErr {
+		return errors.Wrapf(liveErr, "Failed to determine deployed build")
+	}
+	if "" == buildID {
+		logBuildManifests(manifests, liveBuildID, logger)
+		return nil
+	}
+	var manifest *buildManifest
+	for _, eachManifest := range manifests {
+		if eachManifest.BuildID == buildID {
+			manifest = eachManifest
+			break
+		}
+	}
+	if nil == manifest {
+		return errors.Errorf("Build %s not found. Run rollback without --buildID to list the available builds",
+			buildID)
+	}
+	if manifest.BuildID == liveBuildID {
+		logger.WithFields(logrus.Fields{
+			"BuildID": buildID,
+		}).Info("Build is already deployed")
+		return nil
+	}
+	logger.WithFields(logrus.Fields{
+		"BuildID":     manifest.BuildID,
+		"Created":     manifest.Created.Local().Format(time.RFC3339),
+		"LiveBuildID": liveBuildID,
+		"TemplateURL": manifest.TemplateURL,
+		"CodeURL":     manifest.CodeURL,
+	}).Info("Rolling back")
+
+	// Make sure every artifact is still available before the stack
+	// is updated
+	s3Svc := s3.New(awsSession)
+	for _, eachURL := range manifest.artifactURLs()[1:] {
+		headInput, headInputErr := uploadedObjectInput(s3Bucket, eachURL)
+		if nil != headInputErr {
+			return headInputErr
+		}
+		_, headErr := s3Svc.HeadObject(&s3.HeadObjectInput{
+			Bucket:    headInput.Bucket,
+			Key:       headInput.Key,
+			VersionId: headInput.VersionId,
+		})
+		if nil != headErr {
+			return errors.Wrapf(headErr, "Failed to find %s. It may have been deleted by gc", eachURL)
+		}
+	}
+	templateInput, templateInputErr := uploadedObjectInput(s3Bucket, manifest.TemplateURL)
+	if nil != templateInputErr {
+		return templateInputErr
+	}
+	templateObject, templateObjectErr := s3Svc.GetObject(templateInput)
+	if nil != templateObjectErr {
+		return errors.Wrapf(templateObjectErr,
+			"Failed to get %s. It may have been deleted by gc",
+			manifest.TemplateURL)
+	}
+	defer templateObject.Body.Close()
+	cfTemplate, cfTemplateErr := uploadedTemplate(templateObject.Body)
+	if nil != cfTemplateErr {
+		return cfTemplateErr
+	}
+	if noop {
+		logger.WithFields(logrus.Fields{
+			"BuildID": buildID,
+		}).Info(noopMessage("Stack rollback"))
+		return nil
+	}
+	stackTags := map[string]string{
+		SpartaTagBuildIDKey: manifest.BuildID,
+		SpartaTagVersionKey: manifest.SpartaVersion,
+	}
+	if "" != manifest.BuildTags {
+		stackTags[SpartaTagBuildTagsKey] = manifest.BuildTags
+	}
+	stack, stackErr := spartaCF.ConvergeStackStateWithApproval(serviceName,
+		cfTemplate,
+		manifest.TemplateURL,
+		nil,
+		stackTags,
+		startTime,
+		awsSession,
+		subheaderDivider,
+		stackChangeApprover(autoApprove, os.Stdin, logger),
+		logger)
+	if nil != stackErr {
+		return stackErr
+	}
+	logger.WithFields(logrus.Fields{
+		"StackName": aws.StringValue(stack.StackName),
+		"BuildID":   manifest.BuildID,
+		"Duration":  time.Since(startTime).String(),
+	}).Info("Stack rolled back")
+	return nil
+}
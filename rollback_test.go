@@ -0,0 +1,51 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRollbackUploadedTemplate(t *testing.T) {
+	logger, _ := NewLogger("info")
+	templateBody := `{
+	"Resources": {
+		"IAMRole": {
+			"Type": "AWS::IAM::Role",
+			"Properties": {"Path": "/"}
+		},
+		"UserResource": {
+			"Type": "Custom::UserDefinedResource",
+			"Properties": {"ServiceToken": "arn:aws:lambda:us-west-2:000000000000:function:Handler"}
+		}
+	}
+}`
+	template, templateErr := uploadedTemplate(strings.NewReader(templateBody))
+	if nil != templateErr {
+		t.Fatal(templateErr)
+	}
+	if len(template.Resources) != 2 {
+		t.Fatalf("Expected 2 resources, found %d", len(template.Resources))
+	}
+	if "Custom::UserDefinedResource" != template.Resources["UserResource"].Properties.CfnResourceType() {
+		t.Errorf("Unexpected resource type: %s",
+			template.Resources["UserResource"].Properties.CfnResourceType())
+	}
+	templateJSON, templateJSONErr := json.Marshal(template)
+	if nil != templateJSONErr {
+		t.Fatal(templateJSONErr)
+	}
+	if !strings.Contains(string(templateJSON), `"ServiceToken":"arn:aws:lambda:us-west-2:000000000000:function:Handler"`) {
+		t.Errorf("Expected resource properties to be preserved: %s", string(templateJSON))
+	}
+	logBuildManifests([]*buildManifest{
+		{
+			BuildID:       "build1",
+			Created:       time.Now(),
+			SpartaVersion: SpartaVersion,
+		},
+	}, "build1", logger)
+}
@@ -17,6 +17,7 @@ import (
 
 	_ "github.com/aws/aws-lambda-go/lambda"        // Force dep to resolve
 	_ "github.com/aws/aws-lambda-go/lambdacontext" // Force dep to resolve
+	spartaAWS "github.com/mweagle/Sparta/aws"
 	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
 	spartaIAM "github.com/mweagle/Sparta/aws/iam"
 	gocc "github.com/mweagle/go-cloudcondenser"
@@ -54,6 +55,9 @@ const (
 	// envVarDiscoveryInformation is the name of the discovery information
 	// published into the environment
 	envVarDiscoveryInformation = "SPARTA_DISCOVERY_INFO"
+	// envVarStage is the deployment stage published into the
+	// execution environment
+	envVarStage = "SPARTA_STAGE"
 )
 
 var (
@@ -121,6 +125,14 @@ type optionsGlobalStruct struct {
 	Command            string         `validate:"-"`
 	BuildTags          string         `validate:"-"`
 	LinkerFlags        string         `validate:"-"` // no requirements
+	ConfigFile         string         `validate:"-"`
+	ConfigProfile      string         `validate:"-"`
+	Stage              string         `validate:"omitempty,alphanum"`
+	AWSProfile         string         `validate:"-"`
+	AWSRegion          string         `validate:"-"`
+	AWSRoleARN         string         `validate:"-"`
+	AWSExternalID      string         `validate:"-"`
+	AWSMFASerialNumber string         `validate:"-"`
 }
 
 // OptionsGlobal stores the global command line options
@@ -150,6 +162,7 @@ var CommonIAMStatements = struct {
 	VPC      []spartaIAM.PolicyStatement
 	DynamoDB []spartaIAM.PolicyStatement
 	Kinesis  []spartaIAM.PolicyStatement
+	SQS      []spartaIAM.PolicyStatement
 }{
 	Core: []spartaIAM.PolicyStatement{
 		{
@@ -212,6 +225,15 @@ var CommonIAMStatements = struct {
 			},
 		},
 	},
+	SQS: []spartaIAM.PolicyStatement{
+		{
+			Effect: "Allow",
+			Action: []string{"sqs:ReceiveMessage",
+				"sqs:DeleteMessage",
+				"sqs:GetQueueAttributes",
+			},
+		},
+	},
 }
 
 // RE for sanitizing names
@@ -313,10 +335,36 @@ type LambdaFunctionOptions struct {
 	Tags map[string]string
 	// Tracing options for XRay
 	TracingConfig *gocf.LambdaFunctionTracingConfig
+	// Optional layers to include in the function's execution environment.
+	// Values may be layer version ARNs, gocf.Stringable references or
+	// LambdaLayer values that Sparta packages with the service.
+	Layers []gocf.Stringable
+	// Optional alias that targets a version of the function that's
+	// published for each build
+	Alias *LambdaAliasOptions
+	// Optional provisioned concurrency for the Alias
+	ProvisionedConcurrency *ProvisionedConcurrencyOptions
+	// Optional stage specific overrides, keyed by the --stage value
+	StageOptions map[string]*LambdaFunctionStageOptions
 	// Additional params
 	SpartaOptions *SpartaOptions
 }
 
+// LambdaFunctionStageOptions are the LambdaFunctionOptions values that
+// can be overridden for a single deployment stage. Zero values
+// are ignored.
+type LambdaFunctionStageOptions struct {
+	// Memory limit
+	MemorySize int64
+	// Timeout (seconds)
+	Timeout int64
+	// Environment Variables. These are merged into, and take
+	// precedence over, the LambdaFunctionOptions values
+	Environment map[string]*gocf.StringExpr
+	// The maximum of concurrent executions you want reserved for the function
+	ReservedConcurrentExecutions int64
+}
+
 func defaultLambdaFunctionOptions() *LambdaFunctionOptions {
 	return &LambdaFunctionOptions{Description: "",
 		MemorySize:                   128,
@@ -379,6 +427,21 @@ type WorkflowHooks struct {
 	Rollback RollbackHook
 	// Rollbacks are called if there is an error performing the requested operation
 	Rollbacks []RollbackHookHandler
+
+	// StackPolicy is the optional stack policy applied to the service stack. It's
+	// set before any update is applied, so it can prevent the replacement or
+	// deletion of stateful resources. See spartaCF.ProtectedResourcesStackPolicy
+	StackPolicy *spartaCF.StackPolicyDocument
+	// TerminationProtection enables termination protection for the service stack
+	TerminationProtection bool
+	// TemplateParameters are the service level CloudFormation template parameters,
+	// keyed by the alphanumeric parameter name. Their values are supplied with
+	// `provision --param Name=Value` rather than fixed when the template is built,
+	// so the same uploaded template can be deployed to different accounts. Use
+	// gocf.Ref(Name).String() to reference a value, for instance as a
+	// LambdaFunctionOptions.Environment value. If a parameter's Type is empty,
+	// TemplateParameterTypeString is used.
+	TemplateParameters map[string]*gocf.Parameter
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -409,6 +472,8 @@ func (rolePrivilege *IAMRolePrivilege) resourceExpr() *gocf.StringExpr {
 		return gocf.String(typedPrivilege)
 	case gocf.RefFunc:
 		return typedPrivilege.String()
+	case gocf.ImportValueFunc:
+		return typedPrivilege.String()
 	default:
 		return typedPrivilege.(*gocf.StringExpr)
 	}
@@ -484,14 +549,136 @@ func (roleDefinition *IAMRoleDefinition) logicalName(serviceName string, targetL
 ////////////////////////////////////////////////////////////////////////////////
 // START - EventSourceMapping
 
+const (
+	// EventSourceTypeDynamoDB is the EventSourceMapping.EventSourceType
+	// for a DynamoDB stream
+	EventSourceTypeDynamoDB = "dynamodb"
+	// EventSourceTypeKinesis is the EventSourceMapping.EventSourceType
+	// for a Kinesis stream
+	EventSourceTypeKinesis = "kinesis"
+	// EventSourceTypeSQS is the EventSourceMapping.EventSourceType
+	// for an SQS queue
+	EventSourceTypeSQS = "sqs"
+)
+
 // EventSourceMapping specifies data necessary for pull-based configuration. The fields
 // directly correspond to the golang AWS SDK's CreateEventSourceMappingInput
 // (http://docs.aws.amazon.com/sdk-for-go/api/service/lambda.html#type-CreateEventSourceMappingInput)
+// SQS queue mappings must not define a StartingPosition.
 type EventSourceMapping struct {
 	StartingPosition string
 	EventSourceArn   interface{}
 	Disabled         bool
 	BatchSize        int64
+	// Optional maximum time, in seconds, to gather records before
+	// invoking the function. SQS batches larger than 10 require a
+	// batching window.
+	MaximumBatchingWindowInSeconds int64
+	// Optional maximum number of concurrent function instances that an
+	// SQS event source invokes. Values must be between 2 and 1000.
+	MaximumConcurrency int64
+	// ReportBatchItemFailures enables partial batch responses. The
+	// function returns the records that failed rather than an error, so
+	// that only those records are retried. See the
+	// spartaSQS.BatchHandler function for SQS queues.
+	ReportBatchItemFailures bool
+	// StartingPositionTimestamp is the time to start reading a stream
+	// from when the StartingPosition is AT_TIMESTAMP
+	StartingPositionTimestamp time.Time
+	// Optional number of batches to process concurrently from each stream
+	// shard. Values must be between 1 and 10.
+	ParallelizationFactor int64
+	// Optional maximum number of times to retry a stream batch that
+	// returns an error. Use -1 to retry until the record expires.
+	MaximumRetryAttempts *int64
+	// Optional maximum age, in seconds, of a stream record that is sent
+	// to the function. Use -1 for records of any age.
+	MaximumRecordAgeInSeconds int64
+	// BisectBatchOnFunctionError splits a stream batch that returns an
+	// error in two and retries each half
+	BisectBatchOnFunctionError bool
+	// Optional SQS queue or SNS topic ARN that receives the stream
+	// records that are discarded after the retries are exhausted
+	OnFailureDestinationArn interface{}
+	// Optional stream tumbling window duration, in seconds. Values must
+	// be between 0 and 900.
+	TumblingWindowInSeconds int64
+	// Optional filters that select which records are sent to the
+	// function. Records that match any of the patterns are sent. An
+	// EventSourceMapping supports up to 5 patterns.
+	FilterCriteria []*EventFilterPattern
+	// Optional type of the event source, one of the EventSourceType*
+	// values. Sparta infers the privileges the function's role needs
+	// from literal ARNs and from resources in the template. Set the
+	// type for other ARN expressions, such as an ImportServiceValue,
+	// so that the role includes the privileges for the source.
+	EventSourceType string
+}
+
+func (mapping *EventSourceMapping) validate() error {
+	if mapping.MaximumBatchingWindowInSeconds < 0 ||
+		mapping.MaximumBatchingWindowInSeconds > maxEventSourceMappingBatchingWindow {
+		return errors.Errorf("EventSourceMapping MaximumBatchingWindowInSeconds must be between 0 and %d: %d",
+			maxEventSourceMappingBatchingWindow,
+			mapping.MaximumBatchingWindowInSeconds)
+	}
+	if mapping.MaximumConcurrency != 0 &&
+		(mapping.MaximumConcurrency < minEventSourceMappingConcurrency ||
+			mapping.MaximumConcurrency > maxEventSourceMappingConcurrency) {
+		return errors.Errorf("EventSourceMapping MaximumConcurrency must be between %d and %d: %d",
+			minEventSourceMappingConcurrency,
+			maxEventSourceMappingConcurrency,
+			mapping.MaximumConcurrency)
+	}
+	if ("AT_TIMESTAMP" == mapping.StartingPosition) == mapping.StartingPositionTimestamp.IsZero() {
+		return errors.Errorf("EventSourceMapping StartingPositionTimestamp must be set if and only if the StartingPosition is AT_TIMESTAMP")
+	}
+	if mapping.ParallelizationFactor < 0 ||
+		mapping.ParallelizationFactor > maxEventSourceMappingParallelizationFactor {
+		return errors.Errorf("EventSourceMapping ParallelizationFactor must be between 1 and %d: %d",
+			maxEventSourceMappingParallelizationFactor,
+			mapping.ParallelizationFactor)
+	}
+	if nil != mapping.MaximumRetryAttempts &&
+		(*mapping.MaximumRetryAttempts < -1 ||
+			*mapping.MaximumRetryAttempts > maxEventSourceMappingRetryAttempts) {
+		return errors.Errorf("EventSourceMapping MaximumRetryAttempts must be -1 or between 0 and %d: %d",
+			maxEventSourceMappingRetryAttempts,
+			*mapping.MaximumRetryAttempts)
+	}
+	if mapping.MaximumRecordAgeInSeconds != 0 &&
+		mapping.MaximumRecordAgeInSeconds != -1 &&
+		(mapping.MaximumRecordAgeInSeconds < minEventSourceMappingRecordAge ||
+			mapping.MaximumRecordAgeInSeconds > maxEventSourceMappingRecordAge) {
+		return errors.Errorf("EventSourceMapping MaximumRecordAgeInSeconds must be -1 or between %d and %d: %d",
+			minEventSourceMappingRecordAge,
+			maxEventSourceMappingRecordAge,
+			mapping.MaximumRecordAgeInSeconds)
+	}
+	if mapping.TumblingWindowInSeconds < 0 ||
+		mapping.TumblingWindowInSeconds > maxEventSourceMappingTumblingWindow {
+		return errors.Errorf("EventSourceMapping TumblingWindowInSeconds must be between 0 and %d: %d",
+			maxEventSourceMappingTumblingWindow,
+			mapping.TumblingWindowInSeconds)
+	}
+	if len(mapping.FilterCriteria) > maxEventFilterPatterns {
+		return errors.Errorf("EventSourceMapping supports at most %d FilterCriteria patterns: %d",
+			maxEventFilterPatterns,
+			len(mapping.FilterCriteria))
+	}
+	switch mapping.EventSourceType {
+	case "",
+		EventSourceTypeDynamoDB,
+		EventSourceTypeKinesis,
+		EventSourceTypeSQS:
+	default:
+		return errors.Errorf("EventSourceMapping EventSourceType must be one of %s, %s or %s: %s",
+			EventSourceTypeDynamoDB,
+			EventSourceTypeKinesis,
+			EventSourceTypeSQS,
+			mapping.EventSourceType)
+	}
+	return nil
 }
 
 func (mapping *EventSourceMapping) export(serviceName string,
@@ -502,13 +689,92 @@ func (mapping *EventSourceMapping) export(serviceName string,
 	template *gocf.Template,
 	logger *logrus.Logger) error {
 
+	validateErr := mapping.validate()
+	if nil != validateErr {
+		return validateErr
+	}
 	dynamicArn := spartaCF.DynamicValueToStringExpr(mapping.EventSourceArn)
-	eventSourceMappingResource := gocf.LambdaEventSourceMapping{
-		EventSourceArn:   dynamicArn.String(),
-		FunctionName:     targetLambdaArn,
-		StartingPosition: gocf.String(mapping.StartingPosition),
-		BatchSize:        gocf.Integer(mapping.BatchSize),
-		Enabled:          gocf.Bool(!mapping.Disabled),
+	eventSourceMappingResource := &lambdaEventSourceMappingResource{
+		LambdaEventSourceMapping: gocf.LambdaEventSourceMapping{
+			EventSourceArn: dynamicArn.String(),
+			FunctionName:   targetLambdaArn,
+			BatchSize:      gocf.Integer(mapping.BatchSize),
+			Enabled:        gocf.Bool(!mapping.Disabled),
+		},
+	}
+	// The optional values are only included in the resource name hash when
+	// they're set, so that the names of existing mappings are unchanged
+	optionalHashParts := []string{}
+	addOptionalHashPart := func(name string, value interface{}) {
+		optionalHashParts = append(optionalHashParts, fmt.Sprintf("%s:%v", name, value))
+	}
+	if "" != mapping.StartingPosition {
+		eventSourceMappingResource.StartingPosition = gocf.String(mapping.StartingPosition)
+	}
+	if 0 != mapping.MaximumBatchingWindowInSeconds {
+		eventSourceMappingResource.MaximumBatchingWindowInSeconds = gocf.Integer(mapping.MaximumBatchingWindowInSeconds)
+		addOptionalHashPart("MaximumBatchingWindowInSeconds", mapping.MaximumBatchingWindowInSeconds)
+	}
+	if 0 != mapping.MaximumConcurrency {
+		eventSourceMappingResource.ScalingConfig = &lambdaEventSourceMappingScalingConfig{
+			MaximumConcurrency: gocf.Integer(mapping.MaximumConcurrency),
+		}
+		addOptionalHashPart("MaximumConcurrency", mapping.MaximumConcurrency)
+	}
+	if mapping.ReportBatchItemFailures {
+		eventSourceMappingResource.FunctionResponseTypes = gocf.StringList(gocf.String("ReportBatchItemFailures"))
+		optionalHashParts = append(optionalHashParts, "ReportBatchItemFailures")
+	}
+	if !mapping.StartingPositionTimestamp.IsZero() {
+		eventSourceMappingResource.StartingPositionTimestamp = gocf.Integer(mapping.StartingPositionTimestamp.Unix())
+		addOptionalHashPart("StartingPositionTimestamp", mapping.StartingPositionTimestamp.Unix())
+	}
+	if 0 != mapping.ParallelizationFactor {
+		eventSourceMappingResource.ParallelizationFactor = gocf.Integer(mapping.ParallelizationFactor)
+		addOptionalHashPart("ParallelizationFactor", mapping.ParallelizationFactor)
+	}
+	if nil != mapping.MaximumRetryAttempts {
+		eventSourceMappingResource.MaximumRetryAttempts = gocf.Integer(*mapping.MaximumRetryAttempts)
+		addOptionalHashPart("MaximumRetryAttempts", *mapping.MaximumRetryAttempts)
+	}
+	if 0 != mapping.MaximumRecordAgeInSeconds {
+		eventSourceMappingResource.MaximumRecordAgeInSeconds = gocf.Integer(mapping.MaximumRecordAgeInSeconds)
+		addOptionalHashPart("MaximumRecordAgeInSeconds", mapping.MaximumRecordAgeInSeconds)
+	}
+	if mapping.BisectBatchOnFunctionError {
+		eventSourceMappingResource.BisectBatchOnFunctionError = gocf.Bool(true)
+		addOptionalHashPart("BisectBatchOnFunctionError", true)
+	}
+	if nil != mapping.OnFailureDestinationArn {
+		destinationArn := spartaCF.DynamicValueToStringExpr(mapping.OnFailureDestinationArn).String()
+		eventSourceMappingResource.DestinationConfig = &lambdaEventSourceMappingDestinationConfig{
+			OnFailure: &lambdaEventSourceMappingOnFailure{
+				Destination: destinationArn,
+			},
+		}
+		destinationJSON, destinationJSONErr := json.Marshal(destinationArn)
+		if nil != destinationJSONErr {
+			return errors.Wrapf(destinationJSONErr, "Failed to marshal EventSourceMapping OnFailureDestinationArn")
+		}
+		addOptionalHashPart("OnFailureDestinationArn", string(destinationJSON))
+	}
+	if 0 != mapping.TumblingWindowInSeconds {
+		eventSourceMappingResource.TumblingWindowInSeconds = gocf.Integer(mapping.TumblingWindowInSeconds)
+		addOptionalHashPart("TumblingWindowInSeconds", mapping.TumblingWindowInSeconds)
+	}
+	if len(mapping.FilterCriteria) != 0 {
+		filterCriteria := &lambdaEventSourceMappingFilterCriteria{}
+		for _, eachPattern := range mapping.FilterCriteria {
+			patternJSON, patternJSONErr := eachPattern.patternJSON()
+			if nil != patternJSONErr {
+				return errors.Wrapf(patternJSONErr, "Invalid EventSourceMapping FilterCriteria pattern")
+			}
+			filterCriteria.Filters = append(filterCriteria.Filters, &lambdaEventSourceMappingFilter{
+				Pattern: gocf.String(patternJSON),
+			})
+			addOptionalHashPart("FilterCriteria", patternJSON)
+		}
+		eventSourceMappingResource.FilterCriteria = filterCriteria
 	}
 
 	// Unique components for the hash for the EventSource mapping
@@ -520,6 +786,7 @@ func (mapping *EventSourceMapping) export(serviceName string,
 		fmt.Sprintf("%d", mapping.BatchSize),
 		mapping.StartingPosition,
 	}
+	hashParts = append(hashParts, optionalHashParts...)
 	hash := sha1.New()
 	for _, eachHashPart := range hashParts {
 		_, writeErr := hash.Write([]byte(eachHashPart))
@@ -948,6 +1215,13 @@ func (info *LambdaAWSInfo) export(serviceName string,
 	}
 	info.Options.Environment[envVarLogLevel] =
 		gocf.String(logger.Level.String())
+	// Sessions created by the function use the provisioning endpoint
+	// overrides, unless the function defines its own
+	for eachKey, eachValue := range spartaAWS.EndpointEnvironment() {
+		if _, exists := info.Options.Environment[eachKey]; !exists {
+			info.Options.Environment[eachKey] = gocf.String(eachValue)
+		}
+	}
 
 	lambdaResource.Environment = &gocf.LambdaFunctionEnvironment{
 		Variables: info.Options.Environment,
@@ -960,12 +1234,33 @@ func (info *LambdaAWSInfo) export(serviceName string,
 	lambdaFunctionName := awsLambdaFunctionName(info.lambdaFunctionName())
 	lambdaResource.FunctionName = lambdaFunctionName.String()
 
-	cfResource := template.AddResource(info.LogicalResourceName(), lambdaResource)
+	var lambdaProperties gocf.ResourceProperties = lambdaResource
+	if len(info.Options.Layers) != 0 {
+		layersList, layersListErr := lambdaLayersList(info.Options.Layers)
+		if nil != layersListErr {
+			return errors.Wrapf(layersListErr, "Invalid layers for Lambda (%s)", info.lambdaFunctionName())
+		}
+		lambdaProperties = lambdaFunctionResource{
+			LambdaFunction: lambdaResource,
+			Layers:         layersList,
+		}
+	}
+	cfResource := template.AddResource(info.LogicalResourceName(), lambdaProperties)
 	cfResource.DependsOn = append(cfResource.DependsOn, dependsOn...)
 	safeMetadataInsert(cfResource, "golangFunc", info.lambdaFunctionName())
 
+	// The alias must exist before the permissions and event mappings
+	// that target it are exported
+	if nil != info.Options.Alias {
+		aliasErr := info.exportAlias(template)
+		if nil != aliasErr {
+			return errors.Wrapf(aliasErr, "Failed to export alias for Lambda (%s)", info.lambdaFunctionName())
+		}
+	} else if nil != info.Options.ProvisionedConcurrency {
+		return errors.Errorf("Lambda (%s) ProvisionedConcurrency requires an Alias", info.lambdaFunctionName())
+	}
 	// Create the lambda Ref in case we need a permission or event mapping
-	functionAttr := gocf.GetAtt(info.LogicalResourceName(), "Arn")
+	functionAttr := info.FunctionARN()
 
 	// Permissions
 	for _, eachPermission := range info.Permissions {
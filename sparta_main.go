@@ -8,6 +8,7 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -63,9 +64,16 @@ var CommandLineOptions = struct {
 	Root      *cobra.Command
 	Version   *cobra.Command
 	Provision *cobra.Command
+	Plan      *cobra.Command
 	Delete    *cobra.Command
 	Execute   *cobra.Command
 	Describe  *cobra.Command
+	Status    *cobra.Command
+	GC        *cobra.Command
+	Drift     *cobra.Command
+	Rollback  *cobra.Command
+	Logs      *cobra.Command
+	Invoke    *cobra.Command
 	Explore   *cobra.Command
 	Profile   *cobra.Command
 }{}
@@ -74,10 +82,17 @@ var CommandLineOptions = struct {
 // Provision options
 // Ref: http://docs.aws.amazon.com/AmazonS3/latest/dev/BucketRestrictions.html
 type optionsProvisionStruct struct {
-	S3Bucket        string `validate:"required"`
-	BuildID         string `validate:"-"` // non-whitespace
-	PipelineTrigger string `validate:"-"`
-	InPlace         bool   `validate:"-"`
+	S3Bucket        string   `validate:"required"`
+	BuildID         string   `validate:"-"` // non-whitespace
+	PipelineTrigger string   `validate:"-"`
+	InPlace         bool     `validate:"-"`
+	Confirm         bool     `validate:"-"`
+	Yes             bool     `validate:"-"`
+	GCKeep          int      `validate:"min=0"`
+	StackPolicy     string   `validate:"-"`
+	Protect         bool     `validate:"-"`
+	Parameters      []string `validate:"-"`
+	Regions         []string `validate:"-"`
 }
 
 var optionsProvision optionsProvisionStruct
@@ -100,6 +115,24 @@ func provisionBuildID(userSuppliedValue string) (string, error) {
 	return buildID, nil
 }
 
+/******************************************************************************/
+// Plan options
+type optionsPlanStruct struct {
+	S3Bucket   string   `validate:"required"`
+	BuildID    string   `validate:"-"` // non-whitespace
+	Parameters []string `validate:"-"`
+}
+
+var optionsPlan optionsPlanStruct
+
+/******************************************************************************/
+// Delete options
+type optionsDeleteStruct struct {
+	OverrideProtection bool `validate:"-"`
+}
+
+var optionsDelete optionsDeleteStruct
+
 /******************************************************************************/
 // Describe options
 type optionsDescribeStruct struct {
@@ -109,6 +142,78 @@ type optionsDescribeStruct struct {
 
 var optionsDescribe optionsDescribeStruct
 
+/******************************************************************************/
+// Status options
+const (
+	// StatusFormatText is the logger-based status output
+	StatusFormatText = "text"
+	// StatusFormatJSON is the JSON status output
+	StatusFormatJSON = "json"
+)
+
+type optionsStatusStruct struct {
+	Output string `validate:"eq=text|eq=json"`
+}
+
+var optionsStatus optionsStatusStruct
+
+/******************************************************************************/
+// GC options
+type optionsGCStruct struct {
+	S3Bucket string `validate:"required"`
+	Keep     int    `validate:"min=0"`
+}
+
+var optionsGC optionsGCStruct
+
+/******************************************************************************/
+// Drift options
+type optionsDriftStruct struct {
+	Output string `validate:"eq=text|eq=json"`
+}
+
+var optionsDrift optionsDriftStruct
+
+/******************************************************************************/
+// Rollback options
+type optionsRollbackStruct struct {
+	S3Bucket string `validate:"required"`
+	BuildID  string `validate:"-"`
+	Yes      bool   `validate:"-"`
+}
+
+var optionsRollback optionsRollbackStruct
+
+/******************************************************************************/
+// Logs options
+type optionsLogsStruct struct {
+	Function string        `validate:"-"`
+	Since    time.Duration `validate:"-"`
+	Filter   string        `validate:"-"`
+	Follow   bool          `validate:"-"`
+}
+
+var optionsLogs optionsLogsStruct
+
+/******************************************************************************/
+// Invoke options
+type optionsInvokeStruct struct {
+	Function string `validate:"-"`
+	Payload  string `validate:"-"`
+	Async    bool   `validate:"-"`
+	Template string `validate:"-"`
+}
+
+var optionsInvoke optionsInvokeStruct
+
+/******************************************************************************/
+// Explore options
+type optionsExploreStruct struct {
+	Port int `validate:"-"`
+}
+
+var optionsExplore optionsExploreStruct
+
 /******************************************************************************/
 // Profile options
 type optionsProfileStruct struct {
@@ -153,6 +258,19 @@ func init() {
 		"ldflags",
 		"",
 		"Go linker string definition flags (https://golang.org/cmd/link/)")
+	CommandLineOptions.Root.PersistentFlags().StringVar(&OptionsGlobal.ConfigFile,
+		"config",
+		"",
+		"Optional project configuration file (default: sparta.yaml, sparta.yml, or sparta.json)")
+	CommandLineOptions.Root.PersistentFlags().StringVar(&OptionsGlobal.ConfigProfile,
+		"configProfile",
+		"",
+		"Optional project configuration profile (eg: dev, prod)")
+	CommandLineOptions.Root.PersistentFlags().StringVar(&OptionsGlobal.Stage,
+		"stage",
+		"",
+		"Optional deployment stage (eg: dev, prod). The stage is appended to the stack name")
+	addAWSSessionFlags(CommandLineOptions.Root)
 
 	// Version
 	CommandLineOptions.Version = &cobra.Command{
@@ -189,6 +307,55 @@ func init() {
 		"c",
 		false,
 		"If the provision operation results in *only* function updates, bypass CloudFormation")
+	CommandLineOptions.Provision.Flags().BoolVarP(&optionsProvision.Confirm,
+		"confirm",
+		"",
+		false,
+		"Log the pending stack changes and prompt for confirmation before applying them")
+	CommandLineOptions.Provision.Flags().BoolVarP(&optionsProvision.Yes,
+		"yes",
+		"y",
+		false,
+		"Log the pending stack changes and apply them without prompting for confirmation")
+	CommandLineOptions.Provision.Flags().IntVarP(&optionsProvision.GCKeep,
+		"gc",
+		"",
+		0,
+		"If greater than zero, prune the S3 artifacts of all but this many previous builds after provisioning")
+	CommandLineOptions.Provision.Flags().StringVarP(&optionsProvision.StackPolicy,
+		"stackPolicy",
+		"",
+		"",
+		"Optional path to a JSON stack policy document to apply before the stack is updated")
+	CommandLineOptions.Provision.Flags().BoolVarP(&optionsProvision.Protect,
+		"terminationProtection",
+		"",
+		false,
+		"Enable termination protection for the stack")
+	addTemplateParameterFlag(CommandLineOptions.Provision, &optionsProvision.Parameters)
+	CommandLineOptions.Provision.Flags().StringSliceVarP(&optionsProvision.Regions,
+		"regions",
+		"",
+		[]string{},
+		"Optional comma separated regions to provision. The s3Bucket value must include the {region} placeholder if there is more than one region")
+
+	// Plan
+	CommandLineOptions.Plan = &cobra.Command{
+		Use:   "plan",
+		Short: "Preview service changes",
+		Long:  `Report the CloudFormation changes that a provision operation would apply`,
+	}
+	CommandLineOptions.Plan.Flags().StringVarP(&optionsPlan.S3Bucket,
+		"s3Bucket",
+		"s",
+		"",
+		"S3 Bucket to use for Lambda source")
+	CommandLineOptions.Plan.Flags().StringVarP(&optionsPlan.BuildID,
+		"buildID",
+		"i",
+		"",
+		"Optional BuildID to use")
+	addTemplateParameterFlag(CommandLineOptions.Plan, &optionsPlan.Parameters)
 
 	// Delete
 	CommandLineOptions.Delete = &cobra.Command{
@@ -196,6 +363,11 @@ func init() {
 		Short: "Delete service",
 		Long:  `Ensure service is successfully deleted`,
 	}
+	CommandLineOptions.Delete.Flags().BoolVarP(&optionsDelete.OverrideProtection,
+		"overrideProtection",
+		"",
+		false,
+		"Disable stack termination protection, if enabled, and delete the stack")
 
 	// Execute
 	CommandLineOptions.Execute = &cobra.Command{
@@ -221,12 +393,135 @@ func init() {
 		"",
 		"S3 Bucket to use for Lambda source")
 
+	// Status
+	CommandLineOptions.Status = &cobra.Command{
+		Use:   "status",
+		Short: "Report deployed service status",
+		Long:  `Report the deployed stack state, outputs, and function configuration`,
+	}
+	CommandLineOptions.Status.Flags().StringVarP(&optionsStatus.Output,
+		"output",
+		"o",
+		StatusFormatText,
+		"Status output format [text, json]")
+
+	// GC
+	CommandLineOptions.GC = &cobra.Command{
+		Use:     "gc",
+		Aliases: []string{"prune"},
+		Short:   "Prune service S3 artifacts",
+		Long:    `Delete the S3 artifacts that are referenced by neither the deployed stack nor the most recent builds`,
+	}
+	CommandLineOptions.GC.Flags().StringVarP(&optionsGC.S3Bucket,
+		"s3Bucket",
+		"s",
+		"",
+		"S3 Bucket used for Lambda source")
+	CommandLineOptions.GC.Flags().IntVarP(&optionsGC.Keep,
+		"keep",
+		"k",
+		5,
+		"Number of most recent builds whose artifacts are retained")
+
+	// Drift
+	CommandLineOptions.Drift = &cobra.Command{
+		Use:   "drift",
+		Short: "Detect service stack drift",
+		Long:  `Report the stack resources that were modified or deleted outside of CloudFormation`,
+	}
+	CommandLineOptions.Drift.Flags().StringVarP(&optionsDrift.Output,
+		"output",
+		"o",
+		StatusFormatText,
+		"Drift output format [text, json]")
+
+	// Rollback
+	CommandLineOptions.Rollback = &cobra.Command{
+		Use:   "rollback",
+		Short: "Redeploy a previous build",
+		Long:  `Redeploy the template and code of a previously provisioned build, or list the available builds`,
+	}
+	CommandLineOptions.Rollback.Flags().StringVarP(&optionsRollback.S3Bucket,
+		"s3Bucket",
+		"s",
+		"",
+		"S3 Bucket used for Lambda source")
+	CommandLineOptions.Rollback.Flags().StringVarP(&optionsRollback.BuildID,
+		"buildID",
+		"i",
+		"",
+		"BuildID to redeploy. If empty, the available BuildIDs are listed")
+	CommandLineOptions.Rollback.Flags().BoolVarP(&optionsRollback.Yes,
+		"yes",
+		"y",
+		false,
+		"Apply the pending stack changes without prompting for confirmation")
+
+	// Logs
+	CommandLineOptions.Logs = &cobra.Command{
+		Use:   "logs",
+		Short: "Tail service logs",
+		Long:  `Output the CloudWatch Logs entries for one or all of the service functions`,
+	}
+	CommandLineOptions.Logs.Flags().StringVarP(&optionsLogs.Function,
+		"function",
+		"u",
+		"",
+		"Optional function name to limit log output")
+	CommandLineOptions.Logs.Flags().DurationVarP(&optionsLogs.Since,
+		"since",
+		"s",
+		5*time.Minute,
+		"How far back to start fetching log entries")
+	CommandLineOptions.Logs.Flags().StringVarP(&optionsLogs.Filter,
+		"filter",
+		"r",
+		"",
+		"Optional CloudWatch Logs filter pattern")
+	CommandLineOptions.Logs.Flags().BoolVarP(&optionsLogs.Follow,
+		"follow",
+		"w",
+		true,
+		"Continue polling for new log entries")
+
+	// Invoke
+	CommandLineOptions.Invoke = &cobra.Command{
+		Use:   "invoke",
+		Short: "Invoke a deployed function",
+		Long:  `Invoke a deployed service function with a JSON payload`,
+	}
+	CommandLineOptions.Invoke.Flags().StringVarP(&optionsInvoke.Function,
+		"function",
+		"u",
+		"",
+		"Name of the function to invoke")
+	CommandLineOptions.Invoke.Flags().StringVarP(&optionsInvoke.Payload,
+		"payload",
+		"d",
+		"",
+		"Path to the JSON payload file. Use '-' to read from stdin")
+	CommandLineOptions.Invoke.Flags().BoolVarP(&optionsInvoke.Async,
+		"async",
+		"a",
+		false,
+		"Invoke the function asynchronously")
+	CommandLineOptions.Invoke.Flags().StringVarP(&optionsInvoke.Template,
+		"template",
+		"e",
+		"",
+		"Output a sample payload for the given event type [apigateway, cloudwatchlogs, dynamodb, kinesis, s3, ses, sns, sqs]")
+
 	// Explore
 	CommandLineOptions.Explore = &cobra.Command{
 		Use:   "explore",
 		Short: "Interactively explore service",
 		Long:  `Startup a localhost HTTP server to explore the exported Go functions`,
 	}
+	CommandLineOptions.Explore.Flags().IntVarP(&optionsExplore.Port,
+		"port",
+		"p",
+		9999,
+		"Alternative port for the explore HTTP server (default=9999)")
 
 	// Profile
 	CommandLineOptions.Profile = &cobra.Command{
@@ -246,6 +541,31 @@ func init() {
 		"Alternative port for `pprof` web UI (default=8080)")
 }
 
+// addAWSSessionFlags adds the flags that select the credentials and
+// region for every AWS session
+func addAWSSessionFlags(rootCmd *cobra.Command) {
+	rootCmd.PersistentFlags().StringVar(&OptionsGlobal.AWSProfile,
+		"profile",
+		"",
+		"Optional AWS shared configuration profile")
+	rootCmd.PersistentFlags().StringVar(&OptionsGlobal.AWSRegion,
+		"region",
+		"",
+		"Optional AWS region")
+	rootCmd.PersistentFlags().StringVar(&OptionsGlobal.AWSRoleARN,
+		"roleArn",
+		"",
+		"Optional IAM role to assume for all AWS API calls")
+	rootCmd.PersistentFlags().StringVar(&OptionsGlobal.AWSExternalID,
+		"externalId",
+		"",
+		"Optional external ID used to assume the --roleArn role")
+	rootCmd.PersistentFlags().StringVar(&OptionsGlobal.AWSMFASerialNumber,
+		"mfaSerial",
+		"",
+		"Optional MFA device serial number or ARN used to assume the --roleArn role. The token code is read from stdin")
+}
+
 // CommandLineOptionsHook allows embedding applications the ability
 // to validate caller-defined command line arguments.  Return an error
 // if the command line fails.
@@ -282,6 +602,24 @@ func ParseOptions(handler CommandLineOptionsHook) error {
 		"t",
 		"",
 		"Optional build tags for conditional compilation")
+	parseCmdRoot.PersistentFlags().StringVar(&OptionsGlobal.ConfigFile,
+		"config",
+		"",
+		"Optional project configuration file (default: sparta.yaml, sparta.yml, or sparta.json)")
+	parseCmdRoot.PersistentFlags().StringVar(&OptionsGlobal.ConfigProfile,
+		"configProfile",
+		"",
+		"Optional project configuration profile (eg: dev, prod)")
+	parseCmdRoot.PersistentFlags().StringVar(&OptionsGlobal.Stage,
+		"stage",
+		"",
+		"Optional deployment stage (eg: dev, prod). The stage is appended to the stack name")
+	addAWSSessionFlags(parseCmdRoot)
+	// Supply any project configuration defaults before the command
+	// specific validation
+	parseCmdRoot.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return applyProjectConfigDefaults(cmd)
+	}
 
 	// Now, for any user-attached commands, add them to the temporary Parse
 	// root command.
@@ -323,9 +661,16 @@ func ParseOptions(handler CommandLineOptionsHook) error {
 	spartaCommands := []*cobra.Command{
 		CommandLineOptions.Version,
 		CommandLineOptions.Provision,
+		CommandLineOptions.Plan,
 		CommandLineOptions.Delete,
 		CommandLineOptions.Execute,
 		CommandLineOptions.Describe,
+		CommandLineOptions.Status,
+		CommandLineOptions.GC,
+		CommandLineOptions.Drift,
+		CommandLineOptions.Rollback,
+		CommandLineOptions.Logs,
+		CommandLineOptions.Invoke,
 		CommandLineOptions.Explore,
 		CommandLineOptions.Profile,
 	}
@@ -345,6 +690,14 @@ func ParseOptions(handler CommandLineOptionsHook) error {
 	}
 	parseCmdRoot.AddCommand(CommandLineOptions.Provision)
 
+	CommandLineOptions.Plan.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if handler != nil {
+			return handler(CommandLineOptions.Plan)
+		}
+		return nil
+	}
+	parseCmdRoot.AddCommand(CommandLineOptions.Plan)
+
 	CommandLineOptions.Delete.PreRunE = func(cmd *cobra.Command, args []string) error {
 		if handler != nil {
 			return handler(CommandLineOptions.Delete)
@@ -369,6 +722,54 @@ func ParseOptions(handler CommandLineOptionsHook) error {
 	}
 	parseCmdRoot.AddCommand(CommandLineOptions.Describe)
 
+	CommandLineOptions.Status.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if handler != nil {
+			return handler(CommandLineOptions.Status)
+		}
+		return nil
+	}
+	parseCmdRoot.AddCommand(CommandLineOptions.Status)
+
+	CommandLineOptions.GC.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if handler != nil {
+			return handler(CommandLineOptions.GC)
+		}
+		return nil
+	}
+	parseCmdRoot.AddCommand(CommandLineOptions.GC)
+
+	CommandLineOptions.Drift.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if handler != nil {
+			return handler(CommandLineOptions.Drift)
+		}
+		return nil
+	}
+	parseCmdRoot.AddCommand(CommandLineOptions.Drift)
+
+	CommandLineOptions.Rollback.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if handler != nil {
+			return handler(CommandLineOptions.Rollback)
+		}
+		return nil
+	}
+	parseCmdRoot.AddCommand(CommandLineOptions.Rollback)
+
+	CommandLineOptions.Logs.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if handler != nil {
+			return handler(CommandLineOptions.Logs)
+		}
+		return nil
+	}
+	parseCmdRoot.AddCommand(CommandLineOptions.Logs)
+
+	CommandLineOptions.Invoke.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if handler != nil {
+			return handler(CommandLineOptions.Invoke)
+		}
+		return nil
+	}
+	parseCmdRoot.AddCommand(CommandLineOptions.Invoke)
+
 	CommandLineOptions.Explore.PreRunE = func(cmd *cobra.Command, args []string) error {
 		if handler != nil {
 			return handler(CommandLineOptions.Explore)
@@ -71,6 +71,7 @@ func MainEx(serviceName string,
 			"UTC":           (time.Now().UTC().Format(time.RFC3339)),
 		}).Info(welcomeMessage)
 		OptionsGlobal.ServiceName = StampedServiceName
+		OptionsGlobal.Stage = os.Getenv(envVarStage)
 		OptionsGlobal.Logger = logger
 		return nil
 	}
@@ -83,12 +84,24 @@ func MainEx(serviceName string,
 	return CommandLineOptions.Root.Execute()
 }
 
+// applyProjectConfigDefaults is a NOP in the AWS Lambda binary, which is
+// configured by its environment
+func applyProjectConfigDefaults(cmd *cobra.Command) error {
+	return nil
+}
+
 // Delete is not available in the AWS Lambda binary
 func Delete(serviceName string, logger *logrus.Logger) error {
 	logger.Error("Delete() not supported in AWS Lambda binary")
 	return errors.New("Delete not supported for this binary")
 }
 
+// DeleteEx is not available in the AWS Lambda binary
+func DeleteEx(serviceName string, overrideProtection bool, logger *logrus.Logger) error {
+	logger.Error("DeleteEx() not supported in AWS Lambda binary")
+	return errors.New("DeleteEx not supported for this binary")
+}
+
 // Provision is not available in the AWS Lambda binary
 func Provision(noop bool,
 	serviceName string,
@@ -110,6 +123,25 @@ func Provision(noop bool,
 	return errors.New("Provision not supported for this binary")
 }
 
+// Plan is not available in the AWS Lambda binary
+func Plan(noop bool,
+	serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api *API,
+	site *S3Site,
+	s3Bucket string,
+	useCGO bool,
+	buildID string,
+	templateParameterValues map[string]string,
+	buildTags string,
+	linkerFlags string,
+	workflowHooks *WorkflowHooks,
+	logger *logrus.Logger) error {
+	logger.Error("Plan() not supported in AWS Lambda binary")
+	return errors.New("Plan not supported for this binary")
+}
+
 // Describe is not available in the AWS Lambda binary
 func Describe(serviceName string,
 	serviceDescription string,
@@ -126,6 +158,91 @@ func Describe(serviceName string,
 	return errors.New("Describe not supported for this binary")
 }
 
+// Status is not available in the AWS Lambda binary
+func Status(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	outputFormat string,
+	outputWriter io.Writer,
+	logger *logrus.Logger) error {
+	logger.Error("Status() not supported in AWS Lambda binary")
+	return errors.New("Status not supported for this binary")
+}
+
+// Prune is not available in the AWS Lambda binary
+func Prune(serviceName string,
+	s3Bucket string,
+	keepCount int,
+	noop bool,
+	logger *logrus.Logger) error {
+	logger.Error("Prune() not supported in AWS Lambda binary")
+	return errors.New("Prune not supported for this binary")
+}
+
+// Drift is not available in the AWS Lambda binary
+func Drift(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	outputFormat string,
+	outputWriter io.Writer,
+	logger *logrus.Logger) error {
+	logger.Error("Drift() not supported in AWS Lambda binary")
+	return errors.New("Drift not supported for this binary")
+}
+
+// Rollback is not available in the AWS Lambda binary
+func Rollback(serviceName string,
+	s3Bucket string,
+	buildID string,
+	autoApprove bool,
+	noop bool,
+	logger *logrus.Logger) error {
+	logger.Error("Rollback() not supported in AWS Lambda binary")
+	return errors.New("Rollback not supported for this binary")
+}
+
+// Logs is not available in the AWS Lambda binary
+func Logs(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	functionName string,
+	since time.Duration,
+	filterPattern string,
+	follow bool,
+	outputWriter io.Writer,
+	logger *logrus.Logger) error {
+	logger.Error("Logs() not supported in AWS Lambda binary")
+	return errors.New("Logs not supported for this binary")
+}
+
+// Invoke is not available in the AWS Lambda binary
+func Invoke(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	functionName string,
+	payloadReader io.Reader,
+	async bool,
+	outputWriter io.Writer,
+	logger *logrus.Logger) error {
+	logger.Error("Invoke() not supported in AWS Lambda binary")
+	return errors.New("Invoke not supported for this binary")
+}
+
+// InvokeEventTemplate is not available in the AWS Lambda binary
+func InvokeEventTemplate(eventType string, outputWriter io.Writer) error {
+	return errors.New("InvokeEventTemplate not supported for this binary")
+}
+
+// Explore is not available in the AWS Lambda binary
+func Explore(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	port int,
+	logger *logrus.Logger) error {
+	logger.Error("Explore() not supported in AWS Lambda binary")
+	return errors.New("Explore not supported for this binary")
+}
+
 // Profile is the interactive command used to pull S3 assets locally into /tmp
 // and run ppro against the cached profiles
 func Profile(serviceName string,
@@ -4,11 +4,16 @@ package sparta
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -18,6 +23,54 @@ func platformLogSysInfo(lambdaFunc string, logger *logrus.Logger) {
 	// NOP
 }
 
+// applyProjectConfigDefaults applies the project configuration values to
+// the command's unset flags
+func applyProjectConfigDefaults(cmd *cobra.Command) error {
+	_, _, configErr := projectConfigDefaults(cmd)
+	return configErr
+}
+
+// applyAWSSessionOptions applies the global AWS credential and region
+// flags, together with the project configuration endpoints, to the
+// sessions that are subsequently created
+func applyAWSSessionOptions(configValues *projectConfigValues, logger *logrus.Logger) error {
+	if "" != OptionsGlobal.AWSRegion {
+		// Publish the region for sessions that aren't created by Sparta
+		setErr := os.Setenv("AWS_REGION", OptionsGlobal.AWSRegion)
+		if nil != setErr {
+			return setErr
+		}
+	}
+	optionsErr := spartaAWS.SetSessionOptions(spartaAWS.SessionOptions{
+		Profile:          OptionsGlobal.AWSProfile,
+		Region:           OptionsGlobal.AWSRegion,
+		RoleARN:          OptionsGlobal.AWSRoleARN,
+		ExternalID:       OptionsGlobal.AWSExternalID,
+		MFASerialNumber:  OptionsGlobal.AWSMFASerialNumber,
+		Endpoints:        configValues.Endpoints,
+		S3ForcePathStyle: configValues.S3ForcePathStyle,
+	})
+	if nil != optionsErr {
+		return optionsErr
+	}
+	if "" != OptionsGlobal.AWSProfile ||
+		"" != OptionsGlobal.AWSRegion ||
+		"" != OptionsGlobal.AWSRoleARN {
+		logger.WithFields(logrus.Fields{
+			"Profile": OptionsGlobal.AWSProfile,
+			"Region":  OptionsGlobal.AWSRegion,
+			"RoleArn": OptionsGlobal.AWSRoleARN,
+		}).Info("AWS session")
+	}
+	if len(configValues.Endpoints) != 0 {
+		logger.WithFields(logrus.Fields{
+			"Endpoints":        configValues.Endpoints,
+			"S3ForcePathStyle": configValues.S3ForcePathStyle,
+		}).Info("AWS endpoint overrides")
+	}
+	return nil
+}
+
 // RegisterCodePipelineEnvironment is part of a CodePipeline deployment
 // and defines the environments available for deployment. Environments
 // are defined the `environmentName`. The values defined in the
@@ -89,6 +142,17 @@ func MainEx(serviceName string,
 		SpartaVersion)
 	CommandLineOptions.Root.Long = serviceDescription
 	CommandLineOptions.Root.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		// Apply the project configuration defaults to any flags
+		// that weren't supplied
+		configValues, configPath, configErr := projectConfigDefaults(cmd)
+		if nil != configErr {
+			return configErr
+		}
+		// The configuration can target a different stack. The
+		// command RunE closures all share the serviceName variable.
+		if "" != configValues.StackName {
+			serviceName = configValues.StackName
+		}
 		// Save the ServiceName in case a custom command wants it
 		OptionsGlobal.ServiceName = serviceName
 		OptionsGlobal.ServiceDescription = serviceDescription
@@ -97,6 +161,10 @@ func MainEx(serviceName string,
 		if nil != validateErr {
 			return validateErr
 		}
+		// Each stage is provisioned as a separate stack
+		serviceName = spartaCF.StageScopedStackName(serviceName, OptionsGlobal.Stage)
+		OptionsGlobal.ServiceName = serviceName
+
 		// Format?
 		// Running in AWS?
 		enableColors := (runtime.GOOS != "windows") && !isRunningInAWS()
@@ -117,8 +185,17 @@ func MainEx(serviceName string,
 		// This is a NOP, but makes megacheck happy b/c it doesn't know about
 		// build flags
 		platformLogSysInfo("", logger)
+		// Commands that write a JSON document to stdout log to stderr
+		// so that the document can be parsed
+		if (cmd == CommandLineOptions.Status && StatusFormatJSON == optionsStatus.Output) ||
+			(cmd == CommandLineOptions.Drift && StatusFormatJSON == optionsDrift.Output) {
+			logger.Out = os.Stderr
+		}
 		OptionsGlobal.Logger = logger
 		welcomeMessage := fmt.Sprintf("Service: %s", serviceName)
+		if "" != OptionsGlobal.Stage {
+			welcomeMessage = fmt.Sprintf("%s (stage: %s)", welcomeMessage, OptionsGlobal.Stage)
+		}
 
 		// Header information...
 		displayPrettyHeader(headerDivider, enableColors, logger)
@@ -128,6 +205,18 @@ func MainEx(serviceName string,
 			"UTC":       (time.Now().UTC().Format(time.RFC3339)),
 			"LinkFlags": OptionsGlobal.LinkerFlags,
 		}).Info(welcomeMessage)
+		if "" != configPath {
+			logger.WithFields(logrus.Fields{
+				"Path":    configPath,
+				"Profile": OptionsGlobal.ConfigProfile,
+				"Region":  configValues.Region,
+			}).Info("Project configuration")
+		}
+		// Every AWS session uses the same credentials and region
+		sessionErr := applyAWSSessionOptions(configValues, logger)
+		if nil != sessionErr {
+			return sessionErr
+		}
 		logger.Info(headerDivider)
 
 		return nil
@@ -151,34 +240,120 @@ func MainEx(serviceName string,
 
 	if nil == CommandLineOptions.Provision.RunE {
 		CommandLineOptions.Provision.RunE = func(cmd *cobra.Command, args []string) error {
-			buildID, buildIDErr := provisionBuildID(optionsProvision.BuildID)
-			if nil != buildIDErr {
-				return buildIDErr
+			newProvisionContext := func(s3Bucket string) (*workflowContext, error) {
+				ctx, ctxErr := newWorkflowContext(OptionsGlobal.Noop,
+					serviceName,
+					serviceDescription,
+					lambdaAWSInfos,
+					api,
+					site,
+					s3Bucket,
+					useCGO,
+					optionsProvision.InPlace,
+					optionsProvision.BuildID,
+					optionsProvision.PipelineTrigger,
+					OptionsGlobal.BuildTags,
+					OptionsGlobal.LinkerFlags,
+					nil,
+					workflowHooks,
+					OptionsGlobal.Logger)
+				if nil != ctxErr {
+					return nil, ctxErr
+				}
+				// Pending changes are only confirmed if requested
+				if optionsProvision.Confirm || optionsProvision.Yes {
+					ctx.userdata.changeApprover = stackChangeApprover(optionsProvision.Yes,
+						os.Stdin,
+						OptionsGlobal.Logger)
+				}
+				ctx.userdata.gcKeepCount = optionsProvision.GCKeep
+				if "" != optionsProvision.StackPolicy {
+					stackPolicy, stackPolicyErr := readStackPolicy(optionsProvision.StackPolicy)
+					if nil != stackPolicyErr {
+						return nil, stackPolicyErr
+					}
+					ctx.userdata.stackPolicy = stackPolicy
+				}
+				if optionsProvision.Protect {
+					ctx.userdata.terminationProtection = true
+				}
+				parameterValues, parameterValuesErr := parseTemplateParameterValues(optionsProvision.Parameters)
+				if nil != parameterValuesErr {
+					return nil, parameterValuesErr
+				}
+				ctx.userdata.templateParameterValues = parameterValues
+				return ctx, nil
+			}
+
+			regions, regionsErr := parseRegions(optionsProvision.Regions)
+			if nil != regionsErr {
+				return regionsErr
+			}
+			bucketNames, bucketNamesErr := regionalBucketNames(optionsProvision.S3Bucket, regions)
+			if nil != bucketNamesErr {
+				return bucketNamesErr
+			}
+			if len(regions) == 0 {
+				ctx, ctxErr := newProvisionContext(optionsProvision.S3Bucket)
+				if nil != ctxErr {
+					return ctxErr
+				}
+				return provisionService(ctx)
+			}
+			// Each region is provisioned with its own session and bucket
+			regionContexts := make([]*workflowContext, len(regions))
+			for eachIndex, eachRegion := range regions {
+				ctx, ctxErr := newProvisionContext(bucketNames[eachIndex])
+				if nil != ctxErr {
+					return ctxErr
+				}
+				ctx.context.awsSession = spartaAWS.NewSessionWithConfig(&aws.Config{
+					Region:                        aws.String(eachRegion),
+					CredentialsChainVerboseErrors: aws.Bool(true),
+				}, OptionsGlobal.Logger)
+				regionContexts[eachIndex] = ctx
+			}
+			return provisionServiceRegions(regionContexts)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Provision)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Plan
+	if nil == CommandLineOptions.Plan.RunE {
+		CommandLineOptions.Plan.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsPlan)
+			if nil != validateErr {
+				return validateErr
 			}
-			return Provision(OptionsGlobal.Noop,
+			parameterValues, parameterValuesErr := parseTemplateParameterValues(optionsPlan.Parameters)
+			if nil != parameterValuesErr {
+				return parameterValuesErr
+			}
+			return Plan(OptionsGlobal.Noop,
 				serviceName,
 				serviceDescription,
 				lambdaAWSInfos,
 				api,
 				site,
-				optionsProvision.S3Bucket,
+				optionsPlan.S3Bucket,
 				useCGO,
-				optionsProvision.InPlace,
-				buildID,
-				optionsProvision.PipelineTrigger,
+				optionsPlan.BuildID,
+				parameterValues,
 				OptionsGlobal.BuildTags,
 				OptionsGlobal.LinkerFlags,
-				nil,
 				workflowHooks,
 				OptionsGlobal.Logger)
 		}
 	}
-	CommandLineOptions.Root.AddCommand(CommandLineOptions.Provision)
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Plan)
 
 	//////////////////////////////////////////////////////////////////////////////
 	// Delete
 	CommandLineOptions.Delete.RunE = func(cmd *cobra.Command, args []string) error {
-		return Delete(serviceName, OptionsGlobal.Logger)
+		return DeleteEx(serviceName,
+			optionsDelete.OverrideProtection,
+			OptionsGlobal.Logger)
 	}
 
 	CommandLineOptions.Root.AddCommand(CommandLineOptions.Delete)
@@ -233,6 +408,153 @@ func MainEx(serviceName string,
 	}
 	CommandLineOptions.Root.AddCommand(CommandLineOptions.Describe)
 
+	//////////////////////////////////////////////////////////////////////////////
+	// Status
+	if nil == CommandLineOptions.Status.RunE {
+		CommandLineOptions.Status.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsStatus)
+			if nil != validateErr {
+				return validateErr
+			}
+			return Status(serviceName,
+				serviceDescription,
+				lambdaAWSInfos,
+				optionsStatus.Output,
+				os.Stdout,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Status)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// GC
+	if nil == CommandLineOptions.GC.RunE {
+		CommandLineOptions.GC.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsGC)
+			if nil != validateErr {
+				return validateErr
+			}
+			return Prune(serviceName,
+				optionsGC.S3Bucket,
+				optionsGC.Keep,
+				OptionsGlobal.Noop,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.GC)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Drift
+	if nil == CommandLineOptions.Drift.RunE {
+		CommandLineOptions.Drift.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsDrift)
+			if nil != validateErr {
+				return validateErr
+			}
+			return Drift(serviceName,
+				serviceDescription,
+				lambdaAWSInfos,
+				optionsDrift.Output,
+				os.Stdout,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Drift)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Rollback
+	if nil == CommandLineOptions.Rollback.RunE {
+		CommandLineOptions.Rollback.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsRollback)
+			if nil != validateErr {
+				return validateErr
+			}
+			return Rollback(serviceName,
+				optionsRollback.S3Bucket,
+				optionsRollback.BuildID,
+				optionsRollback.Yes,
+				OptionsGlobal.Noop,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Rollback)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Logs
+	if nil == CommandLineOptions.Logs.RunE {
+		CommandLineOptions.Logs.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsLogs)
+			if nil != validateErr {
+				return validateErr
+			}
+			return Logs(serviceName,
+				serviceDescription,
+				lambdaAWSInfos,
+				optionsLogs.Function,
+				optionsLogs.Since,
+				optionsLogs.Filter,
+				optionsLogs.Follow,
+				os.Stdout,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Logs)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Invoke
+	if nil == CommandLineOptions.Invoke.RunE {
+		CommandLineOptions.Invoke.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsInvoke)
+			if nil != validateErr {
+				return validateErr
+			}
+			// Template requests only output the sample payload
+			if "" != optionsInvoke.Template {
+				return InvokeEventTemplate(optionsInvoke.Template, os.Stdout)
+			}
+			var payloadReader io.Reader = strings.NewReader("")
+			switch optionsInvoke.Payload {
+			case "":
+				// Empty payload
+			case "-":
+				payloadReader = os.Stdin
+			default:
+				payloadFile, payloadFileErr := os.Open(optionsInvoke.Payload)
+				if nil != payloadFileErr {
+					return payloadFileErr
+				}
+				defer payloadFile.Close()
+				payloadReader = payloadFile
+			}
+			return Invoke(serviceName,
+				serviceDescription,
+				lambdaAWSInfos,
+				optionsInvoke.Function,
+				payloadReader,
+				optionsInvoke.Async,
+				os.Stdout,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Invoke)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Explore
+	if nil == CommandLineOptions.Explore.RunE {
+		CommandLineOptions.Explore.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsExplore)
+			if nil != validateErr {
+				return validateErr
+			}
+			return Explore(serviceName,
+				serviceDescription,
+				lambdaAWSInfos,
+				optionsExplore.Port,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Explore)
+
 	//////////////////////////////////////////////////////////////////////////////
 	// Profile
 	if nil == CommandLineOptions.Profile.RunE {
@@ -8,10 +8,39 @@ import (
 	"os"
 	"testing"
 
+	spartaAWS "github.com/mweagle/Sparta/aws"
 	spartaCFResources "github.com/mweagle/Sparta/aws/cloudformation/resources"
 	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/sirupsen/logrus"
 )
 
+func testExportHandler(ctx context.Context) (string, error) {
+	return "Exported", nil
+}
+
+// testExportLambda exports a function with the options and event source
+// mappings into a new template. Nil options use the function defaults.
+func testExportLambda(options *LambdaFunctionOptions,
+	eventSourceMappings ...*EventSourceMapping) (*LambdaAWSInfo, *gocf.Template, error) {
+	lambdaFn := HandleAWSLambda("TestExport", testExportHandler, LambdaExecuteARN)
+	if nil != options {
+		lambdaFn.Options = options
+	}
+	lambdaFn.EventSourceMappings = append(lambdaFn.EventSourceMappings, eventSourceMappings...)
+	template := gocf.NewTemplate()
+	exportErr := lambdaFn.export("TestExportService",
+		"bootstrap",
+		"artifacts",
+		"TestExportService/code.zip",
+		"",
+		"testBuildID",
+		map[string]*gocf.StringExpr{LambdaExecuteARN: gocf.String(LambdaExecuteARN)},
+		template,
+		nil,
+		logrus.New())
+	return lambdaFn, template, exportErr
+}
+
 type StructHandler1 struct {
 }
 
@@ -328,3 +357,51 @@ func TestNOP(t *testing.T) {
 	json, _ := json.MarshalIndent(template, "", " ")
 	fmt.Printf("\n%s\n", string(json))
 }
+
+func TestEndpointEnvironmentExport(t *testing.T) {
+	defer spartaAWS.SetSessionOptions(spartaAWS.SessionOptions{})
+	spartaAWS.SetSessionOptions(spartaAWS.SessionOptions{
+		Endpoints: map[string]string{
+			"cloudformation": "http://localhost:4581",
+		},
+		S3ForcePathStyle: true,
+	})
+	lambdaFn, template, exportErr := testExportLambda(&LambdaFunctionOptions{
+		Environment: map[string]*gocf.StringExpr{
+			spartaAWS.EnvVarS3ForcePathStyle: gocf.String("false"),
+		},
+	})
+	if nil != exportErr {
+		t.Fatal(exportErr)
+	}
+	handlerName, handlerErr := ensureCustomResourceHandler("TestExportService",
+		"bootstrap",
+		spartaCFResources.S3LambdaEventSource,
+		gocf.String("arn:aws:s3:::bucket"),
+		[]string{},
+		template,
+		"artifacts",
+		"TestExportService/code.zip",
+		logrus.New())
+	if nil != handlerErr {
+		t.Fatal(handlerErr)
+	}
+	for eachName, eachExpected := range map[string][]string{
+		// The function's own value takes precedence
+		lambdaFn.LogicalResourceName(): {
+			`"SPARTA_ENDPOINT_CLOUDFORMATION":"http://localhost:4581"`,
+			`"SPARTA_S3_FORCE_PATH_STYLE":"false"`,
+		},
+		handlerName: {
+			`"SPARTA_ENDPOINT_CLOUDFORMATION":"http://localhost:4581"`,
+			`"SPARTA_S3_FORCE_PATH_STYLE":"true"`,
+		},
+	} {
+		resourceJSON, _ := json.Marshal(template.Resources[eachName].Properties)
+		for _, eachValue := range eachExpected {
+			if !bytes.Contains(resourceJSON, []byte(eachValue)) {
+				t.Errorf("Expected %s Environment to include %s: %s", eachName, eachValue, string(resourceJSON))
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"testing"
+
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+func TestStageScopedStackName(t *testing.T) {
+	if spartaCF.StageScopedStackName("MyService", "") != "MyService" {
+		t.Errorf("Expected unscoped stack name without stage")
+	}
+	if spartaCF.StageScopedStackName("MyService", "prod") != "MyService-prod" {
+		t.Errorf("Expected stage scoped stack name")
+	}
+}
+
+func TestStageOptions(t *testing.T) {
+	logger, _ := NewLogger("info")
+	lambdaFn := HandleAWSLambda(LambdaName(mockLambda1),
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.MemorySize = 128
+	lambdaFn.Options.Environment = map[string]*gocf.StringExpr{
+		"TABLE_NAME": gocf.String("devTable"),
+		"LOG_SAMPLE": gocf.String("1"),
+	}
+	lambdaFn.Options.StageOptions = map[string]*LambdaFunctionStageOptions{
+		"prod": {
+			MemorySize: 1024,
+			Environment: map[string]*gocf.StringExpr{
+				"TABLE_NAME": gocf.String("prodTable"),
+			},
+			ReservedConcurrentExecutions: 10,
+		},
+	}
+	annotateStage(lambdaFn, "prod", logger)
+	if lambdaFn.Options.MemorySize != 1024 {
+		t.Errorf("Expected stage MemorySize, got %d", lambdaFn.Options.MemorySize)
+	}
+	if lambdaFn.Options.ReservedConcurrentExecutions != 10 {
+		t.Errorf("Expected stage ReservedConcurrentExecutions, got %d",
+			lambdaFn.Options.ReservedConcurrentExecutions)
+	}
+	if lambdaFn.Options.Timeout != 3 {
+		t.Errorf("Expected default Timeout to be preserved, got %d", lambdaFn.Options.Timeout)
+	}
+	expectedEnv := map[string]string{
+		"TABLE_NAME": "prodTable",
+		"LOG_SAMPLE": "1",
+		envVarStage:  "prod",
+	}
+	for eachKey, eachValue := range expectedEnv {
+		envValue, exists := lambdaFn.Options.Environment[eachKey]
+		if !exists || envValue.Literal != eachValue {
+			t.Errorf("Expected environment %s=%s, got %#v", eachKey, eachValue, envValue)
+		}
+	}
+}
+
+func TestStageAPI(t *testing.T) {
+	api := NewAPIGateway("StageAPI", NewStage("v1"))
+	if api.stageAPI("") != api {
+		t.Errorf("Expected unmodified API without stage")
+	}
+	devAPI := api.stageAPI("dev")
+	if devAPI.stage.name != "dev" || api.stage.name != "v1" {
+		t.Errorf("Expected default stage to be deployed as dev")
+	}
+	api.Stages = map[string]*Stage{
+		"prod": NewStage("production"),
+	}
+	prodAPI := api.stageAPI("prod")
+	if prodAPI.stage.name != "production" {
+		t.Errorf("Expected prod stage definition, got %s", prodAPI.stage.name)
+	}
+}
@@ -0,0 +1,248 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// functionStatus is the deployed state of a single Lambda function
+type functionStatus struct {
+	LogicalResourceName string     `json:"logicalResourceName"`
+	FunctionName        string     `json:"functionName,omitempty"`
+	PhysicalName        string     `json:"physicalName"`
+	MemorySize          int64      `json:"memorySize"`
+	Timeout             int64      `json:"timeout"`
+	Version             string     `json:"version,omitempty"`
+	LastModified        string     `json:"lastModified,omitempty"`
+	ResourceStatus      string     `json:"resourceStatus,omitempty"`
+	LastUpdatedTime     *time.Time `json:"lastUpdatedTime,omitempty"`
+}
+
+// serviceStatus is the deployed state of the service stack
+type serviceStatus struct {
+	StackName       string            `json:"stackName"`
+	StackID         string            `json:"stackId"`
+	Status          string            `json:"status"`
+	StatusReason    string            `json:"statusReason,omitempty"`
+	CreationTime    *time.Time        `json:"creationTime,omitempty"`
+	LastUpdatedTime *time.Time        `json:"lastUpdatedTime,omitempty"`
+	BuildID         string            `json:"buildId,omitempty"`
+	BuildTags       string            `json:"buildTags,omitempty"`
+	SpartaVersion   string            `json:"spartaVersion,omitempty"`
+	Outputs         map[string]string `json:"outputs"`
+	Functions       []*functionStatus `json:"functions"`
+}
+
+// newServiceStatus extracts the Sparta tags and outputs from the stack
+func newServiceStatus(stack *cloudformation.Stack) *serviceStatus {
+	status := &serviceStatus{
+		StackName:       aws.StringValue(stack.StackName),
+		StackID:         aws.StringValue(stack.StackId),
+		Status:          aws.StringValue(stack.StackStatus),
+		StatusReason:    aws.StringValue(stack.StackStatusReason),
+		CreationTime:    stack.CreationTime,
+		LastUpdatedTime: stack.LastUpdatedTime,
+		Outputs:         make(map[string]string),
+		Functions:       make([]*functionStatus, 0),
+	}
+	for _, eachTag := range stack.Tags {
+		switch aws.StringValue(eachTag.Key) {
+		case SpartaTagBuildIDKey:
+			status.BuildID = aws.StringValue(eachTag.Value)
+		case SpartaTagBuildTagsKey:
+			status.BuildTags = aws.StringValue(eachTag.Value)
+		case SpartaTagVersionKey:
+			status.SpartaVersion = aws.StringValue(eachTag.Value)
+		}
+	}
+	for _, eachOutput := range stack.Outputs {
+		status.Outputs[aws.StringValue(eachOutput.OutputKey)] = aws.StringValue(eachOutput.OutputValue)
+	}
+	return status
+}
+
+// stackFunctionStatus returns the status of every AWS::Lambda::Function
+// resource in the stack and its nested stacks, including those that back
+// CustomResources
+func stackFunctionStatus(stackName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	awsSession *session.Session,
+	logger *logrus.Logger) ([]*functionStatus, error) {
+
+	// Map the logical resource names back to Sparta function names
+	functionNames := make(map[string]string)
+	for _, eachLambdaInfo := range lambdaAWSInfos {
+		functionNames[eachLambdaInfo.LogicalResourceName()] = eachLambdaInfo.lambdaFunctionName()
+		for _, eachCustomResource := range eachLambdaInfo.customResources {
+			functionNames[eachCustomResource.logicalName()] = eachCustomResource.userFunctionName
+		}
+	}
+
+	// Functions may be in nested stacks
+	stackResources, stackResourcesErr := spartaCF.ListStackResources(stackName, awsSession)
+	if nil != stackResourcesErr {
+		return nil, stackResourcesErr
+	}
+	functions := make([]*functionStatus, 0)
+	for _, eachSummary := range stackResources {
+		if "AWS::Lambda::Function" != aws.StringValue(eachSummary.ResourceType) {
+			continue
+		}
+		logicalName := aws.StringValue(eachSummary.LogicalResourceId)
+		functions = append(functions, &functionStatus{
+			LogicalResourceName: logicalName,
+			FunctionName:        functionNames[logicalName],
+			PhysicalName:        aws.StringValue(eachSummary.PhysicalResourceId),
+			ResourceStatus:      aws.StringValue(eachSummary.ResourceStatus),
+			LastUpdatedTime:     eachSummary.LastUpdatedTimestamp,
+		})
+	}
+
+	awsLambda := lambda.New(awsSession)
+	for _, eachFunction := range functions {
+		if "" == eachFunction.PhysicalName {
+			continue
+		}
+		config, configErr := awsLambda.GetFunctionConfiguration(&lambda.GetFunctionConfigurationInput{
+			FunctionName: aws.String(eachFunction.PhysicalName),
+		})
+		if nil != configErr {
+			logger.WithFields(logrus.Fields{
+				"Function": eachFunction.PhysicalName,
+				"Error":    configErr,
+			}).Warn("Failed to get function configuration")
+			continue
+		}
+		eachFunction.MemorySize = aws.Int64Value(config.MemorySize)
+		eachFunction.Timeout = aws.Int64Value(config.Timeout)
+		eachFunction.Version = aws.StringValue(config.Version)
+		eachFunction.LastModified = aws.StringValue(config.LastModified)
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		return functions[i].LogicalResourceName < functions[j].LogicalResourceName
+	})
+	return functions, nil
+}
+
+// logServiceStatus outputs the status using the logger
+func logServiceStatus(status *serviceStatus, logger *logrus.Logger) {
+	timeString := func(value *time.Time) string {
+		if nil == value {
+			return ""
+		}
+		return value.Format(time.RFC3339)
+	}
+	logger.Info(headerDivider)
+	logger.WithFields(logrus.Fields{
+		"StackName":     status.StackName,
+		"Status":        status.Status,
+		"StatusReason":  status.StatusReason,
+		"Created":       timeString(status.CreationTime),
+		"LastUpdated":   timeString(status.LastUpdatedTime),
+		"BuildID":       status.BuildID,
+		"BuildTags":     status.BuildTags,
+		"SpartaVersion": status.SpartaVersion,
+	}).Info("Stack status")
+
+	if len(status.Outputs) != 0 {
+		logger.Info(subheaderDivider)
+		logger.Info("Stack Outputs")
+		logger.Info(subheaderDivider)
+		outputKeys := make([]string, 0)
+		for eachKey := range status.Outputs {
+			outputKeys = append(outputKeys, eachKey)
+		}
+		sort.Strings(outputKeys)
+		for _, eachKey := range outputKeys {
+			logger.WithFields(logrus.Fields{
+				"Value": status.Outputs[eachKey],
+			}).Info(eachKey)
+		}
+	}
+	if len(status.Functions) != 0 {
+		logger.Info(subheaderDivider)
+		logger.Info("Functions")
+		logger.Info(subheaderDivider)
+		for _, eachFunction := range status.Functions {
+			logger.WithFields(logrus.Fields{
+				"PhysicalName": eachFunction.PhysicalName,
+				"Function":     eachFunction.FunctionName,
+				"MemorySize":   eachFunction.MemorySize,
+				"Timeout":      eachFunction.Timeout,
+				"LastModified": eachFunction.LastModified,
+				"Status":       eachFunction.ResourceStatus,
+			}).Info(eachFunction.LogicalResourceName)
+		}
+	}
+	logger.Info(headerDivider)
+}
+
+// Status reports the deployed state of the service: the stack status,
+// Sparta build information, stack outputs, and the configuration of each
+// provisioned Lambda function. The outputFormat is either StatusFormatText,
+// which uses the logger, or StatusFormatJSON, which writes a JSON document
+// to outputWriter. The format is validated before any AWS calls are made.
+func Status(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	outputFormat string,
+	outputWriter io.Writer,
+	logger *logrus.Logger) error {
+
+	switch outputFormat {
+	case StatusFormatJSON, StatusFormatText, "":
+	default:
+		return fmt.Errorf("Unsupported status format: %s", outputFormat)
+	}
+	awsSession := spartaAWS.NewSession(logger)
+	exists, existsErr := spartaCF.StackExists(serviceName, awsSession, logger)
+	if nil != existsErr {
+		return existsErr
+	}
+	if !exists {
+		return errors.Errorf("Stack %s does not exist", serviceName)
+	}
+	awsCloudFormation := cloudformation.New(awsSession)
+	describeStacksOutput, describeStacksErr := awsCloudFormation.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(serviceName),
+	})
+	if nil != describeStacksErr {
+		return errors.Wrapf(describeStacksErr, "Failed to describe stack")
+	}
+	if len(describeStacksOutput.Stacks) != 1 {
+		return errors.Errorf("Expected single stack for %s, found %d",
+			serviceName,
+			len(describeStacksOutput.Stacks))
+	}
+	status := newServiceStatus(describeStacksOutput.Stacks[0])
+	functions, functionsErr := stackFunctionStatus(serviceName,
+		lambdaAWSInfos,
+		awsSession,
+		logger)
+	if nil != functionsErr {
+		return functionsErr
+	}
+	status.Functions = functions
+
+	if StatusFormatJSON == outputFormat {
+		encoder := json.NewEncoder(outputWriter)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(status)
+	}
+	logServiceStatus(status, logger)
+	return nil
+}
@@ -0,0 +1,49 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+func TestServiceStatus(t *testing.T) {
+	logger, _ := NewLogger("info")
+	stack := &cloudformation.Stack{
+		StackName:       aws.String("SampleStatus"),
+		StackId:         aws.String("arn:aws:cloudformation:us-west-2:000000000000:stack/SampleStatus/1"),
+		StackStatus:     aws.String(cloudformation.StackStatusUpdateComplete),
+		CreationTime:    aws.Time(time.Now()),
+		LastUpdatedTime: aws.Time(time.Now()),
+		Tags: []*cloudformation.Tag{
+			{
+				Key:   aws.String(SpartaTagBuildIDKey),
+				Value: aws.String("testBuildID"),
+			},
+			{
+				Key:   aws.String(SpartaTagVersionKey),
+				Value: aws.String(SpartaVersion),
+			},
+		},
+		Outputs: []*cloudformation.Output{
+			{
+				OutputKey:   aws.String(OutputAPIGatewayURL),
+				OutputValue: aws.String("https://example.execute-api.us-west-2.amazonaws.com/v1"),
+			},
+		},
+	}
+	status := newServiceStatus(stack)
+	if status.BuildID != "testBuildID" {
+		t.Errorf("Unexpected BuildID: %s", status.BuildID)
+	}
+	if status.SpartaVersion != SpartaVersion {
+		t.Errorf("Unexpected SpartaVersion: %s", status.SpartaVersion)
+	}
+	if _, exists := status.Outputs[OutputAPIGatewayURL]; !exists {
+		t.Errorf("Failed to find %s output", OutputAPIGatewayURL)
+	}
+	logServiceStatus(status, logger)
+}
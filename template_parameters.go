@@ -0,0 +1,94 @@
+package sparta
+
+import (
+	"regexp"
+	"strings"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// TemplateParameterTypeString is a string template parameter
+	TemplateParameterTypeString = "String"
+	// TemplateParameterTypeNumber is an integer or float template parameter
+	TemplateParameterTypeNumber = "Number"
+	// TemplateParameterTypeCommaDelimitedList is a list of strings separated
+	// by commas
+	TemplateParameterTypeCommaDelimitedList = "CommaDelimitedList"
+	// TemplateParameterTypeSSMString is a template parameter whose value
+	// is the name of an SSM Parameter Store String parameter. CloudFormation
+	// resolves the SSM value when the stack is created or updated.
+	TemplateParameterTypeSSMString = "AWS::SSM::Parameter::Value<String>"
+	// TemplateParameterTypeSSMStringList is the same as
+	// TemplateParameterTypeSSMString for a StringList SSM parameter
+	TemplateParameterTypeSSMStringList = "AWS::SSM::Parameter::Value<List<String>>"
+)
+
+// reTemplateParameterName is the set of valid CloudFormation
+// parameter names
+var reTemplateParameterName = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+// templateParameterDefinitions validates the WorkflowHooks.TemplateParameters
+// and returns the template parameters to declare. Parameters without a
+// Type are declared as TemplateParameterTypeString.
+func templateParameterDefinitions(parameters map[string]*gocf.Parameter) (map[string]*gocf.Parameter, error) {
+	definitions := make(map[string]*gocf.Parameter)
+	for eachName, eachParameter := range parameters {
+		if !reTemplateParameterName.MatchString(eachName) {
+			return nil, errors.Errorf("Invalid template parameter name (%s). Names must be alphanumeric",
+				eachName)
+		}
+		definition := gocf.Parameter{}
+		if nil != eachParameter {
+			definition = *eachParameter
+		}
+		if "" == definition.Type {
+			definition.Type = TemplateParameterTypeString
+		}
+		if "" != definition.Default && len(definition.AllowedValues) != 0 {
+			allowed := false
+			for _, eachValue := range definition.AllowedValues {
+				allowed = allowed || eachValue == definition.Default
+			}
+			if !allowed {
+				return nil, errors.Errorf("Template parameter (%s) default value %s is not an allowed value",
+					eachName,
+					definition.Default)
+			}
+		}
+		definitions[eachName] = &definition
+	}
+	return definitions, nil
+}
+
+// parseTemplateParameterValues parses the `Key=Value` command line
+// template parameter values
+func parseTemplateParameterValues(keyValues []string) (map[string]string, error) {
+	parameterValues := make(map[string]string)
+	for _, eachKeyValue := range keyValues {
+		parts := strings.SplitN(eachKeyValue, "=", 2)
+		if len(parts) != 2 || "" == parts[0] {
+			return nil, errors.Errorf("Invalid template parameter value (%s). Expected Key=Value",
+				eachKeyValue)
+		}
+		if _, exists := parameterValues[parts[0]]; exists {
+			return nil, errors.Errorf("Template parameter (%s) value supplied more than once",
+				parts[0])
+		}
+		parameterValues[parts[0]] = parts[1]
+	}
+	return parameterValues, nil
+}
+
+// addTemplateParameterFlag adds the repeatable `--param Key=Value` template
+// parameter flag to the command. The values are parsed with
+// parseTemplateParameterValues.
+func addTemplateParameterFlag(command *cobra.Command, keyValues *[]string) {
+	command.Flags().StringArrayVarP(keyValues,
+		"param",
+		"",
+		[]string{},
+		"Template parameter value as Key=Value. May be supplied more than once")
+}
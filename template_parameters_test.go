@@ -0,0 +1,103 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"testing"
+
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+func TestTemplateParameterDefinitions(t *testing.T) {
+	logLevel := &gocf.Parameter{
+		Default:       "info",
+		AllowedValues: []string{"info", "debug"},
+	}
+	definitions, definitionsErr := templateParameterDefinitions(map[string]*gocf.Parameter{
+		"LogLevel": logLevel,
+		"Account":  nil,
+	})
+	if nil != definitionsErr {
+		t.Fatal(definitionsErr)
+	}
+	if TemplateParameterTypeString != definitions["LogLevel"].Type ||
+		TemplateParameterTypeString != definitions["Account"].Type {
+		t.Errorf("Unexpected default parameter types: %#v", definitions)
+	}
+	if "" != logLevel.Type {
+		t.Errorf("Expected the service parameter to be unchanged")
+	}
+	for _, eachInvalid := range []map[string]*gocf.Parameter{
+		{"Log-Level": nil},
+		{"MemorySize": {
+			Type:          TemplateParameterTypeNumber,
+			Default:       "64",
+			AllowedValues: []string{"128", "256"},
+		}},
+	} {
+		_, invalidErr := templateParameterDefinitions(eachInvalid)
+		if nil == invalidErr {
+			t.Errorf("Expected error for: %#v", eachInvalid)
+		}
+	}
+}
+
+func TestWorkflowTemplateParameters(t *testing.T) {
+	logger, _ := NewLogger("info")
+	newContext := func(parameters map[string]*gocf.Parameter) (*workflowContext, error) {
+		return newWorkflowContext(true,
+			"SampleTemplateParameters",
+			"",
+			testLambdaData(),
+			nil,
+			nil,
+			"",
+			false,
+			false,
+			"testBuildID",
+			"",
+			"",
+			"",
+			nil,
+			&WorkflowHooks{TemplateParameters: parameters},
+			logger)
+	}
+	ctx, ctxErr := newContext(map[string]*gocf.Parameter{
+		"LogLevel": {Default: "info"},
+	})
+	if nil != ctxErr {
+		t.Fatal(ctxErr)
+	}
+	if TemplateParameterTypeString != ctx.userdata.templateParameters["LogLevel"].Type {
+		t.Errorf("Unexpected workflow template parameters: %#v", ctx.userdata.templateParameters)
+	}
+	_, invalidErr := newContext(map[string]*gocf.Parameter{
+		"Log-Level": nil,
+	})
+	if nil == invalidErr {
+		t.Error("Expected error for invalid template parameter name")
+	}
+}
+
+func TestParseTemplateParameterValues(t *testing.T) {
+	parameterValues, parameterValuesErr := parseTemplateParameterValues([]string{
+		"LogLevel=debug",
+		"Filter=a=b",
+	})
+	if nil != parameterValuesErr {
+		t.Fatal(parameterValuesErr)
+	}
+	if "debug" != parameterValues["LogLevel"] || "a=b" != parameterValues["Filter"] {
+		t.Errorf("Unexpected parameter values: %#v", parameterValues)
+	}
+	for _, eachInvalid := range [][]string{
+		{"LogLevel"},
+		{"=debug"},
+		{"LogLevel=info", "LogLevel=debug"},
+	} {
+		_, invalidErr := parseTemplateParameterValues(eachInvalid)
+		if nil == invalidErr {
+			t.Errorf("Expected error for: %v", eachInvalid)
+		}
+	}
+}
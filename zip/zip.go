@@ -17,7 +17,8 @@ import (
 type FileHeaderAnnotator func(header *zip.FileHeader) (*zip.FileHeader, error)
 
 // AnnotateAddToZip is an extended Zip writer that accepts an annotation function
-// to customize the FileHeader values written into the archive
+// to customize the FileHeader values written into the archive. If source is a
+// directory, the annotator is called for every entry in the directory tree.
 func AnnotateAddToZip(zipWriter *zip.Writer,
 	source string,
 	rootSource string,
@@ -96,6 +97,13 @@ func AnnotateAddToZip(zipWriter *zip.Writer,
 		} else {
 			header.Method = zip.Deflate
 		}
+		if annotator != nil {
+			annotatedHeader, annotatedHeaderErr := annotator(header)
+			if annotatedHeaderErr != nil {
+				return errors.Wrapf(annotatedHeaderErr, "Failed to annotate Zip entry file header")
+			}
+			header = annotatedHeader
+		}
 		writer, err := zipWriter.CreateHeader(header)
 		if err != nil {
 			return err